@@ -0,0 +1,117 @@
+package juno
+
+import (
+	"context"
+	"net/http"
+)
+
+//AdaptAuthRepo returns repo as an AuthRepoContext. Repositories that do not implement the context
+//variants are wrapped so the context is ignored and the plain methods are called.
+func AdaptAuthRepo(repo AuthRepo) AuthRepoContext {
+	if ctxRepo, ok := repo.(AuthRepoContext); ok {
+		return ctxRepo
+	}
+	return authRepoAdapter{repo}
+}
+
+type authRepoAdapter struct {
+	AuthRepo
+}
+
+func (a authRepoAdapter) GetPermissionsContext(ctx context.Context) ([]Permission, error) {
+	return a.GetPermissions()
+}
+
+func (a authRepoAdapter) GetPermissionContext(ctx context.Context, p Permission) (Permission, error) {
+	return a.GetPermission(p)
+}
+
+func (a authRepoAdapter) CreatePermissionContext(ctx context.Context, p Permission) (Permission, error) {
+	return a.CreatePermission(p)
+}
+
+func (a authRepoAdapter) GetRolesContext(ctx context.Context) ([]Role, error) {
+	return a.GetRoles()
+}
+
+func (a authRepoAdapter) GetRoleContext(ctx context.Context, r Role) (Role, error) {
+	return a.GetRole(r)
+}
+
+func (a authRepoAdapter) CreateRoleContext(ctx context.Context, r Role) (Role, error) {
+	return a.CreateRole(r)
+}
+
+func (a authRepoAdapter) GetRolePermissionsContext(ctx context.Context) ([]RolePermission, error) {
+	return a.GetRolePermissions()
+}
+
+func (a authRepoAdapter) AssignPermissionToRoleContext(ctx context.Context, r Role, p Permission) error {
+	return a.AssignPermissionToRole(r, p)
+}
+
+func (a authRepoAdapter) RevokePermissionFromRoleContext(ctx context.Context, r Role, p Permission) error {
+	return a.RevokePermissionFromRole(r, p)
+}
+
+func (a authRepoAdapter) GetRoleParentsContext(ctx context.Context) ([]RoleParent, error) {
+	return a.GetRoleParents()
+}
+
+func (a authRepoAdapter) AssignParentToRoleContext(ctx context.Context, r Role, parent Role) error {
+	return a.AssignParentToRole(r, parent)
+}
+
+func (a authRepoAdapter) RevokeParentFromRoleContext(ctx context.Context, r Role, parent Role) error {
+	return a.RevokeParentFromRole(r, parent)
+}
+
+//AdaptUserAuthRepo returns repo as a UserAuthRepoContext. Repositories that do not implement the context
+//variants are wrapped so the context is ignored and the plain methods are called.
+func AdaptUserAuthRepo(repo UserAuthRepo) UserAuthRepoContext {
+	if ctxRepo, ok := repo.(UserAuthRepoContext); ok {
+		return ctxRepo
+	}
+	return userAuthRepoAdapter{repo}
+}
+
+type userAuthRepoAdapter struct {
+	UserAuthRepo
+}
+
+func (a userAuthRepoAdapter) GetUserByCredentialsContext(ctx context.Context, creds Credentials) (User, error) {
+	return a.GetUserByCredentials(creds)
+}
+
+func (a userAuthRepoAdapter) GetUserFromSessionContext(ctx context.Context, s Session) (User, error) {
+	return a.GetUserFromSession(s)
+}
+
+//AdaptSessionProvider returns sp as a SessionProviderContext. Providers that do not implement the context
+//variants are wrapped so the context is ignored and the plain methods are called.
+func AdaptSessionProvider(sp SessionProvider) SessionProviderContext {
+	if ctxProvider, ok := sp.(SessionProviderContext); ok {
+		return ctxProvider
+	}
+	return sessionProviderAdapter{sp}
+}
+
+type sessionProviderAdapter struct {
+	SessionProvider
+}
+
+func (a sessionProviderAdapter) SetSessionContext(ctx context.Context, s Session) error {
+	return a.SetSession(s)
+}
+
+func (a sessionProviderAdapter) EndSessionContext(ctx context.Context, w http.ResponseWriter, s Session) error {
+	return a.EndSession(w, s)
+}
+
+func (a sessionProviderAdapter) UpdateSessionContext(ctx context.Context, s Session) error {
+	return a.UpdateSession(s)
+}
+
+func (a sessionProviderAdapter) RegenerateSessionContext(ctx context.Context, w http.ResponseWriter, s Session) error {
+	return a.RegenerateSession(w, s)
+}
@@ -0,0 +1,191 @@
+package juno
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+//Audit event types
+const (
+	AuditRoleCreate       = "role.create"
+	AuditPermissionAdd    = "permission.add"
+	AuditPermissionAssign = "permission.assign"
+	AuditPermissionRevoke = "permission.revoke"
+	AuditLogin            = "login"
+	AuditSecondFactor     = "login.second-factor"
+	AuditSessionEnd       = "session.end"
+	//AuditUserSessionsEnd records every session of a user being ended, such as when signing out everywhere
+	AuditUserSessionsEnd = "session.end-user"
+)
+
+type (
+	//AuditEvent records who did what, and whether it succeeded
+	AuditEvent struct {
+		Time time.Time `json:"time"`
+		Type string    `json:"type"`
+		//Actor is the user performing the action, taken from the context with ActorFromContext
+		Actor        string `json:"actor,omitempty"`
+		RoleID       string `json:"roleId,omitempty"`
+		PermissionID string `json:"permissionId,omitempty"`
+		//Username is the username presented on login
+		Username string `json:"username,omitempty"`
+		//UserID is the user logged in, or the user of the ended session
+		UserID    int    `json:"userId,omitempty"`
+		SessionID string `json:"sessionId,omitempty"`
+		IPAddress string `json:"ip,omitempty"`
+		Success   bool   `json:"success"`
+		Error     string `json:"error,omitempty"`
+	}
+
+	//AuditSink is to be implemented by the persistance mechanism for audit events
+	AuditSink interface {
+		WriteAuditEvent(ctx context.Context, e AuditEvent) error
+	}
+)
+
+type actorKey struct{}
+
+//WithActor returns a context carrying the actor recorded on audit events. user.NewContext sets it to the user id,
+//so requests handled by the middleware carry their authenticated user.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+//ActorFromContext returns the actor set with WithActor, or an empty string
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+//NewAuditLog is a factory constructor for an AuditLog writing to every provided sink
+func NewAuditLog(sinks ...AuditSink) *AuditLog {
+	return &AuditLog{sinks: sinks}
+}
+
+//AuditLog records audit events to its sinks. A nil AuditLog records nothing.
+type AuditLog struct {
+	sinks []AuditSink
+}
+
+//Record writes e to every sink, setting its time and, when empty, its actor from ctx. Sink failures are logged
+//rather than returned, so an unavailable sink does not fail the audited action.
+func (l *AuditLog) Record(ctx context.Context, e AuditEvent) {
+	if l == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	if e.Actor == "" {
+		e.Actor = ActorFromContext(ctx)
+	}
+	for _, sink := range l.sinks {
+		err := sink.WriteAuditEvent(ctx, e)
+		if err != nil {
+			log.Println("Unable to write audit event:", err)
+		}
+	}
+}
+
+//result sets the outcome of the event from err
+func (e AuditEvent) result(err error) AuditEvent {
+	e.Success = err == nil
+	if err != nil {
+		e.Error = err.Error()
+	}
+	return e
+}
+
+//NewJSONLinesSink is a factory constructor for a JSONLinesSink writing to w
+func NewJSONLinesSink(w io.Writer) *JSONLinesSink {
+	return &JSONLinesSink{w: w}
+}
+
+//OpenJSONLinesFile opens, or creates, the file at path for appending audit events
+func OpenJSONLinesFile(path string) (*JSONLinesSink, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLinesSink{w: f, closer: f}, nil
+}
+
+//JSONLinesSink is an AuditSink writing each event as a line of JSON
+type JSONLinesSink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+//WriteAuditEvent writes e as a single line
+func (s *JSONLinesSink) WriteAuditEvent(ctx context.Context, e AuditEvent) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(line, '\n'))
+	return err
+}
+
+//Close closes the file opened by OpenJSONLinesFile
+func (s *JSONLinesSink) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
+//AuditSessionProvider wraps sessions so every ended session is recorded to audit. When sessions is a UserSessionStore,
+//so is the returned provider, recording the sessions ended through EndUserSession and EndUserSessions.
+func AuditSessionProvider(sessions SessionProvider, audit *AuditLog) SessionProviderContext {
+	sp := &auditSessionProvider{SessionProviderContext: AdaptSessionProvider(sessions), audit: audit}
+	if users, ok := sessions.(UserSessionStore); ok {
+		return &auditUserSessionProvider{auditSessionProvider: sp, users: users}
+	}
+	return sp
+}
+
+type auditSessionProvider struct {
+	SessionProviderContext
+	audit *AuditLog
+}
+
+func (sp *auditSessionProvider) EndSession(w http.ResponseWriter, s Session) error {
+	return sp.EndSessionContext(context.Background(), w, s)
+}
+
+func (sp *auditSessionProvider) EndSessionContext(ctx context.Context, w http.ResponseWriter, s Session) error {
+	err := sp.SessionProviderContext.EndSessionContext(ctx, w, s)
+	userID, _ := SessionUserID(s)
+	sp.audit.Record(ctx, AuditEvent{Type: AuditSessionEnd, UserID: userID, SessionID: s.SessionID()}.result(err))
+	return err
+}
+
+type auditUserSessionProvider struct {
+	*auditSessionProvider
+	users UserSessionStore
+}
+
+func (sp *auditUserSessionProvider) ListUserSessions(ctx context.Context, userID int) ([]SessionInfo, error) {
+	return sp.users.ListUserSessions(ctx, userID)
+}
+
+func (sp *auditUserSessionProvider) EndUserSession(ctx context.Context, userID int, sessionID string) error {
+	err := sp.users.EndUserSession(ctx, userID, sessionID)
+	sp.audit.Record(ctx, AuditEvent{Type: AuditSessionEnd, UserID: userID, SessionID: sessionID}.result(err))
+	return err
+}
+
+func (sp *auditUserSessionProvider) EndUserSessions(ctx context.Context, userID int, except ...string) error {
+	err := sp.users.EndUserSessions(ctx, userID, except...)
+	sp.audit.Record(ctx, AuditEvent{Type: AuditUserSessionsEnd, UserID: userID}.result(err))
+	return err
+}
@@ -0,0 +1,260 @@
+package juno
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockAuditSink struct {
+	events []AuditEvent
+}
+
+func (s *mockAuditSink) WriteAuditEvent(ctx context.Context, e AuditEvent) error {
+	s.events = append(s.events, e)
+	return nil
+}
+
+type failingAuditSink struct{}
+
+func (failingAuditSink) WriteAuditEvent(ctx context.Context, e AuditEvent) error {
+	return errors.New("Sink unavailable")
+}
+
+//mockEndSessionProvider only implements EndSession, which is all AuditSessionProvider needs in these tests
+type mockEndSessionProvider struct {
+	SessionProvider
+	err error
+}
+
+func (sp *mockEndSessionProvider) EndSession(w http.ResponseWriter, s Session) error {
+	return sp.err
+}
+
+func TestAuditAuthorizer(t *testing.T) {
+	assert := assert.New(t)
+
+	sink := new(mockAuditSink)
+	authorizer := mockAuthorizer()
+	authorizer.EnableAudit(NewAuditLog(sink))
+	ctx := WithActor(context.Background(), "42")
+
+	editor := NewStdRole("editor")
+	editor.RoleID = 10
+	_, err := authorizer.CreateRoleContext(ctx, editor)
+	assert.NoError(err)
+	assert.NoError(authorizer.AssignPermissionToRoleContext(ctx, editor, read))
+	assert.NoError(authorizer.RevokePermissionFromRoleContext(ctx, editor, read))
+	_, err = authorizer.AddPermissionContext(ctx, NewStdPermission("publish", "Allows the user to publish"))
+	assert.NoError(err)
+
+	missing := NewStdRole("missing")
+	missing.RoleID = 9999
+	assert.Error(authorizer.AssignPermissionToRole(missing, read))
+
+	if assert.Len(sink.events, 5, "Every change, including the failed one, should be recorded") {
+		assert.Equal(AuditRoleCreate, sink.events[0].Type)
+		assert.Equal("10", sink.events[0].RoleID)
+		assert.Equal(AuditPermissionAssign, sink.events[1].Type)
+		assert.Equal("4", sink.events[1].PermissionID)
+		assert.Equal(AuditPermissionRevoke, sink.events[2].Type)
+		assert.Equal(AuditPermissionAdd, sink.events[3].Type)
+		for _, e := range sink.events[:4] {
+			assert.Equal("42", e.Actor, "The actor should be taken from the context")
+			assert.True(e.Success)
+			assert.False(e.Time.IsZero(), "The time should be set when the event is recorded")
+		}
+
+		failed := sink.events[4]
+		assert.False(failed.Success)
+		assert.NotEmpty(failed.Error)
+		assert.Empty(failed.Actor, "There should be no actor without one in the context")
+	}
+}
+
+func TestAuditLogin(t *testing.T) {
+	assert := assert.New(t)
+
+	hash, _ := NewBcryptHasher(4).Hash("s3cret")
+	repo := &rehashingUserAuthRepo{user: &StdUser{UserID: 7, Email: "test@juno.com", Password: hash}}
+	authenticator := NewAuthenticator(repo, NewBcryptHasher(4))
+	sink := new(mockAuditSink)
+	authenticator.EnableAudit(NewAuditLog(sink, failingAuditSink{}))
+
+	_, err := authenticator.Authenticate(mockCredentials{"test@juno.com", "wrong"})
+	assert.Equal(ErrInvalidCredentials, err, "A failing sink should not change the outcome of a login")
+
+	req := httptest.NewRequest("POST", "/login", nil)
+	user, err := authenticator.AuthenticateRequest(req, mockCredentials{"test@juno.com", "s3cret"})
+	assert.NoError(err)
+	assert.NotNil(user)
+
+	if assert.Len(sink.events, 2) {
+		failure, success := sink.events[0], sink.events[1]
+		assert.Equal(AuditLogin, failure.Type)
+		assert.Equal("test@juno.com", failure.Username)
+		assert.False(failure.Success)
+		assert.Equal(ErrInvalidCredentials.Error(), failure.Error)
+		assert.Equal(0, failure.UserID)
+
+		assert.Equal(AuditLogin, success.Type)
+		assert.True(success.Success)
+		assert.Equal(7, success.UserID)
+		assert.Equal("192.0.2.1", success.IPAddress)
+	}
+}
+
+func TestAuditSessionProvider(t *testing.T) {
+	assert := assert.New(t)
+
+	sink := new(mockAuditSink)
+	provider := &mockEndSessionProvider{}
+	sessions := AuditSessionProvider(provider, NewAuditLog(sink))
+
+	session := NewStdSession()
+	session.Set(USER_ID_SESSION_KEY, 7)
+	assert.NoError(sessions.EndSession(httptest.NewRecorder(), session))
+
+	provider.err = errors.New("Store unavailable")
+	err := sessions.EndSessionContext(WithActor(context.Background(), "1"), httptest.NewRecorder(), NewStdSession())
+	assert.Error(err)
+
+	if assert.Len(sink.events, 2) {
+		assert.Equal(AuditSessionEnd, sink.events[0].Type)
+		assert.Equal(7, sink.events[0].UserID)
+		assert.Equal(session.SessionID(), sink.events[0].SessionID)
+		assert.True(sink.events[0].Success)
+
+		assert.Equal("1", sink.events[1].Actor)
+		assert.False(sink.events[1].Success)
+		assert.Equal("Store unavailable", sink.events[1].Error)
+	}
+}
+
+type mockUserSessionProvider struct {
+	mockEndSessionProvider
+	ended []string
+}
+
+func (sp *mockUserSessionProvider) ListUserSessions(ctx context.Context, userID int) ([]SessionInfo, error) {
+	return []SessionInfo{{SessionID: "current", UserID: userID}}, nil
+}
+
+func (sp *mockUserSessionProvider) EndUserSession(ctx context.Context, userID int, sessionID string) error {
+	sp.ended = append(sp.ended, sessionID)
+	return nil
+}
+
+func (sp *mockUserSessionProvider) EndUserSessions(ctx context.Context, userID int, except ...string) error {
+	sp.ended = append(sp.ended, "all")
+	return nil
+}
+
+func TestAuditUserSessionStore(t *testing.T) {
+	assert := assert.New(t)
+
+	sink := new(mockAuditSink)
+	_, ok := AuditSessionProvider(&mockEndSessionProvider{}, NewAuditLog(sink)).(UserSessionStore)
+	assert.False(ok, "Providers that do not index sessions by user should not be reported as a UserSessionStore")
+
+	provider := &mockUserSessionProvider{}
+	users, ok := AuditSessionProvider(provider, NewAuditLog(sink)).(UserSessionStore)
+	if !assert.True(ok, "The UserSessionStore of the provider should be reachable through the wrapper") {
+		return
+	}
+	ctx := WithActor(context.Background(), "7")
+	listed, err := users.ListUserSessions(ctx, 7)
+	assert.NoError(err)
+	assert.Len(listed, 1)
+	assert.NoError(users.EndUserSession(ctx, 7, "other"))
+	assert.NoError(users.EndUserSessions(ctx, 7, "current"))
+	assert.Equal([]string{"other", "all"}, provider.ended)
+
+	if assert.Len(sink.events, 2, "Listing sessions should not be recorded") {
+		assert.Equal(AuditSessionEnd, sink.events[0].Type)
+		assert.Equal("other", sink.events[0].SessionID)
+		assert.Equal(AuditUserSessionsEnd, sink.events[1].Type)
+		assert.Equal(7, sink.events[1].UserID)
+		assert.Equal("7", sink.events[1].Actor)
+	}
+}
+
+func TestAuditSecondFactor(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	hash, _ := NewBcryptHasher(4).Hash("s3cret")
+	repo := &rehashingUserAuthRepo{user: &StdUser{UserID: 7, Email: "test@juno.com", Password: hash}}
+	secret, _ := GenerateTOTPSecret()
+	totp := NewTOTP("Juno")
+	authenticator := NewAuthenticator(repo, NewBcryptHasher(4))
+	authenticator.EnableSecondFactor(&mockSecondFactorRepo{secret: secret}, totp)
+	authenticator.EnableLockout(newMockAttemptStore(), LockoutOptions{})
+	sink := new(mockAuditSink)
+	authenticator.EnableAudit(NewAuditLog(sink))
+
+	session := NewStdSession()
+	authenticator.BeginLoginFrom(ctx, session, mockCredentials{"test@juno.com", "s3cret"}, "")
+	_, err := authenticator.CompleteLogin(ctx, session, "000000")
+	assert.Equal(ErrInvalidCode, err)
+	code, _ := totp.Code(secret, time.Now())
+	_, err = authenticator.CompleteLogin(ctx, session, code)
+	assert.NoError(err)
+
+	if assert.Len(sink.events, 3, "The password and every code should be recorded") {
+		assert.Equal(AuditLogin, sink.events[0].Type)
+		failure, success := sink.events[1], sink.events[2]
+		assert.Equal(AuditSecondFactor, failure.Type)
+		assert.Equal(7, failure.UserID)
+		assert.Equal("test@juno.com", failure.Username)
+		assert.False(failure.Success)
+		assert.Equal(ErrInvalidCode.Error(), failure.Error)
+		assert.Equal(AuditSecondFactor, success.Type)
+		assert.True(success.Success)
+	}
+}
+
+func TestJSONLinesSink(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	audit := NewAuditLog(NewJSONLinesSink(&buf))
+	audit.Record(context.Background(), AuditEvent{Type: AuditLogin, Username: "test@juno.com", Success: true})
+	audit.Record(context.Background(), AuditEvent{Type: AuditSessionEnd, UserID: 7, Success: true})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if assert.Len(lines, 2, "Every event should be written on its own line") {
+		var e AuditEvent
+		assert.NoError(json.Unmarshal([]byte(lines[0]), &e))
+		assert.Equal(AuditLogin, e.Type)
+		assert.Equal("test@juno.com", e.Username)
+		assert.NotContains(lines[0], "userId", "Empty fields should be omitted")
+	}
+
+	var nilLog *AuditLog
+	nilLog.Record(context.Background(), AuditEvent{Type: AuditLogin})
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := OpenJSONLinesFile(path)
+	assert.NoError(err)
+	assert.NoError(sink.WriteAuditEvent(context.Background(), AuditEvent{Type: AuditLogin}))
+	assert.NoError(sink.Close())
+	sink, err = OpenJSONLinesFile(path)
+	assert.NoError(err)
+	assert.NoError(sink.WriteAuditEvent(context.Background(), AuditEvent{Type: AuditLogin}))
+	assert.NoError(sink.Close())
+
+	contents, err := ioutil.ReadFile(path)
+	assert.NoError(err)
+	assert.Equal(2, strings.Count(string(contents), "\n"), "Reopening the file should append to it")
+}
@@ -1,17 +1,41 @@
 package juno
 
-import "golang.org/x/crypto/bcrypt"
-
-import "errors"
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
 
 type (
 
-	//UserAuthRepo is the interface that is intended to be implemented by a data access struct methods
+	//UserAuthRepo is the interface that is intended to be implemented by a data access struct methods.
+	//GetUserFromSession returns ErrNotAuthenticated for a session without a user, and ErrUserNotFound when its user no longer exists.
 	UserAuthRepo interface {
 		GetUserByCredentials(Credentials) (User, error)
 		GetUserFromSession(Session) (User, error)
 	}
 
+	//UserAuthRepoContext is a UserAuthRepo that also accepts a context, so cancellation and deadlines reach the data store
+	UserAuthRepoContext interface {
+		UserAuthRepo
+		GetUserByCredentialsContext(context.Context, Credentials) (User, error)
+		GetUserFromSessionContext(context.Context, Session) (User, error)
+	}
+
+	//PasswordRehasher is optionally implemented by a UserAuthRepo to store a new password hash. The Authenticator calls it
+	//after a successful login when the stored hash was produced by an outdated algorithm or with outdated parameters.
+	PasswordRehasher interface {
+		UpdatePasswordHash(ctx context.Context, user User, hash string) error
+	}
+
+	//UserByIDRepo is optionally implemented by a UserAuthRepo to load a user by id for bearer and refresh tokens.
+	//Without it the user is loaded through GetUserFromSession with a session that only carries the user id.
+	UserByIDRepo interface {
+		GetUserByID(ctx context.Context, userID int) (User, error)
+	}
+
 	//The Credentials interface exposes getters for password and username
 	Credentials interface {
 		GetUsername() string
@@ -22,43 +46,149 @@ type (
 var (
 	//ErrInvalidCredentials to be returned for invalid credentials
 	ErrInvalidCredentials = errors.New("The provided credentials are not valid.")
+	//ErrUserNotFound is to be returned, or wrapped, by a UserAuthRepo when no user has the provided username or id.
+	//The Authenticator reports it as ErrInvalidCredentials, so unknown usernames cannot be told apart from wrong passwords.
+	ErrUserNotFound = errors.New("The user does not exist.")
+	//ErrNotAuthenticated is to be returned, or wrapped, by a UserAuthRepo when the session has no authenticated user
+	ErrNotAuthenticated = errors.New("Session is not authenticated")
+	//ErrAccountLocked is returned when too many failed login attempts were made for a username or client ip
+	ErrAccountLocked = errors.New("Too many failed login attempts, please try again later.")
 )
 
-//NewAuthenticator returns an pointer to an authenticar, taking an implemented UserRepo as it only argument
-func NewAuthenticator(repo UserAuthRepo) *Authenticator {
+//NewAuthenticator returns an pointer to an authenticar, taking an implemented UserRepo as it only argument.
+//The first of the optional hashers is used to hash new passwords, and all of them are accepted when verifying passwords.
+//Passwords are hashed with bcrypt at bcrypt.DefaultCost when no hasher is provided.
+//Hashes produced by the built in bcrypt, argon2id and scrypt hashers are always accepted, so stored passwords can be migrated.
+func NewAuthenticator(repo UserAuthRepo, hashers ...PasswordHasher) *Authenticator {
+	if len(hashers) == 0 {
+		hashers = []PasswordHasher{NewBcryptHasher(0)}
+	}
+	//the built in hashers are added to a copy, so the caller's slice is never written to
+	accepted := make([]PasswordHasher, 0, len(hashers)+3)
+	accepted = append(accepted, hashers...)
+	rehasher, _ := repo.(PasswordRehasher)
+	byID, _ := repo.(UserByIDRepo)
 	return &Authenticator{
-		repo: repo,
+		repo:     AdaptUserAuthRepo(repo),
+		rehasher: rehasher,
+		byID:     byID,
+		hasher:   hashers[0],
+		hashers:  append(accepted, NewBcryptHasher(0), NewArgon2idHasher(), NewScryptHasher()),
 	}
 }
 
 //The Authenticator is used to login in users, encrypt passwords, and validate users are authenticated
 type Authenticator struct {
-	repo UserAuthRepo
+	repo     UserAuthRepoContext
+	rehasher PasswordRehasher
+	byID     UserByIDRepo
+	hasher   PasswordHasher
+	hashers  []PasswordHasher
+
+	//mu guards the features enabled after construction, so the Enable methods can be called at any time
+	mu       sync.RWMutex
+	attempts AttemptStore
+	lockout  LockoutOptions
+
+	secondFactor SecondFactorRepo
+	totp         *TOTP
+
+	tokenOpts TokenOptions
+	tokenKeys []TokenKey
+
+	refreshTokens RefreshTokenStore
+	refreshTTL    time.Duration
+
+	audit *AuditLog
+}
+
+//EnableAudit records every login attempt to audit
+func (a *Authenticator) EnableAudit(audit *AuditLog) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.audit = audit
+}
+
+func (a *Authenticator) auditLog() *AuditLog {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.audit
 }
 
-//EncryptPassword uses bcrypt to encrypt a provided password in a way that ensures decryption using respective Authenticate method works as expected
+//EncryptPassword hashes a provided password with the Authenticator's PasswordHasher in a way that ensures verification using respective Authenticate method works as expected
 func (a *Authenticator) EncryptPassword(password string) (string, error) {
-	encPass, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	hash, err := a.hasher.Hash(password)
 	if err != nil {
 		return "", ErrInvalidCredentials
 	}
-	return string(encPass), nil
+	return hash, nil
+}
+
+//NeedsRehash reports whether a stored password hash should be replaced with one from EncryptPassword
+func (a *Authenticator) NeedsRehash(hash string) bool {
+	return a.hasher.NeedsRehash(hash)
 }
 
 //Authenticate takes the provided credentials and authenticates the a user, returning the full user on success, error on failure
 func (a *Authenticator) Authenticate(creds Credentials) (User, error) {
-	user, err := a.repo.GetUserByCredentials(creds)
+	return a.AuthenticateContext(context.Background(), creds)
+}
+
+//AuthenticateContext is the same as Authenticate, passing ctx through to the UserAuthRepo.
+//If the repo implements PasswordRehasher and the stored hash is outdated, the password is rehashed after a successful login.
+//Failed attempts are tracked by username when lockout is enabled.
+func (a *Authenticator) AuthenticateContext(ctx context.Context, creds Credentials) (User, error) {
+	return a.AuthenticateFrom(ctx, creds, "")
+}
+
+func (a *Authenticator) authenticate(ctx context.Context, creds Credentials) (User, error) {
+	user, err := a.repo.GetUserByCredentialsContext(ctx, creds)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, ErrInvalidCredentials
+	}
 	if err != nil {
 		return nil, err
 	}
-	err = bcrypt.CompareHashAndPassword([]byte(user.GetPassword()), []byte(creds.GetPassword()))
-	if err != nil {
+	hash := user.GetPassword()
+	if !a.verify(creds.GetPassword(), hash) {
 		return nil, ErrInvalidCredentials
 	}
+	if a.NeedsRehash(hash) {
+		a.rehash(ctx, user, creds.GetPassword())
+	}
 	return user, nil
 }
 
+func (a *Authenticator) verify(password, hash string) bool {
+	for _, hasher := range a.hashers {
+		if hasher.Identifies(hash) {
+			ok, err := hasher.Verify(password, hash)
+			return err == nil && ok
+		}
+	}
+	return false
+}
+
+//rehash stores a new hash through the repo. Failures are logged rather than returned, as the login itself succeeded.
+func (a *Authenticator) rehash(ctx context.Context, user User, password string) {
+	if a.rehasher == nil {
+		return
+	}
+	hash, err := a.hasher.Hash(password)
+	if err == nil {
+		err = a.rehasher.UpdatePasswordHash(ctx, user, hash)
+	}
+	if err != nil {
+		log.Printf("Unable to rehash password for user %d: %v", user.ID(), err)
+	}
+}
+
 //IsAuthenticatedSession takes an a current session, and return the user if the session is authenticated, otherwise return an error
 func (a *Authenticator) IsAuthenticatedSession(s Session) (User, error) {
-	return a.repo.GetUserFromSession(s)
+	return a.IsAuthenticatedSessionContext(context.Background(), s)
+}
+
+//IsAuthenticatedSessionContext is the same as IsAuthenticatedSession, passing ctx through to the UserAuthRepo
+func (a *Authenticator) IsAuthenticatedSessionContext(ctx context.Context, s Session) (User, error) {
+	return a.repo.GetUserFromSessionContext(ctx, s)
 }
@@ -1,9 +1,9 @@
 package juno
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
-	"strings"
 	"sync"
 )
 
@@ -20,31 +20,96 @@ type AuthRepo interface {
 	GetRolePermissions() ([]RolePermission, error)
 	AssignPermissionToRole(Role, Permission) error
 	RevokePermissionFromRole(Role, Permission) error
+
+	GetRoleParents() ([]RoleParent, error)
+	AssignParentToRole(role Role, parent Role) error
+	RevokeParentFromRole(role Role, parent Role) error
+}
+
+//AuthRepoContext is an AuthRepo that also accepts a context, so cancellation and deadlines reach the data store
+type AuthRepoContext interface {
+	AuthRepo
+
+	GetPermissionsContext(context.Context) ([]Permission, error)
+	GetPermissionContext(context.Context, Permission) (Permission, error)
+	CreatePermissionContext(context.Context, Permission) (Permission, error)
+
+	GetRolesContext(context.Context) ([]Role, error)
+	GetRoleContext(context.Context, Role) (Role, error)
+	CreateRoleContext(context.Context, Role) (Role, error)
+
+	GetRolePermissionsContext(context.Context) ([]RolePermission, error)
+	AssignPermissionToRoleContext(context.Context, Role, Permission) error
+	RevokePermissionFromRoleContext(context.Context, Role, Permission) error
+
+	GetRoleParentsContext(context.Context) ([]RoleParent, error)
+	AssignParentToRoleContext(ctx context.Context, role Role, parent Role) error
+	RevokeParentFromRoleContext(ctx context.Context, role Role, parent Role) error
 }
 
 //Authorizer is the struct (with intended use as a singleton) for handling all things authorization
 type Authorizer struct {
 	sync.RWMutex
-	repo        AuthRepo
+	repo        AuthRepoContext
 	roles       Roles
 	permissions Permissions
+	parents     map[string]map[string]bool
+	conditions  map[string][]Condition
+	policies    *PolicySet
 	superadmin  Role
+	audit       *AuditLog
+}
+
+//EnableAudit records role and permission changes to audit
+func (mngr *Authorizer) EnableAudit(audit *AuditLog) {
+	mngr.Lock()
+	defer mngr.Unlock()
+	mngr.audit = audit
+}
+
+func (mngr *Authorizer) auditLog() *AuditLog {
+	mngr.RLock()
+	defer mngr.RUnlock()
+	return mngr.audit
+}
+
+//NewAuthorizer is a factory constructor for getting a properly instantiated Authorizer.
+//An optional RetryOptions retries loading the cache from the AuthRepo, so services can wait for a database to come up.
+func NewAuthorizer(repo AuthRepo, retry ...RetryOptions) (*Authorizer, error) {
+	return NewAuthorizerContext(context.Background(), repo, retry...)
 }
 
-//NewAuthorizer is a factory constructor for getting a properly instantiated Authorizer
-func NewAuthorizer(repo AuthRepo) *Authorizer {
+//NewAuthorizerContext is the same as NewAuthorizer, passing ctx through to the AuthRepo while loading the cache
+func NewAuthorizerContext(ctx context.Context, repo AuthRepo, retry ...RetryOptions) (*Authorizer, error) {
 	//set up an instance of Authorizer
 	mngr := &Authorizer{
-		repo:        repo,
-		roles:       make(Roles),
-		permissions: make(Permissions),
+		repo: AdaptAuthRepo(repo),
 	}
 
+	var opts RetryOptions
+	if len(retry) > 0 {
+		opts = retry[0]
+	}
+
+	err := Retry(ctx, opts, func() error {
+		return mngr.load(ctx)
+	})
+	if err != nil {
+		return nil, &StartError{Component: "Authorizer", Err: err}
+	}
+	return mngr, nil
+}
+
+//load fills the permission and role cache from the AuthRepo
+func (mngr *Authorizer) load(ctx context.Context) error {
+	mngr.roles = make(Roles)
+	mngr.permissions = make(Permissions)
+	mngr.parents = make(map[string]map[string]bool)
+
 	//get permissions in the DB
-	perms, err := repo.GetPermissions()
+	perms, err := mngr.repo.GetPermissionsContext(ctx)
 	if err != nil {
-		log.Fatal(err)
-		return nil
+		return err
 	}
 
 	//assign permissions to the cache
@@ -53,10 +118,9 @@ func NewAuthorizer(repo AuthRepo) *Authorizer {
 	}
 
 	//get roles
-	roles, err := repo.GetRoles()
+	roles, err := mngr.repo.GetRolesContext(ctx)
 	if err != nil {
-		log.Fatal(err)
-		return nil
+		return err
 	}
 
 	//assign roles to cache
@@ -65,20 +129,31 @@ func NewAuthorizer(repo AuthRepo) *Authorizer {
 	}
 
 	//get role/permission relationships
-	rolePerms, err := repo.GetRolePermissions()
+	rolePerms, err := mngr.repo.GetRolePermissionsContext(ctx)
 	if err != nil {
-		log.Fatal(err)
-		return nil
+		return err
 	}
 
 	//registers role assignments in the cache
 	for _, rp := range rolePerms {
-		if perm, ok := mngr.permissions[rp.PermissionID()]; ok {
-			mngr.roles[rp.RoleID()].Assign(perm)
+		role, hasRole := mngr.roles[rp.RoleID()]
+		if perm, ok := mngr.permissions[rp.PermissionID()]; ok && hasRole {
+			role.Assign(perm)
 		}
 	}
 
-	return mngr
+	//get role hierarchy
+	parents, err := mngr.repo.GetRoleParentsContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	//registers parent roles in the cache
+	for _, rp := range parents {
+		mngr.addParent(rp.RoleID(), rp.ParentID())
+	}
+
+	return nil
 }
 
 func (mngr *Authorizer) hasPermission(p Permission) bool {
@@ -91,55 +166,208 @@ func (mngr *Authorizer) hasRole(r UserRole) bool {
 	return exists
 }
 
-//Granted verifies if a role specified by role name is currently granted a permission
+func (mngr *Authorizer) addParent(roleID, parentID string) {
+	if mngr.parents[roleID] == nil {
+		mngr.parents[roleID] = make(map[string]bool)
+	}
+	mngr.parents[roleID][parentID] = true
+}
+
+//lineage returns roleID followed by the ids of every role it inherits from, visiting each role once
+func (mngr *Authorizer) lineage(roleID string) []string {
+	visited := map[string]bool{roleID: true}
+	results := []string{roleID}
+	for i := 0; i < len(results); i++ {
+		for parentID := range mngr.parents[results[i]] {
+			if !visited[parentID] {
+				visited[parentID] = true
+				results = append(results, parentID)
+			}
+		}
+	}
+	return results
+}
+
+//inherits reports whether the role with roleID is, or descends from, the role with ancestorID
+func (mngr *Authorizer) inherits(roleID, ancestorID string) bool {
+	for _, id := range mngr.lineage(roleID) {
+		if id == ancestorID {
+			return true
+		}
+	}
+	return false
+}
+
+//Granted verifies if a role specified by role name is currently granted a permission, either directly or through one of its ancestor roles
 func (mngr *Authorizer) Granted(role UserRole, p Permission) bool {
 	mngr.Lock()
 	defer mngr.Unlock()
-	if role, exists := mngr.roles[role.ID()]; exists {
-		return role.Has(p)
+	return mngr.granted(role, p)
+}
+
+func (mngr *Authorizer) granted(role UserRole, p Permission) bool {
+	return mngr.explain([]UserRole{role}, p).Allowed
+}
+
+//GrantedAny verifies if at least one of the provided permissions is granted to at least one of the provided roles
+func (mngr *Authorizer) GrantedAny(roles []UserRole, perms ...Permission) bool {
+	mngr.Lock()
+	defer mngr.Unlock()
+	for _, p := range perms {
+		if mngr.grantedToAny(roles, p) {
+			return true
+		}
 	}
 	return false
 }
 
+//GrantedAll verifies if every one of the provided permissions is granted to at least one of the provided roles
+func (mngr *Authorizer) GrantedAll(roles []UserRole, perms ...Permission) bool {
+	mngr.Lock()
+	defer mngr.Unlock()
+	if len(roles) == 0 {
+		return false
+	}
+	for _, p := range perms {
+		if !mngr.grantedToAny(roles, p) {
+			return false
+		}
+	}
+	return true
+}
+
+func (mngr *Authorizer) grantedToAny(roles []UserRole, p Permission) bool {
+	return mngr.explain(roles, p).Allowed
+}
+
+//Parents returns the roles that role directly inherits permissions from
+func (mngr *Authorizer) Parents(role UserRole) []Role {
+	mngr.RLock()
+	defer mngr.RUnlock()
+	results := []Role{}
+	for parentID := range mngr.parents[role.ID()] {
+		if parent, exists := mngr.roles[parentID]; exists {
+			results = append(results, parent)
+		}
+	}
+	return results
+}
+
+//AssignParentToRole makes role inherit every permission granted to parent. Assignments that would create a cycle return ErrRoleCycle.
+func (mngr *Authorizer) AssignParentToRole(role Role, parent Role) error {
+	return mngr.AssignParentToRoleContext(context.Background(), role, parent)
+}
+
+//AssignParentToRoleContext is the same as AssignParentToRole, passing ctx through to the AuthRepo
+func (mngr *Authorizer) AssignParentToRoleContext(ctx context.Context, role Role, parent Role) error {
+	mngr.Lock()
+	defer mngr.Unlock()
+	if !mngr.hasRole(role) {
+		return fmt.Errorf("RoleID with ID '%s' does not exist", role.ID())
+	}
+	if !mngr.hasRole(parent) {
+		return fmt.Errorf("RoleID with ID '%s' does not exist", parent.ID())
+	}
+	if mngr.inherits(parent.ID(), role.ID()) {
+		return ErrRoleCycle
+	}
+	err := mngr.repo.AssignParentToRoleContext(ctx, role, parent)
+	if err != nil {
+		return err
+	}
+	mngr.addParent(role.ID(), parent.ID())
+	return nil
+}
+
+//RevokeParentFromRole stops role inheriting the permissions granted to parent
+func (mngr *Authorizer) RevokeParentFromRole(role Role, parent Role) error {
+	return mngr.RevokeParentFromRoleContext(context.Background(), role, parent)
+}
+
+//RevokeParentFromRoleContext is the same as RevokeParentFromRole, passing ctx through to the AuthRepo
+func (mngr *Authorizer) RevokeParentFromRoleContext(ctx context.Context, role Role, parent Role) error {
+	mngr.Lock()
+	defer mngr.Unlock()
+	if !mngr.parents[role.ID()][parent.ID()] {
+		return fmt.Errorf("RoleID with ID '%s' does not inherit from '%s'", role.ID(), parent.ID())
+	}
+	err := mngr.repo.RevokeParentFromRoleContext(ctx, role, parent)
+	if err != nil {
+		return err
+	}
+	delete(mngr.parents[role.ID()], parent.ID())
+	return nil
+}
+
 //GetPermissions returns all permissions
 func (mngr *Authorizer) GetPermissions() ([]Permission, error) {
-	return mngr.repo.GetPermissions()
+	return mngr.GetPermissionsContext(context.Background())
+}
+
+//GetPermissionsContext is the same as GetPermissions, passing ctx through to the AuthRepo
+func (mngr *Authorizer) GetPermissionsContext(ctx context.Context) ([]Permission, error) {
+	return mngr.repo.GetPermissionsContext(ctx)
 }
 
 //GetRoles returns all roles
 func (mngr *Authorizer) GetRoles() ([]Role, error) {
-	return mngr.repo.GetRoles()
+	return mngr.GetRolesContext(context.Background())
 }
 
-//AddPermission adds a permission the auth mngr
-func (mngr *Authorizer) AddPermission(p Permission) Permission {
+//GetRolesContext is the same as GetRoles, passing ctx through to the AuthRepo
+func (mngr *Authorizer) GetRolesContext(ctx context.Context) ([]Role, error) {
+	return mngr.repo.GetRolesContext(ctx)
+}
+
+//AddPermission adds a permission the auth mngr. Adding a permission that already exists in the AuthRepo returns the stored permission.
+func (mngr *Authorizer) AddPermission(p Permission) (Permission, error) {
+	return mngr.AddPermissionContext(context.Background(), p)
+}
+
+//AddPermissionContext is the same as AddPermission, passing ctx through to the AuthRepo
+func (mngr *Authorizer) AddPermissionContext(ctx context.Context, p Permission) (Permission, error) {
+	newPerm, err := mngr.addPermission(ctx, p)
+	mngr.auditLog().Record(ctx, AuditEvent{Type: AuditPermissionAdd, PermissionID: p.ID()}.result(err))
+	return newPerm, err
+}
+
+func (mngr *Authorizer) addPermission(ctx context.Context, p Permission) (Permission, error) {
 	mngr.Lock()
 	defer mngr.Unlock()
-	newPerm, err := mngr.repo.CreatePermission(p)
+	newPerm, err := mngr.repo.CreatePermissionContext(ctx, p)
 	if err != nil {
-		//check for duplicate error and ignore if that's what sql server returns
-		if !strings.Contains(strings.ToLower(err.Error()), "cannot insert duplicate key") {
-			log.Fatalf("Unable to create permission: %s\n%s", p.ID(), err.Error())
-			return nil
+		if !errors.Is(err, ErrDuplicatePermission) {
+			return nil, &PermissionError{PermissionID: p.ID(), Err: err}
 		}
-		newPerm, err = mngr.repo.GetPermission(p)
+		newPerm, err = mngr.repo.GetPermissionContext(ctx, p)
 		if err != nil {
-			log.Fatal("A fatal error occurred setting up permissions:", err.Error())
-			return nil
+			return nil, &PermissionError{PermissionID: p.ID(), Err: err}
 		}
 	}
 	if mngr.superadmin != nil {
 		mngr.roles[mngr.superadmin.ID()].Assign(newPerm)
 	}
 	mngr.permissions[p.ID()] = newPerm
-	return newPerm
+	return newPerm, nil
 }
 
+//CreateRole persists a new role and adds it to the cache
 func (mngr *Authorizer) CreateRole(r Role) (Role, error) {
+	return mngr.CreateRoleContext(context.Background(), r)
+}
+
+//CreateRoleContext is the same as CreateRole, passing ctx through to the AuthRepo
+func (mngr *Authorizer) CreateRoleContext(ctx context.Context, r Role) (Role, error) {
+	newrole, err := mngr.createRole(ctx, r)
+	mngr.auditLog().Record(ctx, AuditEvent{Type: AuditRoleCreate, RoleID: r.ID()}.result(err))
+	return newrole, err
+}
+
+func (mngr *Authorizer) createRole(ctx context.Context, r Role) (Role, error) {
 	mngr.Lock()
 	defer mngr.Unlock()
 	if _, exists := mngr.roles[r.ID()]; !exists {
-		newrole, err := mngr.repo.CreateRole(r)
+		newrole, err := mngr.repo.CreateRoleContext(ctx, r)
 		if err != nil {
 			return nil, err
 		}
@@ -159,10 +387,21 @@ func (mngr *Authorizer) assignSuperAdmin(admin Role) {
 
 //RevokePermissionFromRole removes roles grant to a permission
 func (mngr *Authorizer) RevokePermissionFromRole(role Role, perm Permission) error {
+	return mngr.RevokePermissionFromRoleContext(context.Background(), role, perm)
+}
+
+//RevokePermissionFromRoleContext is the same as RevokePermissionFromRole, passing ctx through to the AuthRepo
+func (mngr *Authorizer) RevokePermissionFromRoleContext(ctx context.Context, role Role, perm Permission) error {
+	err := mngr.revokePermissionFromRole(ctx, role, perm)
+	mngr.auditLog().Record(ctx, AuditEvent{Type: AuditPermissionRevoke, RoleID: role.ID(), PermissionID: perm.ID()}.result(err))
+	return err
+}
+
+func (mngr *Authorizer) revokePermissionFromRole(ctx context.Context, role Role, perm Permission) error {
 	mngr.Lock()
 	defer mngr.Unlock()
 	if role, exists := mngr.roles[role.ID()]; exists {
-		err := mngr.repo.RevokePermissionFromRole(role, perm)
+		err := mngr.repo.RevokePermissionFromRoleContext(ctx, role, perm)
 		if err != nil {
 			return err
 		}
@@ -173,12 +412,17 @@ func (mngr *Authorizer) RevokePermissionFromRole(role Role, perm Permission) err
 
 //CreateSuperAdmin is a method on Authorizor to create a Role that is granted all permissions
 func (mngr *Authorizer) CreateSuperAdmin(r Role) error {
-	superAdmin, _ := mngr.repo.GetRole(r)
+	return mngr.CreateSuperAdminContext(context.Background(), r)
+}
+
+//CreateSuperAdminContext is the same as CreateSuperAdmin, passing ctx through to the AuthRepo
+func (mngr *Authorizer) CreateSuperAdminContext(ctx context.Context, r Role) error {
+	superAdmin, _ := mngr.repo.GetRoleContext(ctx, r)
 	if superAdmin != nil {
 		mngr.assignSuperAdmin(superAdmin)
 		return nil
 	}
-	superAdmin, err := mngr.CreateRole(r)
+	superAdmin, err := mngr.CreateRoleContext(ctx, r)
 	if err != nil {
 		return err
 	}
@@ -188,10 +432,21 @@ func (mngr *Authorizer) CreateSuperAdmin(r Role) error {
 
 //AssignPermissionToRole takes a role and grants access to the provided permission
 func (mngr *Authorizer) AssignPermissionToRole(role Role, perm Permission) error {
+	return mngr.AssignPermissionToRoleContext(context.Background(), role, perm)
+}
+
+//AssignPermissionToRoleContext is the same as AssignPermissionToRole, passing ctx through to the AuthRepo
+func (mngr *Authorizer) AssignPermissionToRoleContext(ctx context.Context, role Role, perm Permission) error {
+	err := mngr.assignPermissionToRole(ctx, role, perm)
+	mngr.auditLog().Record(ctx, AuditEvent{Type: AuditPermissionAssign, RoleID: role.ID(), PermissionID: perm.ID()}.result(err))
+	return err
+}
+
+func (mngr *Authorizer) assignPermissionToRole(ctx context.Context, role Role, perm Permission) error {
 	if !mngr.hasRole(role) {
 		return fmt.Errorf("RoleID with ID '%s' does not exist", role.ID())
 	}
-	err := mngr.repo.AssignPermissionToRole(role, perm)
+	err := mngr.repo.AssignPermissionToRoleContext(ctx, role, perm)
 	if err != nil {
 		return err
 	}
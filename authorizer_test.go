@@ -1,8 +1,10 @@
 package juno
 
 import (
+	"errors"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -110,9 +112,63 @@ func (repo *MockAuthRepo) GetPermission(p Permission) (Permission, error) {
 	return NewStdPermission("Test", "A description for the test permission"), nil
 }
 
+//MockRoleParent is an implementation of RoleParent used to expose a mock role hierarchy to Authorizer
+type MockRoleParent struct {
+	RID       int
+	ParentRID int
+}
+
+func (rp *MockRoleParent) RoleID() string {
+	return strconv.Itoa(rp.RID)
+}
+
+func (rp *MockRoleParent) ParentID() string {
+	return strconv.Itoa(rp.ParentRID)
+}
+
+func (repo *MockAuthRepo) GetRoleParents() ([]RoleParent, error) {
+	//sales inherits from blogger
+	return []RoleParent{&MockRoleParent{RID: 4, ParentRID: 2}}, nil
+}
+
+func (repo *MockAuthRepo) AssignParentToRole(r Role, parent Role) error {
+	return nil
+}
+
+func (repo *MockAuthRepo) RevokeParentFromRole(r Role, parent Role) error {
+	return nil
+}
+
 func mockAuthorizer() *Authorizer {
 	repo := new(MockAuthRepo)
-	return NewAuthorizer(repo)
+	authorizer, err := NewAuthorizer(repo)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return authorizer
+}
+
+//UnavailableAuthRepo fails to load permissions until it has been called a number of times
+type UnavailableAuthRepo struct {
+	MockAuthRepo
+	failures int
+}
+
+func (repo *UnavailableAuthRepo) GetPermissions() ([]Permission, error) {
+	if repo.failures > 0 {
+		repo.failures--
+		return nil, errors.New("The database is unavailable")
+	}
+	return repo.MockAuthRepo.GetPermissions()
+}
+
+//DuplicateAuthRepo reports every created permission as a duplicate
+type DuplicateAuthRepo struct {
+	MockAuthRepo
+}
+
+func (repo *DuplicateAuthRepo) CreatePermission(p Permission) (Permission, error) {
+	return nil, ErrDuplicatePermission
 }
 
 func TestNewAuthorizer(t *testing.T) {
@@ -140,7 +196,8 @@ func TestCreateSuperAdmin(t *testing.T) {
 	assert.True(authorizer.Granted(superadmin, canDelete), "Super admin should be granted permission to canDelete")
 	assert.True(authorizer.Granted(superadmin, read), "Super admin should be granted permission to read")
 
-	fun := authorizer.AddPermission(NewStdPermission("fun", "Allows user to have fun"))
+	fun, err := authorizer.AddPermission(NewStdPermission("fun", "Allows user to have fun"))
+	assert.NoError(err)
 	assert.True(authorizer.Granted(superadmin, fun), "Super admin should be granted permissions if they are added after the role is created")
 }
 
@@ -162,9 +219,30 @@ func TestAddPermission(t *testing.T) {
 	assert := assert.New(t)
 
 	authorizer := mockAuthorizer()
-	doStuff := authorizer.AddPermission(NewStdPermission("Do Stuff", "Allows the user to do stuff"))
+	doStuff, err := authorizer.AddPermission(NewStdPermission("Do Stuff", "Allows the user to do stuff"))
+	assert.NoError(err)
 	assert.NotNil(doStuff, "Do stuff should be successfully created")
 	assert.True(authorizer.hasPermission(doStuff), "Instance of authorizer should have have the doStuff permission")
+
+	authorizer, err = NewAuthorizer(new(DuplicateAuthRepo))
+	assert.NoError(err)
+	existing, err := authorizer.AddPermission(NewStdPermission("Test", "A description for the test permission"))
+	assert.NoError(err, "Adding a permission that already exists should return the stored permission")
+	assert.NotNil(existing)
+}
+
+func TestNewAuthorizerErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	authorizer, err := NewAuthorizer(&UnavailableAuthRepo{failures: 1})
+	assert.Nil(authorizer)
+	assert.Error(err, "An unavailable repository should return an error instead of exiting")
+	_, isStartError := err.(*StartError)
+	assert.True(isStartError, "The error should be a StartError")
+
+	authorizer, err = NewAuthorizer(&UnavailableAuthRepo{failures: 2}, RetryOptions{Attempts: 3, Delay: time.Millisecond})
+	assert.NoError(err, "Retrying should wait for the repository to become available")
+	assert.NotNil(authorizer)
 }
 
 func TestAssignPermissionToRole(t *testing.T) {
@@ -176,3 +254,45 @@ func TestAssignPermissionToRole(t *testing.T) {
 	assert.True(authorizer.Granted(blogger, canDelete), "Blogger should have canDelete permissions after being assigned")
 
 }
+
+func TestRoleHierarchy(t *testing.T) {
+	assert := assert.New(t)
+
+	authorizer := mockAuthorizer()
+	err := authorizer.AssignPermissionToRole(blogger, create)
+	assert.Nil(err)
+	assert.True(authorizer.Granted(sales, create), "Sales should inherit permissions granted to blogger from the stored hierarchy")
+
+	err = authorizer.AssignParentToRole(manager, sales)
+	assert.Nil(err, "Assigning a parent role should work without error")
+	assert.True(authorizer.Granted(manager, create), "Manager should inherit permissions through every ancestor role")
+	assert.False(authorizer.Granted(manager, update), "Manager should not be granted permissions no ancestor has")
+
+	err = authorizer.AssignParentToRole(blogger, manager)
+	assert.Equal(ErrRoleCycle, err, "Assignments that create a cycle should be rejected")
+	err = authorizer.AssignParentToRole(blogger, blogger)
+	assert.Equal(ErrRoleCycle, err, "A role should not be able to inherit from itself")
+
+	err = authorizer.RevokeParentFromRole(manager, sales)
+	assert.Nil(err, "Revoking an assigned parent role should work without error")
+	assert.False(authorizer.Granted(manager, create), "Manager should no longer inherit permissions after the parent is revoked")
+}
+
+func TestGrantedAnyAll(t *testing.T) {
+	assert := assert.New(t)
+
+	authorizer := mockAuthorizer()
+	user := &StdUser{UserID: 1}
+	user.StdUserRole = admin.StdUserRole
+	user.AssignedRoles = []StdUserRole{manager.StdUserRole}
+	err := authorizer.AssignPermissionToRole(manager, read)
+	assert.Nil(err)
+
+	roles := RolesOf(user)
+	assert.Equal(2, len(roles), "RolesOf should expose every role assigned to a StdUser")
+	assert.True(authorizer.GrantedAll(roles, update, read), "Permissions granted across different roles should all be granted")
+	assert.False(authorizer.GrantedAll(roles, update, create), "GrantedAll should fail if any permission is missing from every role")
+	assert.True(authorizer.GrantedAny(roles, create, read), "GrantedAny should pass if any permission is granted to any role")
+	assert.False(authorizer.GrantedAny(roles, create, canDelete), "GrantedAny should fail if no permission is granted to any role")
+	assert.False(authorizer.GrantedAll(nil, read), "A user without roles should never be granted permissions")
+}
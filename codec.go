@@ -0,0 +1,181 @@
+package juno
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+//SessionCodec is to be implemented by the encoding a SessionProvider uses to persist a session store. Decoding must
+//return the values with the types they were set with, so type assertions keep working after a reload.
+type SessionCodec interface {
+	Encode(store map[string]interface{}) ([]byte, error)
+	Decode(data []byte) (map[string]interface{}, error)
+}
+
+//sessionTypesKey holds the type tags of a JSONCodec document
+const sessionTypesKey = "$types"
+
+var sessionTypes = struct {
+	sync.RWMutex
+	byName map[string]reflect.Type
+	byType map[reflect.Type]string
+}{
+	byName: make(map[string]reflect.Type),
+	byType: make(map[reflect.Type]string),
+}
+
+func init() {
+	builtin := map[string]interface{}{
+		"int":      int(0),
+		"int8":     int8(0),
+		"int16":    int16(0),
+		"int32":    int32(0),
+		"int64":    int64(0),
+		"uint":     uint(0),
+		"uint8":    uint8(0),
+		"uint16":   uint16(0),
+		"uint32":   uint32(0),
+		"uint64":   uint64(0),
+		"float32":  float32(0),
+		"time":     time.Time{},
+		"duration": time.Duration(0),
+		"[]string": []string{},
+		"[]int":    []int{},
+	}
+	for name, value := range builtin {
+		if err := RegisterSessionType(name, value); err != nil {
+			panic(err)
+		}
+	}
+}
+
+//RegisterSessionType registers the type of value under name, so session values of that type are decoded with their type
+//by the JSONCodec and can be encoded by the GobCodec. It is to be called during initialization, and returns an error when
+//value is nil or name is already registered for a different type.
+func RegisterSessionType(name string, value interface{}) error {
+	t := reflect.TypeOf(value)
+	if t == nil {
+		return fmt.Errorf("Session type %s cannot be registered for a nil value", name)
+	}
+	sessionTypes.Lock()
+	defer sessionTypes.Unlock()
+	if existing, ok := sessionTypes.byName[name]; ok && existing != t {
+		return fmt.Errorf("Session type %s is already registered for %v", name, existing)
+	}
+	sessionTypes.byName[name] = t
+	sessionTypes.byType[t] = name
+	gob.Register(value)
+	return nil
+}
+
+//JSONCodec encodes a session store as a JSON object, with a type tag for each value of a registered type, so an int set on
+//the session is decoded as an int rather than a float64. Values of unregistered types are stored without a tag and decoded
+//as plain JSON, as are stores written before type tags were added. The key "$types" is reserved, Encode returns an error
+//for a store that uses it.
+type JSONCodec struct{}
+
+//Encode marshals store to JSON, recording the registered type of each value
+func (JSONCodec) Encode(store map[string]interface{}) ([]byte, error) {
+	if _, ok := store[sessionTypesKey]; ok {
+		return nil, fmt.Errorf("The session key %s is reserved by the JSONCodec", sessionTypesKey)
+	}
+	doc := make(map[string]interface{}, len(store)+1)
+	types := make(map[string]string)
+	sessionTypes.RLock()
+	for key, val := range store {
+		doc[key] = val
+		if name, ok := sessionTypes.byType[reflect.TypeOf(val)]; ok {
+			types[key] = name
+		}
+	}
+	sessionTypes.RUnlock()
+	if len(types) > 0 {
+		doc[sessionTypesKey] = types
+	}
+	return json.Marshal(doc)
+}
+
+//Decode unmarshals a store encoded by Encode, restoring the registered type of each tagged value
+func (JSONCodec) Decode(data []byte) (map[string]interface{}, error) {
+	var raw map[string]json.RawMessage
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, err
+	}
+	var types map[string]string
+	if tags, ok := raw[sessionTypesKey]; ok {
+		err = json.Unmarshal(tags, &types)
+		if err != nil {
+			return nil, err
+		}
+		delete(raw, sessionTypesKey)
+	}
+
+	store := make(map[string]interface{}, len(raw))
+	for key, val := range raw {
+		t, ok := sessionType(types[key])
+		if !ok {
+			var plain interface{}
+			err = json.Unmarshal(val, &plain)
+			if err != nil {
+				return nil, err
+			}
+			store[key] = plain
+			continue
+		}
+		typed := reflect.New(t)
+		err = json.Unmarshal(val, typed.Interface())
+		if err != nil {
+			return nil, fmt.Errorf("Session value %s is not a valid %s: %v", key, types[key], err)
+		}
+		store[key] = typed.Elem().Interface()
+	}
+	return store, nil
+}
+
+func sessionType(name string) (reflect.Type, bool) {
+	if name == "" {
+		return nil, false
+	}
+	sessionTypes.RLock()
+	defer sessionTypes.RUnlock()
+	t, ok := sessionTypes.byName[name]
+	return t, ok
+}
+
+//GobCodec encodes a session store with encoding/gob, base64 encoded so it can be kept in a text column.
+//Values of types other than the gob basic types must be registered with RegisterSessionType or gob.Register.
+type GobCodec struct{}
+
+//Encode gob encodes store
+func (GobCodec) Encode(store map[string]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(store)
+	if err != nil {
+		return nil, err
+	}
+	encoded := make([]byte, base64.StdEncoding.EncodedLen(buf.Len()))
+	base64.StdEncoding.Encode(encoded, buf.Bytes())
+	return encoded, nil
+}
+
+//Decode gob decodes a store encoded by Encode
+func (GobCodec) Decode(data []byte) (map[string]interface{}, error) {
+	decoded := make([]byte, base64.StdEncoding.DecodedLen(len(data)))
+	n, err := base64.StdEncoding.Decode(decoded, data)
+	if err != nil {
+		return nil, err
+	}
+	var store map[string]interface{}
+	err = gob.NewDecoder(bytes.NewReader(decoded[:n])).Decode(&store)
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
@@ -0,0 +1,166 @@
+package juno
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type codecTestPreferences struct {
+	Theme    string
+	PageSize int
+}
+
+func init() {
+	if err := RegisterSessionType("codecTestPreferences", codecTestPreferences{}); err != nil {
+		panic(err)
+	}
+}
+
+func codecTestStore() map[string]interface{} {
+	return map[string]interface{}{
+		USER_ID_SESSION_KEY: 120,
+		"since":             int64(1500000000),
+		"name":              "test",
+		"admin":             true,
+		"ratio":             0.5,
+		"login":             time.Date(2026, 10, 18, 12, 30, 0, 0, time.UTC),
+		"scopes":            []string{"read", "write"},
+		"preferences":       codecTestPreferences{Theme: "dark", PageSize: 50},
+	}
+}
+
+func TestSessionCodecsPreserveTypes(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, codec := range []SessionCodec{JSONCodec{}, GobCodec{}} {
+		encoded, err := codec.Encode(codecTestStore())
+		assert.NoError(err, "%T should encode the store", codec)
+		decoded, err := codec.Decode(encoded)
+		assert.NoError(err, "%T should decode the store", codec)
+
+		for key, val := range codecTestStore() {
+			assert.IsType(val, decoded[key], "%T should preserve the type of %s", codec, key)
+			assert.Equal(val, decoded[key], "%T should preserve the value of %s", codec, key)
+		}
+	}
+}
+
+func TestJSONCodecUntypedValues(t *testing.T) {
+	assert := assert.New(t)
+
+	decoded, err := JSONCodec{}.Decode([]byte(`{"userid":120,"name":"test"}`))
+	assert.NoError(err, "Stores written before type tags should still decode")
+	assert.Equal(120.0, decoded[USER_ID_SESSION_KEY], "Untagged numbers should decode as plain JSON")
+
+	session := NewStdSession()
+	session.ReplaceStore(decoded)
+	userID, ok := GetInt(session, USER_ID_SESSION_KEY)
+	assert.True(ok, "GetInt should accept whole numbers decoded from plain JSON")
+	assert.Equal(120, userID)
+
+	encoded, err := JSONCodec{}.Encode(map[string]interface{}{"nested": map[string]interface{}{"a": "b"}})
+	assert.NoError(err, "Values of unregistered types should be encoded without a tag")
+	assert.Equal(`{"nested":{"a":"b"}}`, string(encoded))
+}
+
+func TestTypedSessionGetters(t *testing.T) {
+	assert := assert.New(t)
+
+	session := NewStdSession()
+	session.ReplaceStore(codecTestStore())
+	session.Set("fraction", 1.5)
+	session.Set("legacyLogin", "2026-10-18T12:30:00Z")
+
+	userID, ok := GetInt(session, USER_ID_SESSION_KEY)
+	assert.True(ok)
+	assert.Equal(120, userID)
+	since, ok := GetInt64(session, "since")
+	assert.True(ok)
+	assert.Equal(int64(1500000000), since)
+	_, ok = GetInt(session, "fraction")
+	assert.False(ok, "A fractional number is not an int")
+	ratio, ok := GetFloat64(session, "ratio")
+	assert.True(ok)
+	assert.Equal(0.5, ratio)
+	name, ok := GetString(session, "name")
+	assert.True(ok)
+	assert.Equal("test", name)
+	_, ok = GetString(session, USER_ID_SESSION_KEY)
+	assert.False(ok, "An int is not a string")
+	admin, ok := GetBool(session, "admin")
+	assert.True(ok)
+	assert.True(admin)
+	login, ok := GetTime(session, "login")
+	assert.True(ok)
+	assert.Equal(2026, login.Year())
+	legacy, ok := GetTime(session, "legacyLogin")
+	assert.True(ok, "GetTime should parse RFC 3339 strings")
+	assert.True(login.Equal(legacy))
+	_, ok = GetInt(session, "missing")
+	assert.False(ok, "A missing key should not be found")
+}
+
+func TestTypedSessionGetterConversions(t *testing.T) {
+	assert := assert.New(t)
+
+	session := NewStdSession()
+	session.Set("int32", int32(-3))
+	session.Set("uint", uint(4))
+	session.Set("uint64", uint64(5))
+	session.Set("float32", float32(6))
+	session.Set("huge", uint64(math.MaxUint64))
+	session.Set("large", float64(math.MaxInt64))
+
+	for key, expected := range map[string]int64{"int32": -3, "uint": 4, "uint64": 5, "float32": 6} {
+		n, ok := GetInt64(session, key)
+		assert.True(ok, "GetInt64 should accept a %s", key)
+		assert.Equal(expected, n)
+		f, ok := GetFloat64(session, key)
+		assert.True(ok, "GetFloat64 should accept a %s", key)
+		assert.Equal(float64(expected), f)
+	}
+	_, ok := GetInt64(session, "huge")
+	assert.False(ok, "An unsigned value that does not fit an int64 is not an int64")
+	_, ok = GetInt64(session, "large")
+	assert.False(ok, "A float that does not fit an int64 is not an int64")
+	f, ok := GetFloat64(session, "huge")
+	assert.True(ok)
+	assert.Equal(float64(math.MaxUint64), f)
+}
+
+func TestJSONCodecReservedKey(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := JSONCodec{}.Encode(map[string]interface{}{sessionTypesKey: "mine"})
+	assert.Error(err, "A store using the reserved types key should not be encoded")
+}
+
+func TestRegisterSessionTypeConflict(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(RegisterSessionType("codecTestPreferences", codecTestPreferences{}), "Registering the same type again should be allowed")
+	assert.Error(RegisterSessionType("codecTestPreferences", struct{ Other int }{}), "Registering a name for another type should be rejected")
+	assert.Error(RegisterSessionType("codecTestNil", nil), "Registering a nil value should be rejected rather than panic")
+	_, registered := sessionType("codecTestNil")
+	assert.False(registered, "A rejected type should not be registered")
+}
+
+func TestJSONCodecSmallIntegers(t *testing.T) {
+	assert := assert.New(t)
+
+	store := map[string]interface{}{
+		"int8":   int8(-8),
+		"int16":  int16(-16),
+		"uint8":  uint8(8),
+		"uint16": uint16(16),
+		"uint32": uint32(32),
+	}
+	encoded, err := JSONCodec{}.Encode(store)
+	assert.NoError(err)
+	decoded, err := JSONCodec{}.Decode(encoded)
+	assert.NoError(err)
+	assert.Equal(store, decoded, "Small integer kinds should keep their types through the JSONCodec")
+}
@@ -1,41 +1,117 @@
 package juno
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"reflect"
+	"strconv"
+	"time"
 
 	"github.com/gorilla/securecookie"
 	"github.com/satori/go.uuid"
 )
 
 const (
-	sessionID = "sessionID"
+	sessionID  = "sessionID"
+	expiration = "exp"
+
+	//HostPrefix is prepended to the cookie name when CookieOptions.HostPrefix is set
+	HostPrefix = "__Host-"
 )
 
+//CookieOptions configure the attributes of the session cookie
+type CookieOptions struct {
+	//Path defaults to "/"
+	Path   string
+	Domain string
+	//Secure restricts the cookie to https
+	Secure   bool
+	SameSite http.SameSite
+	//ScriptAccess omits the HttpOnly attribute, letting client side scripts read the cookie. It should rarely be set.
+	ScriptAccess bool
+	//HostPrefix prefixes the cookie name with __Host-, so browsers only accept the cookie when it is Secure, has the path "/"
+	//and has no domain, which prevents subdomains from setting it
+	HostPrefix bool
+}
+
+//Apply returns name with the HostPrefix applied and opts with their defaults, for providers that write their own cookies.
+//An error is returned when the options are not accepted by browsers.
+func (opts CookieOptions) Apply(name string) (string, CookieOptions, error) {
+	if opts.Path == "" {
+		opts.Path = "/"
+	}
+	if opts.HostPrefix {
+		if !opts.Secure || opts.Path != "/" || opts.Domain != "" {
+			return "", opts, errors.New("A __Host- cookie must be Secure, with the path / and no domain")
+		}
+		name = HostPrefix + name
+	}
+	if opts.SameSite == http.SameSiteNoneMode && !opts.Secure {
+		return "", opts, errors.New("A SameSite=None cookie must be Secure")
+	}
+	return name, opts, nil
+}
+
+//NewCookie returns a cookie with the attributes of opts, which must match for the browser to replace or remove it
+func (opts CookieOptions) NewCookie(name, value string) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     opts.Path,
+		Domain:   opts.Domain,
+		Secure:   opts.Secure,
+		SameSite: opts.SameSite,
+		HttpOnly: !opts.ScriptAccess,
+	}
+}
+
 //NewStdCookieProvider is a factory constructor for returning a standard cookie provider
 func NewStdCookieProvider(hashKey, blockKey []byte, cookieName string) *StdCookieProvider {
 	return &StdCookieProvider{
-		secure: securecookie.New(hashKey, blockKey),
+		codecs: securecookie.CodecsFromPairs(hashKey, blockKey),
 		name:   cookieName,
+		opts:   CookieOptions{Path: "/"},
+	}
+}
+
+//NewStdCookieProviderOptions is the same as NewStdCookieProvider, with the cookie attributes set by opts. The key pairs are
+//hash and block keys as with securecookie.CodecsFromPairs. Cookies are written with the first pair and read with any pair,
+//so keys can be rotated by prepending a new pair and dropping the old one once its cookies have expired.
+//An error is returned when no keys are provided or the options are not accepted by browsers.
+func NewStdCookieProviderOptions(cookieName string, opts CookieOptions, keyPairs ...[]byte) (*StdCookieProvider, error) {
+	if len(keyPairs) == 0 {
+		return nil, errors.New("At least one cookie key is required")
+	}
+	cookieName, opts, err := opts.Apply(cookieName)
+	if err != nil {
+		return nil, err
 	}
+	return &StdCookieProvider{
+		codecs: securecookie.CodecsFromPairs(keyPairs...),
+		name:   cookieName,
+		opts:   opts,
+	}, nil
 }
 
 //StdCookieProvider implements the juno.Cookie provider interface, and
 //is to be used in the context of a juno.SessionProvider to augment
 //persistance operations in the provider with cookie handling
 type StdCookieProvider struct {
-	secure *securecookie.SecureCookie
+	codecs []securecookie.Codec
 	name   string
+	opts   CookieOptions
 }
 
+//Read decodes the session id from the request cookie. The expiration is taken from the signed cookie value, as browsers
+//do not send the cookie's Expires attribute back. ErrSessionExpired is returned for expired cookies.
 func (c *StdCookieProvider) Read(req *http.Request) (Session, error) {
 	cookie, err := req.Cookie(c.name)
 	if err != nil {
 		return nil, err
 	}
 	value := make(map[string]string)
-	err = c.secure.Decode(c.name, cookie.Value, &value)
+	err = securecookie.DecodeMulti(c.name, cookie.Value, &value, c.codecs...)
 	if err != nil {
 		return nil, err
 	}
@@ -50,7 +126,17 @@ func (c *StdCookieProvider) Read(req *http.Request) (Session, error) {
 
 	session := new(StdSession)
 	session.ID = guid
-	session.Expiration = cookie.Expires
+	//cookies written before the expiration was signed have none; their provider enforces expiration from its store
+	if exp, hasExp := value[expiration]; hasExp {
+		unix, err := strconv.ParseInt(exp, 10, 64)
+		if err != nil {
+			return nil, ErrInvalidSessionID
+		}
+		session.Expiration = time.Unix(unix, 0)
+		if session.Expired() {
+			return nil, ErrSessionExpired
+		}
+	}
 	return session, nil
 }
 
@@ -61,30 +147,27 @@ func (c *StdCookieProvider) Set(w http.ResponseWriter, s Session) error {
 		return fmt.Errorf("Expecting juno.StdSession, but got %s", reflect.TypeOf(s))
 	}
 	value := map[string]string{
-		sessionID: s.SessionID(),
+		sessionID:  s.SessionID(),
+		expiration: strconv.FormatInt(stdSession.Expiration.Unix(), 10),
 	}
-	encoded, err := c.secure.Encode(c.name, value)
+	encoded, err := c.codecs[0].Encode(c.name, value)
 	if err != nil {
 		return err
 	}
-	cookie := &http.Cookie{
-		Name:     c.name,
-		Value:    encoded,
-		Path:     "/",
-		HttpOnly: true,
-		Expires:  stdSession.Expiration,
-	}
+	cookie := c.cookie(encoded)
+	cookie.Expires = stdSession.Expiration
 	http.SetCookie(w, cookie)
 	return nil
 }
 
 //Invalidate cookie by setting mage age -1
 func (c *StdCookieProvider) Invalidate(w http.ResponseWriter) {
-	cookie := &http.Cookie{
-		Name:     c.name,
-		Path:     "/",
-		HttpOnly: true,
-		MaxAge:   -1,
-	}
+	cookie := c.cookie("")
+	cookie.MaxAge = -1
 	http.SetCookie(w, cookie)
 }
+
+//cookie returns a session cookie with the configured attributes
+func (c *StdCookieProvider) cookie(value string) *http.Cookie {
+	return c.opts.NewCookie(c.name, value)
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"reflect"
 
@@ -19,7 +20,7 @@ func TestNewStdCookieProvider(t *testing.T) {
 	name := "test-cookie"
 	cookieProvider := NewStdCookieProvider(hashKey, blockKey, name)
 	assert.Equal(name, cookieProvider.name, "The NewStdCookieProvider factory constructor sets a the cookie name properly")
-	cookieType := reflect.TypeOf(cookieProvider.secure).String()
+	cookieType := reflect.TypeOf(cookieProvider.codecs[0]).String()
 	assert.Equal(cookieType, "*securecookie.SecureCookie", "Cookie provider should use an implementation of the secure cookie package for encoding and decoding cookie values")
 }
 
@@ -40,7 +41,7 @@ func TestCookieProviderSetRead(t *testing.T) {
 	cookie, err := request.Cookie(cookieName)
 	assert.NoError(err, "Cookie should contain encrypted cookie set by the provider")
 	value := make(map[string]string)
-	err = cookieProvider.secure.Decode(cookieName, cookie.Value, &value)
+	err = cookieProvider.codecs[0].Decode(cookieName, cookie.Value, &value)
 	assert.NoError(err, "Cookie provider should properly decrypt cookie value")
 	assert.Equal(session.SessionID(), value[sessionID])
 
@@ -48,3 +49,98 @@ func TestCookieProviderSetRead(t *testing.T) {
 	readSession, err := cookieProvider.Read(request)
 	assert.Equal(session.SessionID(), readSession.SessionID(), "Session read from the request should match the session id from the intial set session")
 }
+
+func TestCookieProviderReadExpiration(t *testing.T) {
+	assert := assert.New(t)
+
+	cookieName := "test-cookie"
+	cookieProvider := NewStdCookieProvider(hashKey, blockKey, cookieName)
+
+	session := NewStdSession()
+	recorder := httptest.NewRecorder()
+	cookieProvider.Set(recorder, session)
+	request := &http.Request{Header: http.Header{"Cookie": recorder.HeaderMap["Set-Cookie"]}}
+	readSession, err := cookieProvider.Read(request)
+	assert.NoError(err)
+	assert.Equal(session.Expiration.Unix(), readSession.(*StdSession).Expiration.Unix(), "The expiration should be read from the signed cookie value")
+
+	expired := NewStdSession(-time.Minute)
+	recorder = httptest.NewRecorder()
+	cookieProvider.Set(recorder, expired)
+	request = &http.Request{Header: http.Header{"Cookie": recorder.HeaderMap["Set-Cookie"]}}
+	_, err = cookieProvider.Read(request)
+	assert.Equal(ErrSessionExpired, err, "Expired cookies should be rejected even when the browser sends them")
+}
+
+func TestCookieProviderOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewStdCookieProviderOptions("test-cookie", CookieOptions{HostPrefix: true}, hashKey, blockKey)
+	assert.Error(err, "A __Host- cookie without Secure should be rejected")
+	_, err = NewStdCookieProviderOptions("test-cookie", CookieOptions{HostPrefix: true, Secure: true, Domain: "example.com"}, hashKey, blockKey)
+	assert.Error(err, "A __Host- cookie with a domain should be rejected")
+	_, err = NewStdCookieProviderOptions("test-cookie", CookieOptions{SameSite: http.SameSiteNoneMode}, hashKey, blockKey)
+	assert.Error(err, "A SameSite=None cookie without Secure should be rejected")
+	_, err = NewStdCookieProviderOptions("test-cookie", CookieOptions{})
+	assert.Error(err, "At least one key pair should be required")
+
+	cookieProvider, err := NewStdCookieProviderOptions("test-cookie", CookieOptions{
+		Secure:     true,
+		SameSite:   http.SameSiteStrictMode,
+		HostPrefix: true,
+	}, hashKey, blockKey)
+	assert.NoError(err)
+
+	recorder := httptest.NewRecorder()
+	session := NewStdSession()
+	assert.NoError(cookieProvider.Set(recorder, session))
+	response := http.Response{Header: recorder.Header()}
+	cookies := response.Cookies()
+	assert.Equal(1, len(cookies))
+	assert.Equal("__Host-test-cookie", cookies[0].Name, "The cookie name should carry the __Host- prefix")
+	assert.Equal("/", cookies[0].Path, "The path should default to /")
+	assert.True(cookies[0].Secure, "The cookie should be Secure")
+	assert.True(cookies[0].HttpOnly, "The cookie should be HttpOnly unless script access is allowed")
+	assert.Equal(http.SameSiteStrictMode, cookies[0].SameSite, "The SameSite attribute should be set")
+
+	request := &http.Request{Header: http.Header{"Cookie": recorder.HeaderMap["Set-Cookie"]}}
+	readSession, err := cookieProvider.Read(request)
+	assert.NoError(err)
+	assert.Equal(session.SessionID(), readSession.SessionID(), "The prefixed cookie should be read back")
+
+	recorder = httptest.NewRecorder()
+	cookieProvider.Invalidate(recorder)
+	response = http.Response{Header: recorder.Header()}
+	cookies = response.Cookies()
+	assert.True(cookies[0].Secure, "The invalidating cookie should keep the attributes, so browsers accept it")
+	assert.Equal(-1, cookies[0].MaxAge)
+}
+
+func TestCookieProviderKeyRotation(t *testing.T) {
+	assert := assert.New(t)
+
+	oldProvider := NewStdCookieProvider(hashKey, blockKey, "test-cookie")
+	recorder := httptest.NewRecorder()
+	session := NewStdSession()
+	oldProvider.Set(recorder, session)
+	request := &http.Request{Header: http.Header{"Cookie": recorder.HeaderMap["Set-Cookie"]}}
+
+	newHashKey, newBlockKey := securecookie.GenerateRandomKey(32), securecookie.GenerateRandomKey(32)
+	rotated, err := NewStdCookieProviderOptions("test-cookie", CookieOptions{}, newHashKey, newBlockKey, hashKey, blockKey)
+	assert.NoError(err)
+	readSession, err := rotated.Read(request)
+	assert.NoError(err, "Cookies written with an older key pair should still be read")
+	assert.Equal(session.SessionID(), readSession.SessionID())
+
+	recorder = httptest.NewRecorder()
+	rotated.Set(recorder, session)
+	request = &http.Request{Header: http.Header{"Cookie": recorder.HeaderMap["Set-Cookie"]}}
+	_, err = oldProvider.Read(request)
+	assert.Error(err, "Cookies should be written with the first key pair")
+
+	dropped, err := NewStdCookieProviderOptions("test-cookie", CookieOptions{}, newHashKey, newBlockKey)
+	assert.NoError(err)
+	readSession, err = dropped.Read(request)
+	assert.NoError(err, "Cookies written with the new key pair should be read once the old pair is dropped")
+	assert.Equal(session.SessionID(), readSession.SessionID())
+}
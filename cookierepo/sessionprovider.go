@@ -0,0 +1,240 @@
+package cookierepo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/satori/go.uuid"
+
+	"github.com/syllabix/juno"
+)
+
+const (
+	//ChunkSize is the largest encoded value written to a single cookie, leaving room for the name and attributes within the 4096 byte browser limit
+	ChunkSize = 3800
+	//MaxChunks is the number of cookies a session may be split across
+	MaxChunks = 5
+)
+
+var (
+	//ErrSessionTooLarge is returned when an encoded session does not fit in MaxChunks cookies
+	ErrSessionTooLarge = errors.New("Session is too large to be stored in cookies")
+)
+
+//NewSessionProvider is a factory constructor used to create a useful instance of SessionProvider.
+//The hash and block keys are used as with securecookie.New.
+func NewSessionProvider(hashKey, blockKey []byte, cookieName string, duration ...time.Duration) *SessionProvider {
+	sp, _ := NewSessionProviderOptions(hashKey, blockKey, cookieName, juno.CookieOptions{}, duration...)
+	return sp
+}
+
+//NewSessionProviderOptions is the same as NewSessionProvider, with the attributes of every session cookie set by opts.
+//An error is returned when the options are not accepted by browsers.
+func NewSessionProviderOptions(hashKey, blockKey []byte, cookieName string, opts juno.CookieOptions, duration ...time.Duration) (*SessionProvider, error) {
+	cookieName, opts, err := opts.Apply(cookieName)
+	if err != nil {
+		return nil, err
+	}
+
+	var dur time.Duration
+	if len(duration) < 1 {
+		dur = time.Minute * 30
+	} else {
+		dur = duration[0]
+	}
+
+	secure := securecookie.New(hashKey, blockKey).
+		SetSerializer(securecookie.JSONEncoder{}).
+		MaxLength(0).
+		MaxAge(int(dur / time.Second))
+
+	return &SessionProvider{
+		secure:   secure,
+		name:     cookieName,
+		opts:     opts,
+		duration: dur,
+	}, nil
+}
+
+//SessionProvider is a stateless implementation of juno.SessionProvider that keeps the whole session, including its store,
+//in signed and encrypted cookies, encoded with juno.JSONCodec so values keep their types. The expiration is enforced
+//from the signed payload. Large sessions are split across up to MaxChunks cookies. As there is no server side state,
+//sessions cannot be ended before they expire, only removed from the browser, and changes are only kept when
+//WriteCookie is called before the response is written.
+type SessionProvider struct {
+	secure   *securecookie.SecureCookie
+	name     string
+	opts     juno.CookieOptions
+	duration time.Duration
+
+	mu       sync.RWMutex
+	absolute time.Duration
+}
+
+//SetAbsoluteTimeout limits how long a session lasts after it was started, however active it is.
+//The duration passed to the constructor remains the idle timeout.
+func (sp *SessionProvider) SetAbsoluteTimeout(absolute time.Duration) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	sp.absolute = absolute
+}
+
+func (sp *SessionProvider) absoluteTimeout() time.Duration {
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
+	return sp.absolute
+}
+
+type payload struct {
+	ID         string          `json:"id"`
+	Created    int64           `json:"created"`
+	Expiration int64           `json:"exp"`
+	Store      json.RawMessage `json:"store"`
+}
+
+//GetSession decodes the session from the request cookies. A new session is returned when they are missing, invalid or expired,
+//including sessions past the absolute timeout.
+func (sp *SessionProvider) GetSession(req *http.Request) (juno.Session, error) {
+	session, err := sp.read(req)
+	if err != nil {
+		return juno.NewStdSession(sp.duration), nil
+	}
+	return session, nil
+}
+
+func (sp *SessionProvider) read(req *http.Request) (*juno.StdSession, error) {
+	first, err := req.Cookie(sp.name)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(first.Value, ".", 2)
+	if len(parts) != 2 {
+		return nil, juno.ErrNoSessionID
+	}
+	count, err := strconv.Atoi(parts[0])
+	if err != nil || count < 1 || count > MaxChunks {
+		return nil, juno.ErrNoSessionID
+	}
+
+	encoded := parts[1]
+	for i := 1; i < count; i++ {
+		chunk, err := req.Cookie(sp.chunkName(i))
+		if err != nil {
+			return nil, err
+		}
+		encoded += chunk.Value
+	}
+
+	var p payload
+	err = sp.secure.Decode(sp.name, encoded, &p)
+	if err != nil {
+		return nil, err
+	}
+	id, err := uuid.FromString(p.ID)
+	if err != nil {
+		return nil, juno.ErrInvalidSessionID
+	}
+
+	session := new(juno.StdSession)
+	session.ID = id
+	session.Created = time.Unix(p.Created, 0)
+	session.Expiration = time.Unix(p.Expiration, 0)
+	if session.Expired() || session.AbsoluteExpired(sp.absoluteTimeout()) {
+		return nil, juno.ErrSessionExpired
+	}
+	if len(p.Store) > 0 {
+		store, err := juno.JSONCodec{}.Decode(p.Store)
+		if err != nil {
+			return nil, err
+		}
+		session.ReplaceStore(store)
+	}
+	return session, nil
+}
+
+//SetSession is a no-op, as the session is only stored by WriteCookie
+func (sp *SessionProvider) SetSession(s juno.Session) error {
+	return nil
+}
+
+//UpdateSession is a no-op, as the session is only stored by WriteCookie
+func (sp *SessionProvider) UpdateSession(s juno.Session) error {
+	return nil
+}
+
+//RegenerateSession gives the session a new id and rewrites the cookies. Cookies holding the old id remain valid until
+//they expire, as there is no server side state to remove them from.
+func (sp *SessionProvider) RegenerateSession(w http.ResponseWriter, s juno.Session) error {
+	session, err := juno.AsStdSession(s)
+	if err != nil {
+		return err
+	}
+	session.ID = uuid.NewV4()
+	return sp.WriteCookie(w, session)
+}
+
+//EndSession removes every session cookie from the browser
+func (sp *SessionProvider) EndSession(w http.ResponseWriter, s juno.Session) error {
+	for i := 0; i < MaxChunks; i++ {
+		cookie := sp.opts.NewCookie(sp.chunkName(i), "")
+		cookie.MaxAge = -1
+		http.SetCookie(w, cookie)
+	}
+	return nil
+}
+
+//WriteCookie encodes the session, with its expiration extended by the provider duration, into the response cookies.
+//The expiration is never extended past the absolute timeout.
+func (sp *SessionProvider) WriteCookie(w http.ResponseWriter, s juno.Session) error {
+	created := time.Now()
+	if session, err := juno.AsStdSession(s); err == nil && !session.Created.IsZero() {
+		created = session.Created
+	}
+	exp := juno.SessionExpiration(time.Now(), created, sp.duration, sp.absoluteTimeout())
+	store, err := juno.JSONCodec{}.Encode(s.Store())
+	if err != nil {
+		return err
+	}
+	encoded, err := sp.secure.Encode(sp.name, payload{
+		ID:         s.SessionID(),
+		Created:    created.Unix(),
+		Expiration: exp.Unix(),
+		Store:      store,
+	})
+	if err != nil {
+		return err
+	}
+
+	var chunks []string
+	for len(encoded) > ChunkSize {
+		chunks = append(chunks, encoded[:ChunkSize])
+		encoded = encoded[ChunkSize:]
+	}
+	chunks = append(chunks, encoded)
+	if len(chunks) > MaxChunks {
+		return ErrSessionTooLarge
+	}
+	//the first cookie records how many chunks to read back, so stale chunks from a larger session are ignored
+	chunks[0] = fmt.Sprintf("%d.%s", len(chunks), chunks[0])
+
+	for i, chunk := range chunks {
+		cookie := sp.opts.NewCookie(sp.chunkName(i), chunk)
+		cookie.Expires = exp
+		http.SetCookie(w, cookie)
+	}
+	return nil
+}
+
+func (sp *SessionProvider) chunkName(i int) string {
+	if i == 0 {
+		return sp.name
+	}
+	return fmt.Sprintf("%s.%d", sp.name, i)
+}
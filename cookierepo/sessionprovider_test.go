@@ -0,0 +1,142 @@
+package cookierepo
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/syllabix/juno"
+)
+
+var (
+	hashKey  = securecookie.GenerateRandomKey(32)
+	blockKey = securecookie.GenerateRandomKey(32)
+)
+
+func requestWithCookie(sp *SessionProvider, s juno.Session) *http.Request {
+	recorder := httptest.NewRecorder()
+	sp.WriteCookie(recorder, s)
+	return &http.Request{Header: http.Header{"Cookie": recorder.HeaderMap["Set-Cookie"]}}
+}
+
+func TestSessionProviderRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	sp := NewSessionProvider(hashKey, blockKey, "test-session")
+	session, err := sp.GetSession(&http.Request{})
+	assert.NoError(err, "A request without a cookie should get a brand new session")
+	session.Set(juno.USER_ID_SESSION_KEY, 120)
+
+	loaded, err := sp.GetSession(requestWithCookie(sp, session))
+	assert.NoError(err)
+	assert.Equal(session.SessionID(), loaded.SessionID(), "The session should be decoded from the cookie")
+	userID, found := loaded.Get(juno.USER_ID_SESSION_KEY)
+	assert.True(found, "The session store should be kept in the cookie")
+	assert.Equal(120, userID, "Store values should keep their types through the cookie")
+
+	other := NewSessionProvider(securecookie.GenerateRandomKey(32), securecookie.GenerateRandomKey(32), "test-session")
+	forged, _ := other.GetSession(requestWithCookie(other, session))
+	loaded, _ = sp.GetSession(requestWithCookie(other, forged))
+	assert.NotEqual(session.SessionID(), loaded.SessionID(), "Cookies signed with other keys should be ignored")
+}
+
+func TestSessionProviderExpiration(t *testing.T) {
+	assert := assert.New(t)
+
+	sp := NewSessionProvider(hashKey, blockKey, "test-session", time.Second)
+	session := juno.NewStdSession()
+	req := requestWithCookie(sp, session)
+
+	_, err := sp.read(req)
+	assert.NoError(err)
+
+	time.Sleep(1100 * time.Millisecond)
+	_, err = sp.read(req)
+	assert.Error(err, "The expiration should be enforced from the signed payload")
+}
+
+func TestSessionProviderAbsoluteTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	sp := NewSessionProvider(hashKey, blockKey, "test-session", time.Hour)
+	sp.SetAbsoluteTimeout(time.Hour)
+
+	session := juno.NewStdSession()
+	session.Created = time.Now().Add(-50 * time.Minute)
+	loaded, err := sp.read(requestWithCookie(sp, session))
+	assert.NoError(err, "A session within the absolute timeout should be read back")
+	assert.Equal(session.Created.Unix(), loaded.Created.Unix(), "The start time should be kept in the signed payload")
+	assert.Equal(session.Created.Add(time.Hour).Unix(), loaded.Expiration.Unix(), "The expiration should not be extended past the absolute timeout")
+
+	session.Created = time.Now().Add(-2 * time.Hour)
+	req := requestWithCookie(NewSessionProvider(hashKey, blockKey, "test-session", time.Hour), session)
+	_, err = sp.read(req)
+	assert.Error(err, "A session past the absolute timeout should be rejected")
+}
+
+func TestSessionProviderChunking(t *testing.T) {
+	assert := assert.New(t)
+
+	sp := NewSessionProvider(hashKey, blockKey, "test-session")
+	session := juno.NewStdSession()
+	large := make([]byte, 3000)
+	rand.Read(large)
+	session.Set("large", hex.EncodeToString(large))
+
+	recorder := httptest.NewRecorder()
+	assert.NoError(sp.WriteCookie(recorder, session))
+	cookies := recorder.HeaderMap["Set-Cookie"]
+	assert.True(len(cookies) > 1, "Sessions larger than ChunkSize should be split across cookies")
+
+	req := &http.Request{Header: http.Header{"Cookie": cookies}}
+	loaded, err := sp.read(req)
+	assert.NoError(err)
+	value, _ := loaded.Get("large")
+	assert.Equal(hex.EncodeToString(large), value, "The chunks should be joined back together")
+
+	huge := make([]byte, ChunkSize*MaxChunks)
+	session.Set("large", hex.EncodeToString(huge))
+	assert.Equal(ErrSessionTooLarge, sp.WriteCookie(httptest.NewRecorder(), session))
+}
+
+func TestSessionProviderCookieOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewSessionProviderOptions(hashKey, blockKey, "test-session", juno.CookieOptions{HostPrefix: true})
+	assert.Error(err, "A __Host- cookie that is not Secure should be rejected")
+
+	sp, err := NewSessionProviderOptions(hashKey, blockKey, "test-session", juno.CookieOptions{
+		Secure:     true,
+		SameSite:   http.SameSiteStrictMode,
+		HostPrefix: true,
+	})
+	assert.NoError(err)
+	session := juno.NewStdSession()
+	large := make([]byte, 3000)
+	rand.Read(large)
+	session.Set("large", hex.EncodeToString(large))
+
+	recorder := httptest.NewRecorder()
+	assert.NoError(sp.WriteCookie(recorder, session))
+	loaded, err := sp.read(&http.Request{Header: http.Header{"Cookie": recorder.HeaderMap["Set-Cookie"]}})
+	assert.NoError(err, "The session should be read back from the prefixed cookies")
+	assert.Equal(session.SessionID(), loaded.SessionID())
+
+	ended := httptest.NewRecorder()
+	assert.NoError(sp.EndSession(ended, session))
+	assert.Equal(MaxChunks, len(ended.Result().Cookies()), "Every chunk cookie should be removed")
+	for _, cookie := range append(recorder.Result().Cookies(), ended.Result().Cookies()...) {
+		assert.True(strings.HasPrefix(cookie.Name, "__Host-test-session"), "Every cookie should have the __Host- prefix")
+		assert.True(cookie.Secure, "%s should be Secure", cookie.Name)
+		assert.True(cookie.HttpOnly, "%s should be HttpOnly", cookie.Name)
+		assert.Equal(http.SameSiteStrictMode, cookie.SameSite, "%s should have the configured SameSite", cookie.Name)
+		assert.Equal("/", cookie.Path)
+	}
+}
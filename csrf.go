@@ -0,0 +1,177 @@
+package juno
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	//CSRF_SECRET_SESSION_KEY holds the session's CSRF secret, from which every token of the session is derived
+	CSRF_SECRET_SESSION_KEY = "csrfsecret"
+
+	csrfSecretSize = 32
+)
+
+var (
+	//ErrCSRFToken is returned when an unsafe request does not carry a valid CSRF token for its session
+	ErrCSRFToken = errors.New("The CSRF token is missing or not valid.")
+	//ErrCSRFOrigin is returned when an unsafe request comes from an origin that is not trusted
+	ErrCSRFOrigin = errors.New("The request origin is not trusted.")
+)
+
+//NewCSRF is a factory constructor for a CSRF reading tokens from the X-CSRF-Token header or the csrf_token form field.
+//Requests are trusted from their own host and from the provided origins, such as "https://app.example.com".
+func NewCSRF(trustedOrigins ...string) *CSRF {
+	return &CSRF{
+		HeaderName:     "X-CSRF-Token",
+		FieldName:      "csrf_token",
+		TrustedOrigins: trustedOrigins,
+	}
+}
+
+//CSRF protects cookie sessions from cross site request forgery. A secret is kept in the session store, so it is persisted
+//by the SessionProvider along with the rest of the session, and each token is the secret masked with a fresh one time pad,
+//so tokens differ on every response and cannot be recovered through compression side channels. The secret is rotated
+//by the Authenticator on login.
+type CSRF struct {
+	HeaderName     string
+	FieldName      string
+	TrustedOrigins []string
+	//IgnoreScheme trusts the request host over either scheme. Otherwise requests to the host must come from https when
+	//req.TLS is set and from http when it is not, so behind a proxy that ends tls the https origin of the host is to be
+	//listed in TrustedOrigins, or IgnoreScheme set.
+	IgnoreScheme bool
+}
+
+//Token returns a masked token for s, to be rendered in forms or sent by scripts in the header. A secret is created
+//on first use, which marks the store dirty so the SessionProvider persists it.
+func (c *CSRF) Token(s Session) (string, error) {
+	secret, err := c.secret(s)
+	if err != nil {
+		return "", err
+	}
+	pad := make([]byte, csrfSecretSize)
+	if _, err := rand.Read(pad); err != nil {
+		return "", err
+	}
+	masked := make([]byte, 0, 2*csrfSecretSize)
+	masked = append(masked, pad...)
+	for i := range secret {
+		masked = append(masked, pad[i]^secret[i])
+	}
+	return base64.RawURLEncoding.EncodeToString(masked), nil
+}
+
+//TemplateField returns a hidden form input carrying a token for s
+func (c *CSRF) TemplateField(s Session) (template.HTML, error) {
+	token, err := c.Token(s)
+	if err != nil {
+		return "", err
+	}
+	return template.HTML(`<input type="hidden" name="` + template.HTMLEscapeString(c.FieldName) + `" value="` + token + `">`), nil
+}
+
+//Verify checks unsafe requests, those not using GET, HEAD, OPTIONS or TRACE. Their Origin, or Referer when there is no
+//Origin, must be the request host or a trusted origin, and they must carry a token for s. Https requests without either
+//header are rejected, as browsers always send one of them.
+func (c *CSRF) Verify(req *http.Request, s Session) error {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return nil
+	}
+
+	if origin := req.Header.Get("Origin"); origin != "" {
+		if !c.trusted(req, origin) {
+			return ErrCSRFOrigin
+		}
+	} else if referer := req.Header.Get("Referer"); referer != "" {
+		if !c.trusted(req, referer) {
+			return ErrCSRFOrigin
+		}
+	} else if req.TLS != nil {
+		return ErrCSRFOrigin
+	}
+
+	token := req.Header.Get(c.HeaderName)
+	if token == "" {
+		token = req.PostFormValue(c.FieldName)
+	}
+	if !c.valid(s, token) {
+		return ErrCSRFToken
+	}
+	return nil
+}
+
+//RotateCSRF removes the CSRF secret from s, so tokens issued before a change of privileges are no longer accepted
+func RotateCSRF(s Session) {
+	if _, ok := s.Get(CSRF_SECRET_SESSION_KEY); ok {
+		s.Delete(CSRF_SECRET_SESSION_KEY)
+	}
+}
+
+func (c *CSRF) valid(s Session, token string) bool {
+	stored, ok := GetString(s, CSRF_SECRET_SESSION_KEY)
+	if !ok {
+		return false
+	}
+	secret, err := base64.RawURLEncoding.DecodeString(stored)
+	if err != nil || len(secret) != csrfSecretSize {
+		return false
+	}
+	masked, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(masked) != 2*csrfSecretSize {
+		return false
+	}
+	unmasked := make([]byte, csrfSecretSize)
+	for i := range unmasked {
+		unmasked[i] = masked[i] ^ masked[csrfSecretSize+i]
+	}
+	return subtle.ConstantTimeCompare(unmasked, secret) == 1
+}
+
+func (c *CSRF) secret(s Session) ([]byte, error) {
+	if stored, ok := GetString(s, CSRF_SECRET_SESSION_KEY); ok {
+		secret, err := base64.RawURLEncoding.DecodeString(stored)
+		if err == nil && len(secret) == csrfSecretSize {
+			return secret, nil
+		}
+	}
+	secret := make([]byte, csrfSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	s.Set(CSRF_SECRET_SESSION_KEY, base64.RawURLEncoding.EncodeToString(secret))
+	return secret, nil
+}
+
+//trusted reports whether the origin of rawURL is the request host, with the scheme of the request unless IgnoreScheme is set,
+//or exactly matches a trusted origin
+func (c *CSRF) trusted(req *http.Request, rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, req.Host) && (c.IgnoreScheme || strings.EqualFold(u.Scheme, requestScheme(req))) {
+		return true
+	}
+	origin := u.Scheme + "://" + u.Host
+	for _, trusted := range c.TrustedOrigins {
+		if strings.EqualFold(strings.TrimRight(trusted, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func requestScheme(req *http.Request) string {
+	if req.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
@@ -0,0 +1,144 @@
+package juno
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSRFToken(t *testing.T) {
+	assert := assert.New(t)
+
+	csrf := NewCSRF()
+	session := NewStdSession()
+	first, err := csrf.Token(session)
+	assert.NoError(err)
+	assert.True(session.StoreDirty(), "Creating the secret should mark the store dirty so it is persisted")
+	second, err := csrf.Token(session)
+	assert.NoError(err)
+	assert.NotEqual(first, second, "Tokens should be masked differently every time")
+	assert.True(csrf.valid(session, first), "Every issued token should be valid")
+	assert.True(csrf.valid(session, second), "Every issued token should be valid")
+
+	encoded, err := JSONCodec{}.Encode(session.Store())
+	assert.NoError(err)
+	store, err := JSONCodec{}.Decode(encoded)
+	assert.NoError(err)
+	reloaded := NewStdSession()
+	reloaded.ReplaceStore(store)
+	assert.True(csrf.valid(reloaded, first), "Tokens should be valid once the session is persisted and loaded")
+
+	assert.False(csrf.valid(NewStdSession(), first), "Tokens should not be valid for another session")
+	assert.False(csrf.valid(session, "not-a-token"), "Malformed tokens should not be valid")
+
+	field, err := csrf.TemplateField(session)
+	assert.NoError(err)
+	assert.Contains(string(field), `name="csrf_token"`, "The template field should use the form field name")
+}
+
+func TestCSRFVerify(t *testing.T) {
+	assert := assert.New(t)
+
+	csrf := NewCSRF("https://app.example.com")
+	session := NewStdSession()
+	token, _ := csrf.Token(session)
+
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	assert.NoError(csrf.Verify(req, session), "Safe methods should not be checked")
+
+	req = httptest.NewRequest("POST", "http://example.com/", nil)
+	assert.Equal(ErrCSRFToken, csrf.Verify(req, session), "Unsafe methods should require a token")
+
+	req = httptest.NewRequest("POST", "http://example.com/", nil)
+	req.Header.Set("X-CSRF-Token", token)
+	assert.NoError(csrf.Verify(req, session), "The token should be read from the header")
+
+	form := url.Values{"csrf_token": {token}}
+	req = httptest.NewRequest("POST", "http://example.com/", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Origin", "http://example.com")
+	assert.NoError(csrf.Verify(req, session), "The token should be read from the form, and the request host trusted")
+
+	req = httptest.NewRequest("POST", "http://example.com/", nil)
+	req.Header.Set("X-CSRF-Token", token)
+	req.Header.Set("Origin", "https://app.example.com")
+	assert.NoError(csrf.Verify(req, session), "Trusted origins should be accepted")
+
+	req = httptest.NewRequest("POST", "http://example.com/", nil)
+	req.Header.Set("X-CSRF-Token", token)
+	req.Header.Set("Origin", "https://evil.com")
+	assert.Equal(ErrCSRFOrigin, csrf.Verify(req, session), "Other origins should be rejected")
+
+	req = httptest.NewRequest("POST", "http://example.com/", nil)
+	req.Header.Set("X-CSRF-Token", token)
+	req.Header.Set("Referer", "https://evil.com/form")
+	assert.Equal(ErrCSRFOrigin, csrf.Verify(req, session), "The referer should be checked without an origin")
+
+	req = httptest.NewRequest("POST", "https://example.com/", nil)
+	req.TLS = &tls.ConnectionState{}
+	req.Header.Set("X-CSRF-Token", token)
+	assert.Equal(ErrCSRFOrigin, csrf.Verify(req, session), "Https requests without an origin or referer should be rejected")
+
+	req = httptest.NewRequest("POST", "http://example.com/", nil)
+	req.Header.Set("X-CSRF-Token", token)
+	req.Header.Set("Origin", "https://example.com")
+	assert.Equal(ErrCSRFOrigin, csrf.Verify(req, session), "The request host should not be trusted over another scheme")
+
+	req = httptest.NewRequest("POST", "https://example.com/", nil)
+	req.TLS = &tls.ConnectionState{}
+	req.Header.Set("X-CSRF-Token", token)
+	req.Header.Set("Origin", "http://example.com")
+	assert.Equal(ErrCSRFOrigin, csrf.Verify(req, session), "Https requests should not trust the http origin of the host")
+	req.Header.Set("Origin", "https://example.com")
+	assert.NoError(csrf.Verify(req, session), "Https requests should trust the https origin of the host")
+
+	RotateCSRF(session)
+	req = httptest.NewRequest("POST", "http://example.com/", nil)
+	req.Header.Set("X-CSRF-Token", token)
+	assert.Equal(ErrCSRFToken, csrf.Verify(req, session), "Tokens should not be valid once the secret is rotated")
+}
+
+func TestCSRFIgnoreScheme(t *testing.T) {
+	assert := assert.New(t)
+
+	csrf := NewCSRF()
+	csrf.IgnoreScheme = true
+	session := NewStdSession()
+	token, _ := csrf.Token(session)
+
+	//tls ends at a proxy, so the request reaches the server over http
+	req := httptest.NewRequest("POST", "http://example.com/", nil)
+	req.Header.Set("X-CSRF-Token", token)
+	req.Header.Set("Origin", "https://example.com")
+	assert.NoError(csrf.Verify(req, session), "The request host should be trusted over either scheme")
+
+	req.Header.Set("Origin", "https://evil.com")
+	assert.Equal(ErrCSRFOrigin, csrf.Verify(req, session), "Other hosts should still be rejected")
+
+	proxied := NewCSRF("https://example.com")
+	token, _ = proxied.Token(session)
+	req = httptest.NewRequest("POST", "http://example.com/", nil)
+	req.Header.Set("X-CSRF-Token", token)
+	req.Header.Set("Origin", "https://example.com")
+	assert.NoError(proxied.Verify(req, session), "The https origin of the host can be trusted explicitly instead")
+}
+
+func TestCSRFRotatedOnLogin(t *testing.T) {
+	assert := assert.New(t)
+
+	hash, _ := NewBcryptHasher(4).Hash("s3cret")
+	repo := &rehashingUserAuthRepo{user: &StdUser{UserID: 120, Email: "test@juno.com", Password: hash}}
+	authenticator := NewAuthenticator(repo, NewBcryptHasher(4))
+	csrf := NewCSRF()
+	session := NewStdSession()
+	token, _ := csrf.Token(session)
+
+	_, err := authenticator.BeginLoginFrom(context.Background(), session, mockCredentials{"test@juno.com", "s3cret"}, "")
+	assert.NoError(err)
+	assert.False(csrf.valid(session, token), "Tokens issued before login should not be valid after it")
+}
@@ -0,0 +1,199 @@
+package juno
+
+import (
+	"context"
+	"errors"
+	"strconv"
+)
+
+//Decision reasons
+const (
+	//ReasonGranted allows a request through a role granted the permission, directly or through an ancestor role
+	ReasonGranted = "granted"
+	//ReasonPolicyPermit allows a request through an attribute based policy
+	ReasonPolicyPermit = "policy-permit"
+	//ReasonPolicyDeny denies a request through an attribute based policy
+	ReasonPolicyDeny = "policy-deny"
+	//ReasonNoSubject denies a request without a user
+	ReasonNoSubject = "no-subject"
+	//ReasonUnknownRole denies a request when none of the roles are known to the Authorizer
+	ReasonUnknownRole = "unknown-role"
+	//ReasonUnknownPermission denies a request for a permission that is not known to the Authorizer
+	ReasonUnknownPermission = "unknown-permission"
+	//ReasonNotAssigned denies a request when no role, nor their ancestors, is granted the permission
+	ReasonNotAssigned = "permission-not-assigned"
+	//ReasonConditionFailed denies a request when a Condition registered for the permission does not pass
+	ReasonConditionFailed = "condition-failed"
+	//ReasonConditionNotApplicable denies a request when a Condition registered for the permission cannot check the resource
+	ReasonConditionNotApplicable = "condition-not-applicable"
+)
+
+type (
+	//Decision explains the outcome of an authorization check. It is serializable to JSON for admin tools and logs.
+	Decision struct {
+		Allowed      bool   `json:"allowed"`
+		Reason       string `json:"reason"`
+		PermissionID string `json:"permissionId"`
+		//RoleID is the role of the subject that was granted the permission
+		RoleID string `json:"roleId,omitempty"`
+		//GrantedBy is the role holding the permission, which is RoleID or one of its ancestors
+		GrantedBy string `json:"grantedBy,omitempty"`
+		//SuperadminRoleID is the superadmin role of the Authorizer, if one was created. It is empty when no role holds
+		//every permission through CreateSuperAdmin.
+		SuperadminRoleID string `json:"superadminRoleId,omitempty"`
+		//MatchedPolicies are the ids of the policies whose condition was true
+		MatchedPolicies []string `json:"matchedPolicies,omitempty"`
+		//Evaluated lists the grants, policies and conditions checked, in order
+		Evaluated []Evaluation `json:"evaluated"`
+	}
+
+	//Evaluation is a single grant, policy or condition checked while making a Decision
+	Evaluation struct {
+		//Kind is "role", "policy" or "condition"
+		Kind string `json:"kind"`
+		//ID is the role id, policy id, or index of the condition registered for the permission
+		ID      string `json:"id"`
+		Matched bool   `json:"matched"`
+	}
+)
+
+//Explain is the same as Granted, returning a Decision explaining why the role is or is not granted the permission
+func (mngr *Authorizer) Explain(role UserRole, p Permission) Decision {
+	mngr.Lock()
+	defer mngr.Unlock()
+	return mngr.explain([]UserRole{role}, p)
+}
+
+//Decide is the same as Evaluate, returning a Decision explaining the outcome
+func (mngr *Authorizer) Decide(ctx context.Context, req AccessRequest) (Decision, error) {
+	if req.Subject == nil || req.Action == nil {
+		decision := Decision{Reason: ReasonNoSubject, Evaluated: []Evaluation{}}
+		if req.Action != nil {
+			decision.PermissionID = req.Action.ID()
+		}
+		return decision, nil
+	}
+	mngr.RLock()
+	policies := mngr.policies
+	mngr.RUnlock()
+
+	var evaluated []Evaluation
+	if policies != nil {
+		result, err := policies.evaluate(req.Action, requestAttributes(req))
+		if err != nil {
+			return Decision{PermissionID: req.Action.ID()}, err
+		}
+		for _, id := range result.Evaluated {
+			evaluated = append(evaluated, Evaluation{Kind: "policy", ID: id, Matched: contains(result.Matched, id)})
+		}
+		if result.Effect != "" {
+			mngr.RLock()
+			superadmin := mngr.superadminID()
+			mngr.RUnlock()
+			decision := Decision{
+				Allowed:          result.Effect == Permit,
+				Reason:           ReasonPolicyPermit,
+				PermissionID:     req.Action.ID(),
+				SuperadminRoleID: superadmin,
+				MatchedPolicies:  result.Matched,
+				Evaluated:        evaluated,
+			}
+			if result.Effect == Deny {
+				decision.Reason = ReasonPolicyDeny
+			}
+			return decision, nil
+		}
+	}
+
+	decision, err := mngr.decide(ctx, req.Subject, req.Action, req.Resource)
+	decision.Evaluated = append(evaluated, decision.Evaluated...)
+	return decision, err
+}
+
+//decide checks the role grants of subject and the conditions registered for action, as Authorize does
+func (mngr *Authorizer) decide(ctx context.Context, subject User, action Permission, resource interface{}) (Decision, error) {
+	mngr.Lock()
+	decision := mngr.explain(RolesOf(subject), action)
+	conditions := mngr.conditions[action.ID()]
+	mngr.Unlock()
+
+	if !decision.Allowed {
+		return decision, nil
+	}
+
+	for i, condition := range conditions {
+		ok, err := condition(ctx, subject, resource)
+		evaluation := Evaluation{Kind: "condition", ID: strconv.Itoa(i), Matched: ok && err == nil}
+		decision.Evaluated = append(decision.Evaluated, evaluation)
+		if errors.Is(err, ErrConditionNotApplicable) {
+			decision.Allowed = false
+			decision.Reason = ReasonConditionNotApplicable
+			return decision, nil
+		}
+		if err != nil {
+			decision.Allowed = false
+			return decision, err
+		}
+		if !ok {
+			decision.Allowed = false
+			decision.Reason = ReasonConditionFailed
+			return decision, nil
+		}
+	}
+	return decision, nil
+}
+
+//explain checks whether any of roles is granted p, recording every role of their lineage that was checked.
+//It backs Granted, GrantedAny and GrantedAll, so explanations never disagree with them. It is to be called with the lock held.
+func (mngr *Authorizer) explain(roles []UserRole, p Permission) Decision {
+	decision := Decision{
+		PermissionID:     p.ID(),
+		SuperadminRoleID: mngr.superadminID(),
+		Evaluated:        []Evaluation{},
+	}
+	knownRole := false
+	for _, userRole := range roles {
+		for _, id := range mngr.lineage(userRole.ID()) {
+			role, exists := mngr.roles[id]
+			if !exists {
+				continue
+			}
+			knownRole = true
+			granted := role.Has(p)
+			decision.Evaluated = append(decision.Evaluated, Evaluation{Kind: "role", ID: id, Matched: granted})
+			if granted {
+				decision.Allowed = true
+				decision.Reason = ReasonGranted
+				decision.RoleID = userRole.ID()
+				decision.GrantedBy = id
+				return decision
+			}
+		}
+	}
+
+	switch {
+	case !knownRole:
+		decision.Reason = ReasonUnknownRole
+	case !mngr.hasPermission(p):
+		decision.Reason = ReasonUnknownPermission
+	default:
+		decision.Reason = ReasonNotAssigned
+	}
+	return decision
+}
+
+func (mngr *Authorizer) superadminID() string {
+	if mngr.superadmin == nil {
+		return ""
+	}
+	return mngr.superadmin.ID()
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
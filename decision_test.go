@@ -0,0 +1,113 @@
+package juno
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplain(t *testing.T) {
+	assert := assert.New(t)
+
+	authorizer := mockAuthorizer()
+
+	decision := authorizer.Explain(admin, update)
+	assert.True(decision.Allowed)
+	assert.Equal(ReasonGranted, decision.Reason)
+	assert.Equal("1", decision.RoleID, "The matched role should be recorded")
+	assert.Equal("1", decision.GrantedBy)
+	assert.Equal(update.ID(), decision.PermissionID)
+
+	assert.NoError(authorizer.AssignParentToRole(manager, admin))
+	decision = authorizer.Explain(manager, update)
+	assert.True(decision.Allowed, "Permissions should be granted through ancestor roles")
+	assert.Equal("3", decision.RoleID)
+	assert.Equal("1", decision.GrantedBy, "The ancestor holding the permission should be recorded")
+	assert.Equal([]Evaluation{{Kind: "role", ID: "3", Matched: false}, {Kind: "role", ID: "1", Matched: true}}, decision.Evaluated)
+
+	decision = authorizer.Explain(sales, update)
+	assert.False(decision.Allowed)
+	assert.Equal(ReasonNotAssigned, decision.Reason, "A known role missing a known permission should not be assigned")
+	assert.Equal("", decision.SuperadminRoleID, "The missing superadmin should be reported separately from the reason")
+	assert.Equal(2, len(decision.Evaluated), "The role and its ancestors should be evaluated")
+
+	unknownRole := &StdUserRole{RoleID: 9999}
+	decision = authorizer.Explain(unknownRole, update)
+	assert.Equal(ReasonUnknownRole, decision.Reason)
+
+	unknownPermission := NewStdPermission("unknown", "Not loaded")
+	unknownPermission.PermissionID = 99
+	decision = authorizer.Explain(admin, unknownPermission)
+	assert.Equal(ReasonUnknownPermission, decision.Reason)
+	assert.Equal("", decision.SuperadminRoleID, "No superadmin should be reported before one is created")
+
+	root := NewStdRole("root")
+	root.RoleID = 10
+	assert.NoError(authorizer.CreateSuperAdmin(root))
+	decision = authorizer.Explain(root, canDelete)
+	assert.True(decision.Allowed, "The superadmin should be granted every permission")
+	assert.Equal("10", decision.SuperadminRoleID)
+
+	decision = authorizer.Explain(sales, update)
+	assert.Equal(ReasonNotAssigned, decision.Reason, "A known role missing the permission should still not be assigned once there is a superadmin")
+
+	encoded, err := json.Marshal(authorizer.Explain(sales, update))
+	assert.NoError(err)
+	assert.Contains(string(encoded), `"reason":"permission-not-assigned"`, "Decisions should serialize to JSON")
+	assert.Contains(string(encoded), `"evaluated":[{"kind":"role","id":"4","matched":false}`)
+}
+
+func TestDecide(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	set, err := LoadPolicyFile("testdata/policies.json")
+	assert.NoError(err)
+	authorizer := mockAuthorizer()
+	authorizer.SetPolicies(set)
+	authorizer.AddCondition(update, OwnerOnly())
+
+	refund := NewStdPermission("refund", "Refund an order")
+	refund.PermissionID = 5
+	seller := &mockDepartmentUser{department: "sales"}
+	seller.StdUserRole = sales.StdUserRole
+
+	decision, err := authorizer.Decide(ctx, AccessRequest{Subject: seller, Action: refund, Resource: map[string]interface{}{"amount": 120, "frozen": true}})
+	assert.NoError(err)
+	assert.False(decision.Allowed)
+	assert.Equal(ReasonPolicyDeny, decision.Reason)
+	assert.Equal([]string{"refund-sales", "refund-frozen"}, decision.MatchedPolicies, "The matched policies should be recorded")
+
+	user := &StdUser{UserID: 42}
+	user.StdUserRole = admin.StdUserRole
+	decision, err = authorizer.Decide(ctx, AccessRequest{Subject: user, Action: update, Resource: &mockPost{owner: 7}})
+	assert.NoError(err)
+	assert.False(decision.Allowed)
+	assert.Equal(ReasonConditionFailed, decision.Reason, "A failing condition should be the reason for denial")
+	assert.Equal([]Evaluation{
+		{Kind: "policy", ID: "update-maintenance", Matched: false},
+		{Kind: "role", ID: "1", Matched: true},
+		{Kind: "condition", ID: "0", Matched: false},
+	}, decision.Evaluated, "Policies, grants and conditions should be recorded in order")
+
+	decision, _ = authorizer.Decide(ctx, AccessRequest{Subject: user, Action: update, Resource: "not owned"})
+	assert.Equal(ReasonConditionNotApplicable, decision.Reason)
+
+	wrapped := mockAuthorizer()
+	wrapped.AddCondition(update, func(ctx context.Context, subject User, resource interface{}) (bool, error) {
+		return false, fmt.Errorf("Resource has no owner: %w", ErrConditionNotApplicable)
+	})
+	decision, err = wrapped.Decide(ctx, AccessRequest{Subject: user, Action: update})
+	assert.NoError(err, "A wrapped ErrConditionNotApplicable should deny the request rather than fail it")
+	assert.Equal(ReasonConditionNotApplicable, decision.Reason)
+
+	decision, _ = authorizer.Decide(ctx, AccessRequest{Subject: user, Action: update, Resource: &mockPost{owner: 42}})
+	assert.True(decision.Allowed)
+	assert.Equal(ReasonGranted, decision.Reason)
+
+	decision, _ = authorizer.Decide(ctx, AccessRequest{Action: update})
+	assert.Equal(ReasonNoSubject, decision.Reason)
+}
@@ -0,0 +1,43 @@
+package juno
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	//ErrDuplicatePermission is to be returned by an AuthRepo when creating a permission that already exists
+	ErrDuplicatePermission = errors.New("Permission already exists")
+	//ErrRoleCycle is returned when assigning a parent role would make a role inherit from itself
+	ErrRoleCycle = errors.New("Role hierarchy cannot contain cycles")
+)
+
+//StartError is returned when a component could not be started because its repository failed
+type StartError struct {
+	Component string
+	Err       error
+}
+
+func (e *StartError) Error() string {
+	return fmt.Sprintf("%s failed to start: %v", e.Component, e.Err)
+}
+
+//Unwrap exposes the underlying repository error
+func (e *StartError) Unwrap() error {
+	return e.Err
+}
+
+//PermissionError is returned when a permission could not be added to an Authorizer
+type PermissionError struct {
+	PermissionID string
+	Err          error
+}
+
+func (e *PermissionError) Error() string {
+	return fmt.Sprintf("Unable to add permission %s: %v", e.PermissionID, e.Err)
+}
+
+//Unwrap exposes the underlying repository error
+func (e *PermissionError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,526 @@
+package juno
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+//expression is a compiled policy condition, evaluated against the attributes of an access request
+type expression interface {
+	eval(attrs map[string]interface{}) (interface{}, error)
+}
+
+//ParseExpressionError is returned when a policy condition cannot be compiled
+type ParseExpressionError struct {
+	Expression string
+	Pos        int
+	Msg        string
+}
+
+func (e *ParseExpressionError) Error() string {
+	return fmt.Sprintf("Invalid expression %q at %d: %s", e.Expression, e.Pos, e.Msg)
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenOp
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+//tokenize splits a condition into identifiers (including dotted attribute paths and keywords), numbers, quoted strings and operators
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(src) && (unicode.IsLetter(rune(src[i])) || unicode.IsDigit(rune(src[i])) || src[i] == '_' || src[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{tokenIdent, src[start:i], start})
+		case unicode.IsDigit(c) || (c == '-' && i+1 < len(src) && unicode.IsDigit(rune(src[i+1])) && precedesOperand(tokens)):
+			start := i
+			i++
+			for i < len(src) && (unicode.IsDigit(rune(src[i])) || src[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{tokenNumber, src[start:i], start})
+		case c == '\'' || c == '"':
+			start := i
+			i++
+			var sb strings.Builder
+			for i < len(src) && rune(src[i]) != c {
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+				}
+				sb.WriteByte(src[i])
+				i++
+			}
+			if i >= len(src) {
+				return nil, &ParseExpressionError{src, start, "unterminated string"}
+			}
+			i++
+			tokens = append(tokens, token{tokenString, sb.String(), start})
+		default:
+			op := ""
+			for _, candidate := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ","} {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, &ParseExpressionError{src, i, fmt.Sprintf("unexpected character %q", c)}
+			}
+			tokens = append(tokens, token{tokenOp, op, i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{tokenEOF, "", len(src)}), nil
+}
+
+//precedesOperand reports whether the next token starts an operand, so a '-' is read as the sign of a number
+func precedesOperand(tokens []token) bool {
+	if len(tokens) == 0 {
+		return true
+	}
+	last := tokens[len(tokens)-1]
+	return last.kind == tokenOp && last.value != ")" && last.value != "]"
+}
+
+//parseExpression compiles a condition. The grammar, from lowest precedence, is:
+//
+//	or         = and { ("||" | "or") and }
+//	and        = not { ("&&" | "and") not }
+//	not        = ("!" | "not") not | comparison
+//	comparison = operand [ ("==" | "!=" | "<" | "<=" | ">" | ">=" | "in") operand ]
+//	operand    = number | string | "true" | "false" | "null" | path | "(" or ")" | "[" [ or { "," or } ] "]"
+func parseExpression(src string) (expression, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{src: src, tokens: tokens}
+	expr, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokenEOF {
+		return nil, p.errorf("unexpected %q", p.peek().value)
+	}
+	return expr, nil
+}
+
+type parser struct {
+	src    string
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+//accept consumes the next token when it is one of the provided operators or keywords
+func (p *parser) accept(values ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokenOp && t.kind != tokenIdent {
+		return "", false
+	}
+	for _, v := range values {
+		if t.value == v {
+			p.pos++
+			return v, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &ParseExpressionError{p.src, p.peek().pos, fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) or() (expression, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("||", "or"); !ok {
+			return left, nil
+		}
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalExpr{or: true, left: left, right: right}
+	}
+}
+
+func (p *parser) and() (expression, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("&&", "and"); !ok {
+			return left, nil
+		}
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalExpr{left: left, right: right}
+	}
+}
+
+func (p *parser) not() (expression, error) {
+	if _, ok := p.accept("!", "not"); ok {
+		operand, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{operand}, nil
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (expression, error) {
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.accept("==", "!=", "<=", ">=", "<", ">", "in")
+	if !ok {
+		return left, nil
+	}
+	right, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	return &compareExpr{op: op, left: left, right: right}, nil
+}
+
+func (p *parser) operand() (expression, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		n, err := strconv.ParseFloat(t.value, 64)
+		if err != nil {
+			return nil, &ParseExpressionError{p.src, t.pos, "invalid number " + t.value}
+		}
+		return literalExpr{n}, nil
+	case tokenString:
+		return literalExpr{t.value}, nil
+	case tokenIdent:
+		switch t.value {
+		case "true":
+			return literalExpr{true}, nil
+		case "false":
+			return literalExpr{false}, nil
+		case "null":
+			return literalExpr{nil}, nil
+		case "and", "or", "not", "in":
+			return nil, &ParseExpressionError{p.src, t.pos, "unexpected " + t.value}
+		}
+		return pathExpr(strings.Split(t.value, ".")), nil
+	case tokenOp:
+		switch t.value {
+		case "(":
+			expr, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := p.accept(")"); !ok {
+				return nil, p.errorf("expected )")
+			}
+			return expr, nil
+		case "[":
+			list := listExpr{}
+			if _, ok := p.accept("]"); ok {
+				return list, nil
+			}
+			for {
+				item, err := p.or()
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, item)
+				if _, ok := p.accept("]"); ok {
+					return list, nil
+				}
+				if _, ok := p.accept(","); !ok {
+					return nil, p.errorf("expected , or ]")
+				}
+			}
+		}
+	}
+	if t.kind == tokenEOF {
+		return nil, &ParseExpressionError{p.src, t.pos, "unexpected end of expression"}
+	}
+	return nil, &ParseExpressionError{p.src, t.pos, fmt.Sprintf("unexpected %q", t.value)}
+}
+
+type literalExpr struct {
+	value interface{}
+}
+
+func (e literalExpr) eval(attrs map[string]interface{}) (interface{}, error) {
+	return e.value, nil
+}
+
+//pathExpr looks up a dotted attribute path such as subject.department. Missing attributes evaluate to null.
+type pathExpr []string
+
+func (e pathExpr) eval(attrs map[string]interface{}) (interface{}, error) {
+	var current interface{} = attrs
+	for _, name := range e {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, nil
+		}
+		current = m[name]
+	}
+	return current, nil
+}
+
+type listExpr []expression
+
+func (e listExpr) eval(attrs map[string]interface{}) (interface{}, error) {
+	values := make([]interface{}, len(e))
+	for i, item := range e {
+		v, err := item.eval(attrs)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+//unknownValue is the result of a condition over a missing attribute. It is neither true nor false, so negating it
+//stays unknown, and an unknown condition does not apply.
+type unknownValue struct{}
+
+var unknown = unknownValue{}
+
+type notExpr struct {
+	operand expression
+}
+
+func (e *notExpr) eval(attrs map[string]interface{}) (interface{}, error) {
+	v, err := evalTruth(e.operand, attrs)
+	if err != nil {
+		return nil, err
+	}
+	if v == unknown {
+		return unknown, nil
+	}
+	return !v.(bool), nil
+}
+
+type logicalExpr struct {
+	or          bool
+	left, right expression
+}
+
+//eval follows three valued logic: unknown && false is false and unknown || true is true, otherwise unknown is kept
+func (e *logicalExpr) eval(attrs map[string]interface{}) (interface{}, error) {
+	left, err := evalTruth(e.left, attrs)
+	if err != nil {
+		return nil, err
+	}
+	if left == e.or {
+		return left, nil
+	}
+	right, err := evalTruth(e.right, attrs)
+	if err != nil {
+		return nil, err
+	}
+	if right == e.or {
+		return right, nil
+	}
+	if left == unknown {
+		return unknown, nil
+	}
+	return right, nil
+}
+
+//evalTruth evaluates expr as a condition, returning true, false or unknown. Null, such as a missing attribute, is unknown.
+func evalTruth(expr expression, attrs map[string]interface{}) (interface{}, error) {
+	v, err := expr.eval(attrs)
+	if err != nil {
+		return nil, err
+	}
+	switch b := v.(type) {
+	case nil, unknownValue:
+		return unknown, nil
+	case bool:
+		return b, nil
+	}
+	return nil, fmt.Errorf("Expected a boolean but got %v", v)
+}
+
+//evalBool evaluates expr as a condition. Unknown, such as a comparison with a missing attribute, is false.
+func evalBool(expr expression, attrs map[string]interface{}) (bool, error) {
+	v, err := evalTruth(expr, attrs)
+	if err != nil {
+		return false, err
+	}
+	return v == true, nil
+}
+
+type compareExpr struct {
+	op          string
+	left, right expression
+}
+
+func (e *compareExpr) eval(attrs map[string]interface{}) (interface{}, error) {
+	left, err := e.left.eval(attrs)
+	if err != nil {
+		return nil, err
+	}
+	right, err := e.right.eval(attrs)
+	if err != nil {
+		return nil, err
+	}
+	if left == unknown || right == unknown {
+		return unknown, nil
+	}
+
+	switch e.op {
+	case "==", "!=":
+		//comparing a missing attribute with a value is unknown, so that neither == nor != grants access without it.
+		//Comparing with the null literal tests whether the attribute is present.
+		if (left == nil && right != nil && !isNullLiteral(e.left)) || (right == nil && left != nil && !isNullLiteral(e.right)) {
+			return unknown, nil
+		}
+		return attributeEqual(left, right) == (e.op == "=="), nil
+	case "in":
+		if left == nil || right == nil {
+			return unknown, nil
+		}
+		list := reflect.ValueOf(right)
+		if list.Kind() != reflect.Slice && list.Kind() != reflect.Array {
+			return nil, fmt.Errorf("The right operand of in must be a list, got %v", right)
+		}
+		for i := 0; i < list.Len(); i++ {
+			if attributeEqual(left, list.Index(i).Interface()) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	//ordering a missing attribute is unknown rather than an error, so absent attributes never grant access
+	if left == nil || right == nil {
+		return unknown, nil
+	}
+	cmp, err := attributeCompare(left, right)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	}
+	return cmp >= 0, nil
+}
+
+func isNullLiteral(e expression) bool {
+	l, ok := e.(literalExpr)
+	return ok && l.value == nil
+}
+
+//toNumber converts any numeric attribute to a float64
+func toNumber(v interface{}) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+func attributeEqual(left, right interface{}) bool {
+	if l, ok := toNumber(left); ok {
+		r, ok := toNumber(right)
+		return ok && l == r
+	}
+	if l, ok := left.(time.Time); ok {
+		r, ok := right.(time.Time)
+		return ok && l.Equal(r)
+	}
+	if left == nil || right == nil {
+		return left == nil && right == nil
+	}
+	if reflect.TypeOf(left).Comparable() && reflect.TypeOf(right).Comparable() {
+		return left == right
+	}
+	return reflect.DeepEqual(left, right)
+}
+
+//attributeCompare orders two numbers, strings or times
+func attributeCompare(left, right interface{}) (int, error) {
+	if l, ok := toNumber(left); ok {
+		if r, ok := toNumber(right); ok {
+			switch {
+			case l < r:
+				return -1, nil
+			case l > r:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	if l, ok := left.(string); ok {
+		if r, ok := right.(string); ok {
+			return strings.Compare(l, r), nil
+		}
+	}
+	if l, ok := left.(time.Time); ok {
+		if r, ok := right.(time.Time); ok {
+			switch {
+			case l.Before(r):
+				return -1, nil
+			case l.After(r):
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	return 0, fmt.Errorf("Cannot compare %v with %v", left, right)
+}
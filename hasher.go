@@ -0,0 +1,282 @@
+package juno
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+//PasswordHasher is implemented by a password hashing algorithm used by the Authenticator
+type PasswordHasher interface {
+	//Hash returns an encoded hash of password that embeds the algorithm and its parameters
+	Hash(password string) (string, error)
+	//Verify reports whether password matches an encoded hash produced by this algorithm
+	Verify(password, hash string) (bool, error)
+	//Identifies reports whether an encoded hash was produced by this algorithm
+	Identifies(hash string) bool
+	//NeedsRehash reports whether an encoded hash was produced by another algorithm or with outdated parameters
+	NeedsRehash(hash string) bool
+}
+
+var (
+	//ErrInvalidHash is returned when an encoded password hash cannot be parsed
+	ErrInvalidHash = errors.New("The encoded password hash is not valid")
+)
+
+//NewBcryptHasher is a factory constructor for a bcrypt PasswordHasher. Costs below bcrypt.MinCost use bcrypt.DefaultCost.
+func NewBcryptHasher(cost int) *BcryptHasher {
+	if cost < bcrypt.MinCost {
+		cost = bcrypt.DefaultCost
+	}
+	return &BcryptHasher{Cost: cost}
+}
+
+//BcryptHasher is a PasswordHasher using bcrypt, encoded in its standard $2a$ format
+type BcryptHasher struct {
+	Cost int
+}
+
+//Hash implements the PasswordHasher interface
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+//Verify implements the PasswordHasher interface
+func (h *BcryptHasher) Verify(password, hash string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+//Identifies implements the PasswordHasher interface
+func (h *BcryptHasher) Identifies(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+//NeedsRehash implements the PasswordHasher interface
+func (h *BcryptHasher) NeedsRehash(hash string) bool {
+	if !h.Identifies(hash) {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.Cost
+}
+
+//NewArgon2idHasher is a factory constructor for an argon2id PasswordHasher using the recommended parameters
+func NewArgon2idHasher() *Argon2idHasher {
+	return &Argon2idHasher{
+		Time:       2,
+		Memory:     19 * 1024,
+		Threads:    1,
+		SaltLength: 16,
+		KeyLength:  32,
+	}
+}
+
+//Argon2idHasher is a PasswordHasher using argon2id, encoded in the PHC string format
+type Argon2idHasher struct {
+	Time uint32
+	//Memory is in KiB
+	Memory     uint32
+	Threads    uint8
+	SaltLength uint32
+	KeyLength  uint32
+}
+
+//Hash implements the PasswordHasher interface
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt, err := newSalt(h.SaltLength)
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, h.KeyLength)
+	params := fmt.Sprintf("m=%d,t=%d,p=%d", h.Memory, h.Time, h.Threads)
+	return encodePHC("argon2id", fmt.Sprintf("v=%d", argon2.Version), params, salt, key), nil
+}
+
+//Verify implements the PasswordHasher interface
+func (h *Argon2idHasher) Verify(password, hash string) (bool, error) {
+	decoded, err := h.decode(hash)
+	if err != nil {
+		return false, err
+	}
+	key := argon2.IDKey([]byte(password), decoded.salt, decoded.Time, decoded.Memory, decoded.Threads, uint32(len(decoded.key)))
+	return subtle.ConstantTimeCompare(key, decoded.key) == 1, nil
+}
+
+//Identifies implements the PasswordHasher interface
+func (h *Argon2idHasher) Identifies(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+//NeedsRehash implements the PasswordHasher interface
+func (h *Argon2idHasher) NeedsRehash(hash string) bool {
+	decoded, err := h.decode(hash)
+	if err != nil {
+		return true
+	}
+	return decoded.Time != h.Time || decoded.Memory != h.Memory || decoded.Threads != h.Threads ||
+		uint32(len(decoded.salt)) != h.SaltLength || uint32(len(decoded.key)) != h.KeyLength
+}
+
+type argon2idHash struct {
+	Argon2idHasher
+	salt []byte
+	key  []byte
+}
+
+func (h *Argon2idHasher) decode(hash string) (*argon2idHash, error) {
+	if !h.Identifies(hash) {
+		return nil, ErrInvalidHash
+	}
+	parts, salt, key, err := decodePHC(hash)
+	if err != nil {
+		return nil, err
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, ErrInvalidHash
+	}
+	decoded := &argon2idHash{salt: salt, key: key}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &decoded.Memory, &decoded.Time, &decoded.Threads); err != nil {
+		return nil, ErrInvalidHash
+	}
+	//argon2.IDKey panics on these, so a corrupt stored hash must not reach it
+	if decoded.Time < 1 || decoded.Threads < 1 || decoded.Memory < 8*uint32(decoded.Threads) {
+		return nil, ErrInvalidHash
+	}
+	return decoded, nil
+}
+
+//NewScryptHasher is a factory constructor for a scrypt PasswordHasher using the recommended parameters
+func NewScryptHasher() *ScryptHasher {
+	return &ScryptHasher{
+		LogN:       15,
+		R:          8,
+		P:          1,
+		SaltLength: 16,
+		KeyLength:  32,
+	}
+}
+
+//ScryptHasher is a PasswordHasher using scrypt, encoded in the PHC string format
+type ScryptHasher struct {
+	//LogN is the base 2 logarithm of the CPU/memory cost parameter N
+	LogN       uint8
+	R          int
+	P          int
+	SaltLength uint32
+	KeyLength  uint32
+}
+
+//Hash implements the PasswordHasher interface
+func (h *ScryptHasher) Hash(password string) (string, error) {
+	salt, err := newSalt(h.SaltLength)
+	if err != nil {
+		return "", err
+	}
+	key, err := scrypt.Key([]byte(password), salt, 1<<h.LogN, h.R, h.P, int(h.KeyLength))
+	if err != nil {
+		return "", err
+	}
+	params := fmt.Sprintf("ln=%d,r=%d,p=%d", h.LogN, h.R, h.P)
+	return encodePHC("scrypt", "", params, salt, key), nil
+}
+
+//Verify implements the PasswordHasher interface
+func (h *ScryptHasher) Verify(password, hash string) (bool, error) {
+	decoded, err := h.decode(hash)
+	if err != nil {
+		return false, err
+	}
+	key, err := scrypt.Key([]byte(password), decoded.salt, 1<<decoded.LogN, decoded.R, decoded.P, len(decoded.key))
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(key, decoded.key) == 1, nil
+}
+
+//Identifies implements the PasswordHasher interface
+func (h *ScryptHasher) Identifies(hash string) bool {
+	return strings.HasPrefix(hash, "$scrypt$")
+}
+
+//NeedsRehash implements the PasswordHasher interface
+func (h *ScryptHasher) NeedsRehash(hash string) bool {
+	decoded, err := h.decode(hash)
+	if err != nil {
+		return true
+	}
+	return decoded.LogN != h.LogN || decoded.R != h.R || decoded.P != h.P ||
+		uint32(len(decoded.salt)) != h.SaltLength || uint32(len(decoded.key)) != h.KeyLength
+}
+
+type scryptHash struct {
+	ScryptHasher
+	salt []byte
+	key  []byte
+}
+
+func (h *ScryptHasher) decode(hash string) (*scryptHash, error) {
+	if !h.Identifies(hash) {
+		return nil, ErrInvalidHash
+	}
+	parts, salt, key, err := decodePHC(hash)
+	if err != nil {
+		return nil, err
+	}
+	decoded := &scryptHash{salt: salt, key: key}
+	if _, err := fmt.Sscanf(parts[2], "ln=%d,r=%d,p=%d", &decoded.LogN, &decoded.R, &decoded.P); err != nil {
+		return nil, ErrInvalidHash
+	}
+	if decoded.LogN < 1 || decoded.LogN > 31 {
+		return nil, ErrInvalidHash
+	}
+	return decoded, nil
+}
+
+func newSalt(length uint32) ([]byte, error) {
+	salt := make([]byte, length)
+	_, err := rand.Read(salt)
+	return salt, err
+}
+
+//encodePHC formats a hash as $id[$version]$params$salt$hash
+func encodePHC(id, version, params string, salt, key []byte) string {
+	fields := []string{"", id}
+	if version != "" {
+		fields = append(fields, version)
+	}
+	fields = append(fields, params, base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+	return strings.Join(fields, "$")
+}
+
+//decodePHC splits a PHC string, decoding the trailing salt and hash fields
+func decodePHC(hash string) ([]string, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) < 5 {
+		return nil, nil, nil, ErrInvalidHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[len(parts)-2])
+	if err != nil {
+		return nil, nil, nil, ErrInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[len(parts)-1])
+	if err != nil || len(key) == 0 {
+		return nil, nil, nil, ErrInvalidHash
+	}
+	return parts, salt, key, nil
+}
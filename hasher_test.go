@@ -0,0 +1,112 @@
+package juno
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasswordHashers(t *testing.T) {
+	assert := assert.New(t)
+
+	hashers := map[string]PasswordHasher{
+		"$2a$":       NewBcryptHasher(4),
+		"$argon2id$": NewArgon2idHasher(),
+		"$scrypt$":   NewScryptHasher(),
+	}
+	for prefix, hasher := range hashers {
+		hash, err := hasher.Hash("s3cret")
+		assert.NoError(err)
+		assert.True(strings.HasPrefix(hash, prefix), "The hash should be encoded with the algorithm identifier %s", prefix)
+		assert.True(hasher.Identifies(hash))
+		assert.False(hasher.NeedsRehash(hash), "A fresh hash should not need rehashing")
+
+		ok, err := hasher.Verify("s3cret", hash)
+		assert.NoError(err)
+		assert.True(ok, "The correct password should verify")
+		ok, err = hasher.Verify("wrong", hash)
+		assert.NoError(err)
+		assert.False(ok, "An incorrect password should not verify")
+	}
+
+	hash, _ := NewBcryptHasher(4).Hash("s3cret")
+	assert.True(NewBcryptHasher(5).NeedsRehash(hash), "A hash with a different cost should need rehashing")
+	assert.True(NewArgon2idHasher().NeedsRehash(hash), "A hash from a different algorithm should need rehashing")
+
+	weak := NewArgon2idHasher()
+	weak.Time = 1
+	hash, _ = weak.Hash("s3cret")
+	assert.True(NewArgon2idHasher().NeedsRehash(hash), "A hash with outdated parameters should need rehashing")
+
+	_, err := NewScryptHasher().Verify("s3cret", "$scrypt$ln=15,r=8,p=1$not-base64!$")
+	assert.Equal(ErrInvalidHash, err)
+
+	valid, _ := NewArgon2idHasher().Hash("s3cret")
+	params := strings.Split(valid, "$")[3]
+	for _, corrupt := range []string{"m=65536,t=0,p=2", "m=65536,t=1,p=0", "m=8,t=1,p=2"} {
+		hash := strings.Replace(valid, params, corrupt, 1)
+		assert.NotPanics(func() {
+			_, err = NewArgon2idHasher().Verify("s3cret", hash)
+		})
+		assert.Equal(ErrInvalidHash, err, "A stored hash with %s should be rejected", corrupt)
+	}
+}
+
+type mockCredentials struct {
+	username, password string
+}
+
+func (c mockCredentials) GetUsername() string { return c.username }
+func (c mockCredentials) GetPassword() string { return c.password }
+
+type rehashingUserAuthRepo struct {
+	user   *StdUser
+	hashes []string
+}
+
+func (repo *rehashingUserAuthRepo) GetUserByCredentials(creds Credentials) (User, error) {
+	return repo.user, nil
+}
+
+func (repo *rehashingUserAuthRepo) GetUserFromSession(s Session) (User, error) {
+	return repo.user, nil
+}
+
+func (repo *rehashingUserAuthRepo) UpdatePasswordHash(ctx context.Context, user User, hash string) error {
+	repo.hashes = append(repo.hashes, hash)
+	repo.user.Password = hash
+	return nil
+}
+
+func TestAuthenticateRehashes(t *testing.T) {
+	assert := assert.New(t)
+
+	legacy, _ := NewBcryptHasher(4).Hash("s3cret")
+	repo := &rehashingUserAuthRepo{user: &StdUser{UserID: 1, Email: "test@juno.com", Password: legacy}}
+	authenticator := NewAuthenticator(repo, NewArgon2idHasher())
+
+	_, err := authenticator.Authenticate(mockCredentials{"test@juno.com", "wrong"})
+	assert.Equal(ErrInvalidCredentials, err)
+	assert.Equal(0, len(repo.hashes), "A failed login should not rehash the password")
+
+	user, err := authenticator.Authenticate(mockCredentials{"test@juno.com", "s3cret"})
+	assert.NoError(err, "Legacy bcrypt hashes should still verify")
+	assert.Equal(1, user.ID())
+	assert.Equal(1, len(repo.hashes), "An outdated hash should be replaced after a successful login")
+	assert.True(strings.HasPrefix(repo.user.Password, "$argon2id$"))
+
+	_, err = authenticator.Authenticate(mockCredentials{"test@juno.com", "s3cret"})
+	assert.NoError(err, "The rehashed password should verify")
+	assert.Equal(1, len(repo.hashes), "A current hash should not be rehashed")
+}
+
+func TestNewAuthenticatorCopiesHashers(t *testing.T) {
+	assert := assert.New(t)
+
+	backing := make([]PasswordHasher, 1, 4)
+	backing[0] = NewArgon2idHasher()
+	NewAuthenticator(&rehashingUserAuthRepo{}, backing...)
+	assert.Nil(backing[:4][1], "The built in hashers should not be written to the caller's backing array")
+}
@@ -0,0 +1,183 @@
+package juno
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type (
+	//AttemptStore records consecutive failed login attempts by key, such as a username or client ip
+	AttemptStore interface {
+		//GetAttempts returns the number of failures recorded for key and the time of the last one. Unknown keys have no failures.
+		GetAttempts(ctx context.Context, key string) (failures int, last time.Time, err error)
+		//RecordFailure adds a failure at the provided time for key, returning the new number of failures
+		RecordFailure(ctx context.Context, key string, at time.Time) (int, error)
+		//ResetAttempts forgets every failure recorded for key
+		ResetAttempts(ctx context.Context, key string) error
+	}
+
+	//LockoutPolicy configures when a key is temporarily locked after failed login attempts
+	LockoutPolicy struct {
+		//MaxAttempts is the number of failures allowed before the key is locked. Zero disables the policy.
+		MaxAttempts int
+		//Delay is how long the key is locked after reaching MaxAttempts, doubled for every further failure
+		Delay time.Duration
+		//MaxDelay caps the lockout duration when greater than zero
+		MaxDelay time.Duration
+		//Window is how long failures are remembered after the last one when greater than zero
+		Window time.Duration
+	}
+
+	//LockoutOptions configure brute force protection for an Authenticator
+	LockoutOptions struct {
+		Username LockoutPolicy
+		IP       LockoutPolicy
+	}
+)
+
+//EnableLockout makes the Authenticator track failed login attempts in store, locking usernames and client ips
+//according to opts
+func (a *Authenticator) EnableLockout(store AttemptStore, opts LockoutOptions) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.attempts = store
+	a.lockout = opts
+}
+
+//lockoutSettings returns the AttemptStore and options set with EnableLockout
+func (a *Authenticator) lockoutSettings() (AttemptStore, LockoutOptions) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.attempts, a.lockout
+}
+
+//AuthenticateRequest is the same as AuthenticateFrom, using the request context and the ip of req.RemoteAddr.
+//Proxy headers such as X-Forwarded-For are not trusted; use AuthenticateFrom when running behind a proxy.
+func (a *Authenticator) AuthenticateRequest(req *http.Request, creds Credentials) (User, error) {
+	return a.AuthenticateFrom(req.Context(), creds, ClientIP(req))
+}
+
+//AuthenticateFrom is the same as AuthenticateContext, additionally tracking failed attempts for the client ip.
+//ErrAccountLocked is returned without checking the credentials while the username or ip is locked.
+//Every attempt is recorded to the AuditLog set with EnableAudit.
+func (a *Authenticator) AuthenticateFrom(ctx context.Context, creds Credentials, ip string) (User, error) {
+	user, err := a.checkPassword(ctx, creds, ip)
+	if err != nil {
+		return nil, err
+	}
+	//a successful login only clears the username, so an attacker cannot reset an ip with their own account
+	err = a.resetAttempts(ctx, creds.GetUsername())
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+//checkPassword is the same as AuthenticateFrom without clearing the failed attempts of the username,
+//so a login waiting for its second factor still counts towards the username lockout
+func (a *Authenticator) checkPassword(ctx context.Context, creds Credentials, ip string) (User, error) {
+	user, err := a.authenticateFrom(ctx, creds, ip)
+	event := AuditEvent{Type: AuditLogin, Username: creds.GetUsername(), IPAddress: ip}
+	if err == nil {
+		event.UserID = user.ID()
+	}
+	a.auditLog().Record(ctx, event.result(err))
+	return user, err
+}
+
+func (a *Authenticator) authenticateFrom(ctx context.Context, creds Credentials, ip string) (User, error) {
+	store, opts := a.lockoutSettings()
+	if store == nil {
+		return a.authenticate(ctx, creds)
+	}
+
+	keys := lockoutKeys(opts, creds.GetUsername(), ip)
+	now := time.Now()
+	for _, key := range keys {
+		locked, err := a.locked(ctx, key, now)
+		if err != nil {
+			return nil, err
+		}
+		if locked {
+			return nil, ErrAccountLocked
+		}
+	}
+
+	user, err := a.authenticate(ctx, creds)
+	if errors.Is(err, ErrInvalidCredentials) {
+		for _, key := range keys {
+			if _, err := store.RecordFailure(ctx, key.name, now); err != nil {
+				return nil, err
+			}
+		}
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+//resetAttempts forgets the failed attempts of username when lockout is enabled
+func (a *Authenticator) resetAttempts(ctx context.Context, username string) error {
+	store, opts := a.lockoutSettings()
+	if store == nil || opts.Username.MaxAttempts < 1 {
+		return nil
+	}
+	return store.ResetAttempts(ctx, usernameKey(username))
+}
+
+func usernameKey(username string) string {
+	return "username:" + strings.ToLower(username)
+}
+
+type lockoutKey struct {
+	name   string
+	policy LockoutPolicy
+}
+
+//lockoutKeys returns the keys to track for a login, leaving out those whose policy is disabled
+func lockoutKeys(opts LockoutOptions, username, ip string) []lockoutKey {
+	var keys []lockoutKey
+	if opts.Username.MaxAttempts > 0 {
+		keys = append(keys, lockoutKey{name: usernameKey(username), policy: opts.Username})
+	}
+	if ip != "" && opts.IP.MaxAttempts > 0 {
+		keys = append(keys, lockoutKey{name: "ip:" + ip, policy: opts.IP})
+	}
+	return keys
+}
+
+//locked reports whether key is locked at now, forgetting failures that are outside the policy window
+func (a *Authenticator) locked(ctx context.Context, key lockoutKey, now time.Time) (bool, error) {
+	store, _ := a.lockoutSettings()
+	failures, last, err := store.GetAttempts(ctx, key.name)
+	if err != nil || failures == 0 {
+		return false, err
+	}
+	if key.policy.Window > 0 && now.Sub(last) > key.policy.Window {
+		return false, store.ResetAttempts(ctx, key.name)
+	}
+	if key.policy.MaxAttempts < 1 || failures < key.policy.MaxAttempts {
+		return false, nil
+	}
+	return now.Before(last.Add(key.policy.lockout(failures))), nil
+}
+
+//lockout returns how long a key with the provided number of failures stays locked
+func (p LockoutPolicy) lockout(failures int) time.Duration {
+	delay := p.Delay
+	for i := p.MaxAttempts; i < failures; i++ {
+		delay *= 2
+		if p.MaxDelay > 0 && delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return delay
+}
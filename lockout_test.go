@@ -0,0 +1,119 @@
+package juno
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockAttemptStore struct {
+	failures map[string]int
+	last     map[string]time.Time
+}
+
+func newMockAttemptStore() *mockAttemptStore {
+	return &mockAttemptStore{failures: make(map[string]int), last: make(map[string]time.Time)}
+}
+
+func (s *mockAttemptStore) GetAttempts(ctx context.Context, key string) (int, time.Time, error) {
+	return s.failures[key], s.last[key], nil
+}
+
+func (s *mockAttemptStore) RecordFailure(ctx context.Context, key string, at time.Time) (int, error) {
+	s.failures[key]++
+	s.last[key] = at
+	return s.failures[key], nil
+}
+
+func (s *mockAttemptStore) ResetAttempts(ctx context.Context, key string) error {
+	delete(s.failures, key)
+	delete(s.last, key)
+	return nil
+}
+
+func TestLockoutPolicyBackoff(t *testing.T) {
+	assert := assert.New(t)
+
+	policy := LockoutPolicy{MaxAttempts: 3, Delay: time.Second, MaxDelay: 5 * time.Second}
+	assert.Equal(time.Second, policy.lockout(3))
+	assert.Equal(2*time.Second, policy.lockout(4), "Every failure past MaxAttempts should double the lockout")
+	assert.Equal(4*time.Second, policy.lockout(5))
+	assert.Equal(5*time.Second, policy.lockout(6), "The lockout should be capped by MaxDelay")
+	assert.Equal(5*time.Second, policy.lockout(100))
+}
+
+func TestAuthenticateLockout(t *testing.T) {
+	assert := assert.New(t)
+
+	hash, _ := NewBcryptHasher(4).Hash("s3cret")
+	repo := &rehashingUserAuthRepo{user: &StdUser{UserID: 1, Email: "test@juno.com", Password: hash}}
+	authenticator := NewAuthenticator(repo, NewBcryptHasher(4))
+	store := newMockAttemptStore()
+	authenticator.EnableLockout(store, LockoutOptions{
+		Username: LockoutPolicy{MaxAttempts: 2, Delay: 50 * time.Millisecond},
+		IP:       LockoutPolicy{MaxAttempts: 3, Delay: time.Hour},
+	})
+
+	req := httptest.NewRequest("POST", "/login", nil)
+	req.RemoteAddr = "10.0.0.1:5000"
+
+	for i := 0; i < 2; i++ {
+		_, err := authenticator.AuthenticateRequest(req, mockCredentials{"test@juno.com", "wrong"})
+		assert.Equal(ErrInvalidCredentials, err)
+	}
+	_, err := authenticator.AuthenticateRequest(req, mockCredentials{"TEST@juno.com", "s3cret"})
+	assert.Equal(ErrAccountLocked, err, "The username should be locked regardless of case, even with the correct password")
+	assert.Equal(2, store.failures["ip:10.0.0.1"], "Failures should also be tracked by ip")
+
+	time.Sleep(60 * time.Millisecond)
+	user, err := authenticator.AuthenticateRequest(req, mockCredentials{"test@juno.com", "s3cret"})
+	assert.NoError(err, "The username should be unlocked once the lockout has passed")
+	assert.Equal(1, user.ID())
+	assert.Equal(0, store.failures["username:test@juno.com"], "A successful login should reset the username failures")
+	assert.Equal(2, store.failures["ip:10.0.0.1"], "A successful login should not reset the ip failures")
+
+	_, err = authenticator.AuthenticateRequest(req, mockCredentials{"other@juno.com", "wrong"})
+	assert.Equal(ErrInvalidCredentials, err)
+	_, err = authenticator.AuthenticateRequest(req, mockCredentials{"test@juno.com", "s3cret"})
+	assert.Equal(ErrAccountLocked, err, "The ip should be locked after too many failures across usernames")
+
+	_, err = authenticator.Authenticate(mockCredentials{"test@juno.com", "s3cret"})
+	assert.NoError(err, "Logins without a client ip are only tracked by username")
+}
+
+type missingUserAuthRepo struct{}
+
+func (repo missingUserAuthRepo) GetUserByCredentials(creds Credentials) (User, error) {
+	return nil, fmt.Errorf("No user named %s: %w", creds.GetUsername(), ErrUserNotFound)
+}
+
+func (repo missingUserAuthRepo) GetUserFromSession(s Session) (User, error) {
+	return nil, ErrUserNotFound
+}
+
+func TestAuthenticateUserNotFound(t *testing.T) {
+	assert := assert.New(t)
+
+	authenticator := NewAuthenticator(missingUserAuthRepo{}, NewBcryptHasher(4))
+	_, err := authenticator.Authenticate(mockCredentials{"nobody@juno.com", "s3cret"})
+	assert.Equal(ErrInvalidCredentials, err, "Unknown usernames should be reported as invalid credentials")
+
+	store := newMockAttemptStore()
+	authenticator.EnableLockout(store, LockoutOptions{Username: LockoutPolicy{MaxAttempts: 1, Delay: time.Hour}})
+	_, err = authenticator.Authenticate(mockCredentials{"nobody@juno.com", "s3cret"})
+	assert.Equal(ErrInvalidCredentials, err, "Unknown usernames should be reported the same way with lockout enabled")
+	_, err = authenticator.Authenticate(mockCredentials{"nobody@juno.com", "s3cret"})
+	assert.Equal(ErrAccountLocked, err, "Unknown usernames should be locked like known ones")
+
+	store = newMockAttemptStore()
+	authenticator.EnableLockout(store, LockoutOptions{IP: LockoutPolicy{MaxAttempts: 3, Delay: time.Hour}})
+	_, err = authenticator.AuthenticateFrom(context.Background(), mockCredentials{"nobody@juno.com", "s3cret"}, "10.0.0.1")
+	assert.Equal(ErrInvalidCredentials, err)
+	assert.Equal(1, store.failures["ip:10.0.0.1"])
+	_, tracked := store.failures["username:nobody@juno.com"]
+	assert.False(tracked, "Usernames should not be tracked when their policy is disabled")
+}
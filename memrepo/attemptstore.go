@@ -0,0 +1,53 @@
+package memrepo
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+//NewAttemptStore is a factory constructor for an in memory juno.AttemptStore
+func NewAttemptStore() *AttemptStore {
+	return &AttemptStore{
+		attempts: make(map[string]attempt),
+	}
+}
+
+//AttemptStore is a thread safe, in memory implementation of juno.AttemptStore.
+//Failures are not shared between processes, so it is intended for single instance deployments.
+type AttemptStore struct {
+	sync.Mutex
+	attempts map[string]attempt
+}
+
+type attempt struct {
+	failures int
+	last     time.Time
+}
+
+//GetAttempts returns the number of failures recorded for key and the time of the last one
+func (s *AttemptStore) GetAttempts(ctx context.Context, key string) (int, time.Time, error) {
+	s.Lock()
+	defer s.Unlock()
+	a := s.attempts[key]
+	return a.failures, a.last, nil
+}
+
+//RecordFailure adds a failure at the provided time for key, returning the new number of failures
+func (s *AttemptStore) RecordFailure(ctx context.Context, key string, at time.Time) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+	a := s.attempts[key]
+	a.failures++
+	a.last = at
+	s.attempts[key] = a
+	return a.failures, nil
+}
+
+//ResetAttempts forgets every failure recorded for key
+func (s *AttemptStore) ResetAttempts(ctx context.Context, key string) error {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.attempts, key)
+	return nil
+}
@@ -0,0 +1,35 @@
+package memrepo
+
+import (
+	"context"
+	"sync"
+
+	"github.com/syllabix/juno"
+)
+
+//NewAuditSink is a factory constructor for an in memory juno.AuditSink
+func NewAuditSink() *AuditSink {
+	return &AuditSink{}
+}
+
+//AuditSink is a thread safe, in memory implementation of juno.AuditSink.
+//Events do not survive a restart, so it is intended for local development and testing.
+type AuditSink struct {
+	sync.RWMutex
+	events []juno.AuditEvent
+}
+
+//WriteAuditEvent appends e to the recorded events
+func (s *AuditSink) WriteAuditEvent(ctx context.Context, e juno.AuditEvent) error {
+	s.Lock()
+	defer s.Unlock()
+	s.events = append(s.events, e)
+	return nil
+}
+
+//Events returns a copy of every recorded event, oldest first
+func (s *AuditSink) Events() []juno.AuditEvent {
+	s.RLock()
+	defer s.RUnlock()
+	return append([]juno.AuditEvent(nil), s.events...)
+}
@@ -0,0 +1,30 @@
+package memrepo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/syllabix/juno"
+)
+
+func TestAuditSink(t *testing.T) {
+	assert := assert.New(t)
+
+	sink := NewAuditSink()
+	audit := juno.NewAuditLog(sink)
+	ctx := juno.WithActor(context.Background(), "1")
+	audit.Record(ctx, juno.AuditEvent{Type: juno.AuditRoleCreate, RoleID: "2", Success: true})
+	audit.Record(ctx, juno.AuditEvent{Type: juno.AuditLogin, Username: "test@juno.com"})
+
+	events := sink.Events()
+	if assert.Len(events, 2) {
+		assert.Equal(juno.AuditRoleCreate, events[0].Type)
+		assert.Equal("1", events[0].Actor)
+		assert.Equal(juno.AuditLogin, events[1].Type)
+	}
+
+	events[0].Type = "changed"
+	assert.Equal(juno.AuditRoleCreate, sink.Events()[0].Type, "Events should return a copy")
+}
@@ -0,0 +1,67 @@
+package memrepo
+
+import (
+	"context"
+	"sync"
+
+	"github.com/syllabix/juno"
+)
+
+//NewRefreshTokenStore is a factory constructor for an in memory juno.RefreshTokenStore
+func NewRefreshTokenStore() *RefreshTokenStore {
+	return &RefreshTokenStore{
+		tokens: make(map[string]juno.RefreshToken),
+	}
+}
+
+//RefreshTokenStore is a thread safe, in memory implementation of juno.RefreshTokenStore.
+//It is intended for local development and testing, as tokens do not survive a restart.
+type RefreshTokenStore struct {
+	sync.Mutex
+	tokens map[string]juno.RefreshToken
+}
+
+//CreateRefreshToken stores a new refresh token
+func (s *RefreshTokenStore) CreateRefreshToken(ctx context.Context, t juno.RefreshToken) error {
+	s.Lock()
+	defer s.Unlock()
+	s.tokens[t.Hash] = t
+	return nil
+}
+
+//GetRefreshToken returns the token with the provided hash, or juno.ErrInvalidRefreshToken
+func (s *RefreshTokenStore) GetRefreshToken(ctx context.Context, hash string) (*juno.RefreshToken, error) {
+	s.Lock()
+	defer s.Unlock()
+	t, ok := s.tokens[hash]
+	if !ok {
+		return nil, juno.ErrInvalidRefreshToken
+	}
+	return &t, nil
+}
+
+//UseRefreshToken marks the token as used, reporting false if it already was
+func (s *RefreshTokenStore) UseRefreshToken(ctx context.Context, hash string) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+	t, ok := s.tokens[hash]
+	if !ok || t.Used {
+		return false, nil
+	}
+	t.Used = true
+	s.tokens[hash] = t
+	return true, nil
+}
+
+//RevokeRefreshTokenFamily revokes every token in the family
+func (s *RefreshTokenStore) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	s.Lock()
+	defer s.Unlock()
+	for hash, t := range s.tokens {
+		if t.FamilyID == familyID {
+			t.Revoked = true
+			s.tokens[hash] = t
+		}
+	}
+	return nil
+}
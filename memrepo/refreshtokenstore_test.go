@@ -0,0 +1,55 @@
+package memrepo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/syllabix/juno"
+)
+
+type userAuthRepo struct {
+	user *juno.StdUser
+}
+
+func (repo *userAuthRepo) GetUserByCredentials(creds juno.Credentials) (juno.User, error) {
+	return repo.user, nil
+}
+
+func (repo *userAuthRepo) GetUserFromSession(s juno.Session) (juno.User, error) {
+	return repo.user, nil
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	u := &juno.StdUser{UserID: 3}
+	authenticator := juno.NewAuthenticator(&userAuthRepo{user: u})
+	assert.NoError(authenticator.EnableTokens(juno.TokenOptions{}, juno.TokenKey{ID: "k", Algorithm: juno.HS256, Key: []byte("0123456789abcdef0123456789abcdef")}))
+	store := NewRefreshTokenStore()
+	authenticator.EnableRefreshTokens(store, 0)
+
+	first, err := authenticator.IssueRefreshToken(ctx, u)
+	assert.NoError(err)
+
+	access, second, err := authenticator.Refresh(ctx, first)
+	assert.NoError(err)
+	assert.NotEqual(first, second, "The refresh token should be rotated on every use")
+	claims, err := authenticator.VerifyToken(access)
+	assert.NoError(err)
+	assert.Equal(3, claims.UserID)
+
+	_, _, err = authenticator.Refresh(ctx, first)
+	assert.Equal(juno.ErrRefreshTokenReused, err, "A rotated refresh token should not be accepted again")
+	_, _, err = authenticator.Refresh(ctx, second)
+	assert.Equal(juno.ErrInvalidRefreshToken, err, "Reusing a rotated token should revoke the whole family")
+
+	other, _ := authenticator.IssueRefreshToken(ctx, u)
+	_, _, err = authenticator.Refresh(ctx, other)
+	assert.NoError(err, "Other families should not be affected by a revocation")
+
+	_, _, err = authenticator.Refresh(ctx, "unknown")
+	assert.Equal(juno.ErrInvalidRefreshToken, err)
+}
@@ -0,0 +1,306 @@
+package memrepo
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/satori/go.uuid"
+
+	"github.com/syllabix/juno"
+)
+
+//SweepInterval is how often a SessionProvider evicts expired sessions
+const SweepInterval = time.Minute
+
+//NewSessionProvider is a factory constructor used to create a useful instance of SessionProvider.
+//The returned provider runs a background sweeper until Close is called.
+func NewSessionProvider(cookieProvider juno.CookieProvider, duration ...time.Duration) *SessionProvider {
+	return NewSessionProviderContext(context.Background(), cookieProvider, duration...)
+}
+
+//NewSessionProviderContext is the same as NewSessionProvider, but also stops the background sweeper when ctx is done
+func NewSessionProviderContext(ctx context.Context, cookieProvider juno.CookieProvider, duration ...time.Duration) *SessionProvider {
+
+	var dur time.Duration
+	if len(duration) < 1 {
+		dur = time.Minute * 30
+	} else {
+		dur = duration[0]
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	sp := &SessionProvider{
+		cookie:   cookieProvider,
+		duration: dur,
+		sessions: make(map[string]*juno.StdSession),
+		seen:     make(map[string]juno.SessionInfo),
+		now:      time.Now,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	go sp.run(ctx, SweepInterval)
+	return sp
+}
+
+//SessionProvider is a thread safe, in memory implementation of juno.SessionProvider.
+//It is intended for local development and testing, as sessions do not survive a restart.
+type SessionProvider struct {
+	sync.RWMutex
+	cookie   juno.CookieProvider
+	duration time.Duration
+	absolute time.Duration
+	sessions map[string]*juno.StdSession
+	seen     map[string]juno.SessionInfo
+	now      func() time.Time
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+//SetAbsoluteTimeout limits how long a session lasts after it was started, however active it is.
+//The duration passed to the constructor remains the idle timeout.
+func (sp *SessionProvider) SetAbsoluteTimeout(absolute time.Duration) {
+	sp.Lock()
+	defer sp.Unlock()
+	sp.absolute = absolute
+}
+
+func (sp *SessionProvider) run(ctx context.Context, interval time.Duration) {
+	defer close(sp.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sp.sweep()
+		}
+	}
+}
+
+//sweep evicts every expired session from the provider
+func (sp *SessionProvider) sweep() {
+	sp.Lock()
+	defer sp.Unlock()
+	for id, session := range sp.sessions {
+		if sp.expired(session) {
+			delete(sp.sessions, id)
+			delete(sp.seen, id)
+		}
+	}
+}
+
+//Close stops the background sweeper and waits for it to exit
+func (sp *SessionProvider) Close() error {
+	sp.cancel()
+	<-sp.done
+	return nil
+}
+
+//GetSession tries to retrieve an existing session, if it fails, it creates one. If session creation failed, it returns an error.
+//The client ip, user agent and last seen time are recorded with the session, the last seen time at most once every
+//juno.LastSeenInterval.
+func (sp *SessionProvider) GetSession(req *http.Request) (juno.Session, error) {
+	baseSession, err := sp.cookie.Read(req)
+	if err != nil {
+		return sp.newSession(req)
+	}
+
+	id := baseSession.SessionID()
+	sp.RLock()
+	stored, exists := sp.sessions[id]
+	if !exists || sp.expired(stored) {
+		sp.RUnlock()
+		return sp.newSession(req)
+	}
+	session := copySession(stored.ID, stored.Created, stored.Expiration, stored.Store())
+	outdated := sp.seen[id].Outdated(req)
+	sp.RUnlock()
+
+	if outdated {
+		sp.Lock()
+		if _, exists := sp.sessions[id]; exists {
+			sp.see(id, req)
+		}
+		sp.Unlock()
+	}
+	return session, nil
+}
+
+func (sp *SessionProvider) newSession(req *http.Request) (juno.Session, error) {
+	session := juno.NewStdSession(sp.duration)
+	err := sp.SetSession(session)
+	if err == nil {
+		sp.Lock()
+		sp.see(session.SessionID(), req)
+		sp.Unlock()
+	}
+	return session, err
+}
+
+//see records the request metadata of a session. It is to be called with the lock held.
+func (sp *SessionProvider) see(id string, req *http.Request) {
+	sp.seen[id] = juno.SessionInfo{
+		LastSeen:  sp.now(),
+		IPAddress: juno.ClientIP(req),
+		UserAgent: req.UserAgent(),
+	}
+}
+
+//SetSession creates a new session and stores it in memory
+func (sp *SessionProvider) SetSession(s juno.Session) error {
+	id, err := uuid.FromString(s.SessionID())
+	if err != nil {
+		return juno.ErrInvalidSessionID
+	}
+	created := sp.now()
+	if std, err := juno.AsStdSession(s); err == nil && !std.Created.IsZero() {
+		created = std.Created
+	}
+
+	sp.Lock()
+	defer sp.Unlock()
+	exp := juno.SessionExpiration(sp.now(), created, sp.duration, sp.absolute)
+	sp.sessions[s.SessionID()] = copySession(id, created, exp, s.Store())
+	return nil
+}
+
+//UpdateSession updates the session expiration and contents if dirty
+func (sp *SessionProvider) UpdateSession(s juno.Session) error {
+	sp.Lock()
+	defer sp.Unlock()
+	stored, exists := sp.sessions[s.SessionID()]
+	if !exists {
+		return juno.ErrSessionExpired
+	}
+	exp := juno.SessionExpiration(sp.now(), stored.Created, sp.duration, sp.absolute)
+	session := copySession(stored.ID, stored.Created, exp, stored.Store())
+	if s.StoreDirty() {
+		session.ReplaceStore(copyStore(s.Store()))
+	}
+	sp.sessions[s.SessionID()] = session
+	return nil
+}
+
+//EndSession terminates a session by removing it from memory and invalidating the cookie
+func (sp *SessionProvider) EndSession(w http.ResponseWriter, s juno.Session) error {
+	sp.cookie.Invalidate(w)
+	sp.Lock()
+	defer sp.Unlock()
+	delete(sp.sessions, s.SessionID())
+	delete(sp.seen, s.SessionID())
+	return nil
+}
+
+//RegenerateSession gives the session a new id, moving its stored copy, and rewrites the cookie
+func (sp *SessionProvider) RegenerateSession(w http.ResponseWriter, s juno.Session) error {
+	session, err := juno.AsStdSession(s)
+	if err != nil {
+		return err
+	}
+	id := uuid.NewV4()
+
+	sp.Lock()
+	created := sp.now()
+	if stored, exists := sp.sessions[s.SessionID()]; exists {
+		//the new id keeps the start time, so regenerating does not extend the absolute timeout
+		created = stored.Created
+	}
+	exp := juno.SessionExpiration(sp.now(), created, sp.duration, sp.absolute)
+	delete(sp.sessions, s.SessionID())
+	sp.sessions[id.String()] = copySession(id, created, exp, s.Store())
+	sp.seen[id.String()] = sp.seen[s.SessionID()]
+	delete(sp.seen, s.SessionID())
+	sp.Unlock()
+
+	session.ID = id
+	session.Created = created
+	session.Expiration = exp
+	return sp.cookie.Set(w, session)
+}
+
+//ListUserSessions returns the active sessions of a user, most recently seen first
+func (sp *SessionProvider) ListUserSessions(ctx context.Context, userID int) ([]juno.SessionInfo, error) {
+	sp.RLock()
+	defer sp.RUnlock()
+	var sessions []juno.SessionInfo
+	for id, session := range sp.sessions {
+		if uid, ok := juno.SessionUserID(session); !ok || uid != userID || sp.expired(session) {
+			continue
+		}
+		info := sp.seen[id]
+		info.SessionID = id
+		info.UserID = userID
+		info.Created = session.Created
+		info.Expiration = session.Expiration
+		sessions = append(sessions, info)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeen.After(sessions[j].LastSeen)
+	})
+	return sessions, nil
+}
+
+//EndUserSession ends one session of a user. Sessions of other users are not affected.
+func (sp *SessionProvider) EndUserSession(ctx context.Context, userID int, sessionID string) error {
+	sp.Lock()
+	defer sp.Unlock()
+	if session, exists := sp.sessions[sessionID]; exists {
+		if uid, ok := juno.SessionUserID(session); ok && uid == userID {
+			delete(sp.sessions, sessionID)
+			delete(sp.seen, sessionID)
+		}
+	}
+	return nil
+}
+
+//EndUserSessions ends every session of a user except the provided session ids, such as the current one
+func (sp *SessionProvider) EndUserSessions(ctx context.Context, userID int, except ...string) error {
+	sp.Lock()
+	defer sp.Unlock()
+outer:
+	for id, session := range sp.sessions {
+		if uid, ok := juno.SessionUserID(session); !ok || uid != userID {
+			continue
+		}
+		for _, keep := range except {
+			if id == keep {
+				continue outer
+			}
+		}
+		delete(sp.sessions, id)
+		delete(sp.seen, id)
+	}
+	return nil
+}
+
+//expired reports whether session is past its expiration at the provider's clock
+func (sp *SessionProvider) expired(session *juno.StdSession) bool {
+	return sp.now().After(session.Expiration)
+}
+
+//WriteCookie sets the session id on the cookie
+func (sp *SessionProvider) WriteCookie(w http.ResponseWriter, s juno.Session) error {
+	return sp.cookie.Set(w, s)
+}
+
+//copySession returns a new StdSession so callers never share a store with the provider
+func copySession(id uuid.UUID, created, expiration time.Time, store map[string]interface{}) *juno.StdSession {
+	session := new(juno.StdSession)
+	session.ID = id
+	session.Created = created
+	session.Expiration = expiration
+	session.ReplaceStore(copyStore(store))
+	return session
+}
+
+func copyStore(store map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(store))
+	for k, v := range store {
+		copied[k] = v
+	}
+	return copied
+}
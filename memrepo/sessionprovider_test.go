@@ -0,0 +1,195 @@
+package memrepo
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/syllabix/juno"
+)
+
+var cookieProvider = juno.NewStdCookieProvider(securecookie.GenerateRandomKey(32), securecookie.GenerateRandomKey(32), "test-cookie")
+
+func requestWithCookie(sp *SessionProvider, s juno.Session) *http.Request {
+	recorder := httptest.NewRecorder()
+	sp.WriteCookie(recorder, s)
+	return &http.Request{Header: http.Header{"Cookie": recorder.HeaderMap["Set-Cookie"]}}
+}
+
+func TestSessionProviderRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	sp := NewSessionProvider(cookieProvider)
+	defer sp.Close()
+
+	session, err := sp.GetSession(&http.Request{})
+	assert.NoError(err, "A request without a cookie should get a brand new session")
+
+	session.Set(juno.USER_ID_SESSION_KEY, 120)
+	assert.NoError(sp.UpdateSession(session), "Updating a stored session should work without error")
+
+	loaded, err := sp.GetSession(requestWithCookie(sp, session))
+	assert.NoError(err)
+	assert.Equal(session.SessionID(), loaded.SessionID(), "A request carrying the session cookie should load the stored session")
+	userID, found := loaded.Get(juno.USER_ID_SESSION_KEY)
+	assert.True(found, "Values set on a dirty session should be persisted by UpdateSession")
+	assert.Equal(120, userID)
+
+	loaded.Set("unsaved", true)
+	reloaded, _ := sp.GetSession(requestWithCookie(sp, session))
+	_, found = reloaded.Get("unsaved")
+	assert.False(found, "Values should not be shared with the provider until UpdateSession is called")
+
+	recorder := httptest.NewRecorder()
+	assert.NoError(sp.EndSession(recorder, loaded))
+	ended, _ := sp.GetSession(requestWithCookie(sp, session))
+	assert.NotEqual(session.SessionID(), ended.SessionID(), "An ended session should not be loaded again")
+}
+
+func TestSessionProviderSweep(t *testing.T) {
+	assert := assert.New(t)
+
+	sp := NewSessionProvider(cookieProvider, -time.Second)
+	defer sp.Close()
+
+	assert.NoError(sp.SetSession(juno.NewStdSession()))
+	assert.Equal(1, len(sp.sessions))
+	sp.sweep()
+	assert.Equal(0, len(sp.sessions), "Expired sessions should be evicted by the sweeper")
+}
+
+func TestSessionProviderContextCancel(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sp := NewSessionProviderContext(ctx, cookieProvider)
+	cancel()
+
+	select {
+	case <-sp.done:
+	case <-time.After(time.Second):
+		assert.Fail("The sweeper should stop when its context is cancelled")
+	}
+}
+
+func TestSessionProviderRegenerate(t *testing.T) {
+	assert := assert.New(t)
+
+	sp := NewSessionProvider(cookieProvider)
+	defer sp.Close()
+
+	session, _ := sp.GetSession(&http.Request{})
+	session.Set(juno.USER_ID_SESSION_KEY, 120)
+	sp.UpdateSession(session)
+	oldReq := requestWithCookie(sp, session)
+	oldID := session.SessionID()
+
+	assert.NoError(sp.RegenerateSession(httptest.NewRecorder(), session))
+	assert.NotEqual(oldID, session.SessionID(), "The session should be given a new id")
+
+	loaded, _ := sp.GetSession(requestWithCookie(sp, session))
+	assert.Equal(session.SessionID(), loaded.SessionID())
+	userID, _ := loaded.Get(juno.USER_ID_SESSION_KEY)
+	assert.Equal(120, userID, "The store should be moved to the new id")
+
+	stale, _ := sp.GetSession(oldReq)
+	assert.NotEqual(oldID, stale.SessionID(), "The old id should no longer load the session")
+	_, found := stale.Get(juno.USER_ID_SESSION_KEY)
+	assert.False(found)
+}
+
+func TestSessionProviderAbsoluteTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	sp := NewSessionProvider(cookieProvider, time.Hour)
+	defer sp.Close()
+	sp.SetAbsoluteTimeout(90 * time.Minute)
+	clock := time.Now()
+	sp.now = func() time.Time { return clock }
+
+	session, _ := sp.GetSession(&http.Request{})
+	req := requestWithCookie(sp, session)
+	created := session.(*juno.StdSession).Created
+
+	clock = clock.Add(50 * time.Minute)
+	assert.NoError(sp.UpdateSession(session))
+	loaded, _ := sp.GetSession(req)
+	assert.Equal(session.SessionID(), loaded.SessionID())
+	assert.Equal(created.Add(90*time.Minute), loaded.(*juno.StdSession).Expiration, "The idle expiration should be capped by the absolute timeout")
+
+	clock = clock.Add(50 * time.Minute)
+	assert.NoError(sp.UpdateSession(loaded))
+	loaded, _ = sp.GetSession(req)
+	assert.NotEqual(session.SessionID(), loaded.SessionID(), "An active session should still end at the absolute timeout")
+}
+
+func TestSessionProviderUserSessions(t *testing.T) {
+	assert := assert.New(t)
+
+	sp := NewSessionProvider(cookieProvider)
+	defer sp.Close()
+
+	var sessions []juno.Session
+	for i := 0; i < 3; i++ {
+		req := &http.Request{Header: http.Header{"User-Agent": []string{"test-agent"}}, RemoteAddr: "10.0.0.1:5000"}
+		session, err := sp.GetSession(req)
+		assert.NoError(err)
+		session.Set(juno.USER_ID_SESSION_KEY, 120)
+		assert.NoError(sp.UpdateSession(session))
+		sessions = append(sessions, session)
+	}
+	other, _ := sp.GetSession(&http.Request{})
+	other.Set(juno.USER_ID_SESSION_KEY, 121)
+	assert.NoError(sp.UpdateSession(other))
+
+	listed, err := sp.ListUserSessions(context.Background(), 120)
+	assert.NoError(err)
+	assert.Equal(3, len(listed), "Only the sessions of the user should be listed")
+	assert.Equal("10.0.0.1", listed[0].IPAddress, "The client ip should be recorded")
+	assert.Equal("test-agent", listed[0].UserAgent, "The user agent should be recorded")
+
+	assert.NoError(sp.EndUserSession(context.Background(), 121, sessions[0].SessionID()))
+	listed, _ = sp.ListUserSessions(context.Background(), 120)
+	assert.Equal(3, len(listed), "A session should not be ended on behalf of another user")
+
+	assert.NoError(sp.EndUserSession(context.Background(), 120, sessions[0].SessionID()))
+	listed, _ = sp.ListUserSessions(context.Background(), 120)
+	assert.Equal(2, len(listed), "The session should be ended")
+
+	assert.NoError(sp.EndUserSessions(context.Background(), 120, sessions[2].SessionID()))
+	listed, _ = sp.ListUserSessions(context.Background(), 120)
+	assert.Equal(1, len(listed), "Every session except the current one should be ended")
+	assert.Equal(sessions[2].SessionID(), listed[0].SessionID)
+
+	listed, _ = sp.ListUserSessions(context.Background(), 121)
+	assert.Equal(1, len(listed), "Sessions of other users should not be affected")
+}
+
+func TestSessionProviderLastSeen(t *testing.T) {
+	assert := assert.New(t)
+
+	sp := NewSessionProvider(cookieProvider)
+	defer sp.Close()
+
+	session, err := sp.GetSession(&http.Request{RemoteAddr: "10.0.0.1:5000"})
+	assert.NoError(err)
+	req := requestWithCookie(sp, session)
+	req.RemoteAddr = "10.0.0.1:5000"
+
+	seen := time.Now().Add(-time.Second)
+	sp.seen[session.SessionID()] = juno.SessionInfo{LastSeen: seen, IPAddress: "10.0.0.1"}
+	_, err = sp.GetSession(req)
+	assert.NoError(err)
+	assert.Equal(seen, sp.seen[session.SessionID()].LastSeen, "A recently seen session should not be written")
+
+	req.RemoteAddr = "10.0.0.2:5000"
+	_, err = sp.GetSession(req)
+	assert.NoError(err)
+	assert.Equal("10.0.0.2", sp.seen[session.SessionID()].IPAddress, "A change of ip should be recorded immediately")
+	assert.True(sp.seen[session.SessionID()].LastSeen.After(seen))
+}
@@ -0,0 +1,224 @@
+package juno
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type (
+	//SecondFactorRepo is to be implemented by the store of users' TOTP secrets and recovery codes
+	SecondFactorRepo interface {
+		//GetTOTP returns the user's TOTP secret and the last accepted step, or ErrSecondFactorNotEnrolled
+		GetTOTP(ctx context.Context, userID int) (secret string, lastStep int64, err error)
+		//SetTOTPStep stores the last accepted step. It must return ErrCodeReused if step is not greater than the stored step,
+		//so concurrent logins cannot replay a code.
+		SetTOTPStep(ctx context.Context, userID int, step int64) error
+		//ConsumeRecoveryCode deletes the user's recovery code with the provided hash, reporting whether it existed
+		ConsumeRecoveryCode(ctx context.Context, userID int, hash string) (bool, error)
+	}
+)
+
+var (
+	//ErrSecondFactorRequired is returned by BeginLogin when the password was verified and a code must be checked with CompleteLogin
+	ErrSecondFactorRequired = errors.New("A second factor is required to complete the login.")
+	//ErrSecondFactorNotEnrolled is to be returned by a SecondFactorRepo for users without a TOTP secret
+	ErrSecondFactorNotEnrolled = errors.New("The user has not enrolled a second factor.")
+	//ErrNoPendingLogin is returned by CompleteLogin when the session is not waiting for a second factor, or waited too long
+	ErrNoPendingLogin = errors.New("There is no login waiting for a second factor.")
+	//ErrInvalidCode is returned when a one time password or recovery code is not valid
+	ErrInvalidCode = errors.New("The provided code is not valid.")
+	//ErrCodeReused is returned when a one time password that was already accepted is used again
+	ErrCodeReused = errors.New("The provided code has already been used.")
+	//ErrInvalidTOTPSecret is returned when a TOTP secret is not valid base32
+	ErrInvalidTOTPSecret = errors.New("The TOTP secret is not valid.")
+
+	errSecondFactorAttempts = errors.New("Second factor attempts cannot be limited without an AttemptStore, lockout must be enabled")
+)
+
+const (
+	//MFA_PENDING_SESSION_KEY holds the id of a user whose password was verified while the second factor is pending
+	MFA_PENDING_SESSION_KEY = "mfapending"
+	mfaPendingSinceKey      = "mfapendingsince"
+	mfaPendingUsernameKey   = "mfapendingusername"
+
+	//SecondFactorTimeout is how long a session waits for the second factor after the password was verified
+	SecondFactorTimeout = 5 * time.Minute
+	//MaxSecondFactorAttempts is the number of invalid codes after which the pending login is abandoned
+	//and the user's second factor is locked
+	MaxSecondFactorAttempts = 5
+)
+
+//secondFactorPolicy locks a user's second factor for SecondFactorTimeout once MaxSecondFactorAttempts invalid codes
+//were entered, doubling for every further invalid code
+var secondFactorPolicy = LockoutPolicy{MaxAttempts: MaxSecondFactorAttempts, Delay: SecondFactorTimeout, MaxDelay: 24 * time.Hour}
+
+//EnableSecondFactor makes BeginLogin require a TOTP code, or a recovery code, from users enrolled in repo.
+//Invalid codes are counted by user id in the AttemptStore set with EnableLockout, which is required for enrolled users.
+func (a *Authenticator) EnableSecondFactor(repo SecondFactorRepo, totp *TOTP) error {
+	if totp == nil {
+		return errors.New("A TOTP is required to enable the second factor")
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.secondFactor = repo
+	a.totp = totp
+	return nil
+}
+
+//secondFactorSettings returns the SecondFactorRepo and TOTP set with EnableSecondFactor
+func (a *Authenticator) secondFactorSettings() (SecondFactorRepo, *TOTP) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.secondFactor, a.totp
+}
+
+//BeginLogin authenticates creds and marks s as logged in. For users enrolled in a second factor, s is instead marked
+//as password verified with the second factor pending, and ErrSecondFactorRequired is returned.
+//SessionProvider.RegenerateSession is to be called once the user is logged in, to prevent session fixation.
+//The CSRF secret of s is rotated on login, so new tokens are to be issued. The failed attempts of the username are
+//only cleared once the login is complete. Failed attempts are also tracked for the ip of req.RemoteAddr, as with
+//AuthenticateRequest.
+func (a *Authenticator) BeginLogin(req *http.Request, s Session, creds Credentials) (User, error) {
+	return a.BeginLoginFrom(req.Context(), s, creds, ClientIP(req))
+}
+
+//BeginLoginFrom is the same as BeginLogin, tracking failed attempts for the provided client ip, such as one taken
+//from a trusted proxy header
+func (a *Authenticator) BeginLoginFrom(ctx context.Context, s Session, creds Credentials, ip string) (User, error) {
+	user, err := a.checkPassword(ctx, creds, ip)
+	if err != nil {
+		return nil, err
+	}
+	a.clearPending(s)
+
+	if repo, _ := a.secondFactorSettings(); repo != nil {
+		_, _, err = repo.GetTOTP(ctx, user.ID())
+		if err == nil {
+			if store, _ := a.lockoutSettings(); store == nil {
+				return nil, errSecondFactorAttempts
+			}
+			s.Delete(USER_ID_SESSION_KEY)
+			s.Set(MFA_PENDING_SESSION_KEY, user.ID())
+			s.Set(mfaPendingSinceKey, time.Now().Unix())
+			s.Set(mfaPendingUsernameKey, creds.GetUsername())
+			return nil, ErrSecondFactorRequired
+		}
+		if !errors.Is(err, ErrSecondFactorNotEnrolled) {
+			return nil, err
+		}
+	}
+
+	err = a.resetAttempts(ctx, creds.GetUsername())
+	if err != nil {
+		return nil, err
+	}
+	RotateCSRF(s)
+	s.Set(USER_ID_SESSION_KEY, user.ID())
+	return user, nil
+}
+
+//SecondFactorPending reports whether s is waiting for CompleteLogin
+func (a *Authenticator) SecondFactorPending(s Session) bool {
+	_, ok := s.Get(MFA_PENDING_SESSION_KEY)
+	return ok
+}
+
+//CompleteLogin checks a TOTP or recovery code for the login pending on s, marking s as logged in on success.
+//The pending login is abandoned after SecondFactorTimeout or MaxSecondFactorAttempts invalid codes. Invalid codes
+//are counted for the user rather than the session, so starting a new login does not allow more guesses, and
+//ErrAccountLocked is returned while the user's second factor is locked. Every attempt is recorded to the AuditLog set
+//with EnableAudit.
+func (a *Authenticator) CompleteLogin(ctx context.Context, s Session, code string) (User, error) {
+	userID, _ := GetInt(s, MFA_PENDING_SESSION_KEY)
+	username, _ := GetString(s, mfaPendingUsernameKey)
+	user, err := a.completeLogin(ctx, s, code)
+	a.auditLog().Record(ctx, AuditEvent{Type: AuditSecondFactor, Username: username, UserID: userID}.result(err))
+	return user, err
+}
+
+func (a *Authenticator) completeLogin(ctx context.Context, s Session, code string) (User, error) {
+	userID, ok := GetInt(s, MFA_PENDING_SESSION_KEY)
+	since, _ := GetInt(s, mfaPendingSinceKey)
+	repo, _ := a.secondFactorSettings()
+	if !ok || repo == nil || time.Since(time.Unix(int64(since), 0)) > SecondFactorTimeout {
+		a.clearPending(s)
+		return nil, ErrNoPendingLogin
+	}
+	store, _ := a.lockoutSettings()
+	if store == nil {
+		return nil, errSecondFactorAttempts
+	}
+
+	key := lockoutKey{name: "mfa:" + strconv.Itoa(userID), policy: secondFactorPolicy}
+	now := time.Now()
+	locked, err := a.locked(ctx, key, now)
+	if err != nil {
+		return nil, err
+	}
+	if locked {
+		a.clearPending(s)
+		return nil, ErrAccountLocked
+	}
+
+	err = a.verifySecondFactor(ctx, userID, code)
+	if errors.Is(err, ErrInvalidCode) || errors.Is(err, ErrCodeReused) {
+		failures, recordErr := store.RecordFailure(ctx, key.name, now)
+		if recordErr != nil {
+			return nil, recordErr
+		}
+		if failures >= MaxSecondFactorAttempts {
+			a.clearPending(s)
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	username, _ := GetString(s, mfaPendingUsernameKey)
+	a.clearPending(s)
+	err = store.ResetAttempts(ctx, key.name)
+	if err == nil {
+		err = a.resetAttempts(ctx, username)
+	}
+	if err != nil {
+		return nil, err
+	}
+	RotateCSRF(s)
+	s.Set(USER_ID_SESSION_KEY, userID)
+	return a.IsAuthenticatedSessionContext(ctx, s)
+}
+
+//verifySecondFactor accepts a TOTP code, falling back to consuming a recovery code
+func (a *Authenticator) verifySecondFactor(ctx context.Context, userID int, code string) error {
+	repo, totp := a.secondFactorSettings()
+	secret, lastStep, err := repo.GetTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+	step, err := totp.Verify(secret, code, lastStep, time.Now())
+	if err == nil {
+		return repo.SetTOTPStep(ctx, userID, step)
+	}
+	if err != ErrInvalidCode {
+		return err
+	}
+
+	used, err := repo.ConsumeRecoveryCode(ctx, userID, HashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+func (a *Authenticator) clearPending(s Session) {
+	s.Delete(MFA_PENDING_SESSION_KEY)
+	s.Delete(mfaPendingSinceKey)
+	s.Delete(mfaPendingUsernameKey)
+}
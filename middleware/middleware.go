@@ -0,0 +1,236 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/syllabix/juno"
+	"github.com/syllabix/juno/session"
+	"github.com/syllabix/juno/user"
+	"github.com/syllabix/juno/userrole"
+)
+
+//New is a factory constructor for returning a Middleware wired up to the provided session provider, authenticator and authorizer
+func New(sessions juno.SessionProvider, authenticator *juno.Authenticator, authorizer *juno.Authorizer) *Middleware {
+	return &Middleware{
+		sessions:      juno.AdaptSessionProvider(sessions),
+		authenticator: authenticator,
+		authorizer:    authorizer,
+	}
+}
+
+//Middleware wraps http.Handlers so that every request has its session, user and roles loaded into the request context,
+//the primary role with userrole.NewContext and every role with userrole.NewRolesContext, and optionally rejects
+//requests that are not granted a set of required permissions. The session cookie is written just before the response
+//headers are sent, and a failure to write it is answered with 500 in place of the handler's response.
+//Requests are also answered with 500 when the session user cannot be loaded for a reason other than
+//juno.ErrNotAuthenticated or juno.ErrUserNotFound, rather than being served as anonymous.
+type Middleware struct {
+	sessions      juno.SessionProviderContext
+	authenticator *juno.Authenticator
+	authorizer    *juno.Authorizer
+
+	mu   sync.RWMutex
+	csrf *juno.CSRF
+}
+
+//EnableCSRF rejects unsafe cookie session requests that fail csrf.Verify with 403. Bearer token requests are not checked,
+//as browsers do not attach the token to cross site requests.
+func (m *Middleware) EnableCSRF(csrf *juno.CSRF) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.csrf = csrf
+}
+
+func (m *Middleware) csrfCheck() *juno.CSRF {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.csrf
+}
+
+//Handle wraps the provided handler, loading the session (and user when authenticated) without enforcing any permissions
+func (m *Middleware) Handle(next http.Handler) http.Handler {
+	return m.handler(next, nil)
+}
+
+//Require returns a wrapper that only lets requests through when the authenticated user's roles are granted all of the provided permissions.
+//Requests without an authenticated user are rejected with 401, and requests missing a permission are rejected with 403.
+func (m *Middleware) Require(perms ...juno.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return m.handler(next, perms)
+	}
+}
+
+func (m *Middleware) handler(next http.Handler, perms []juno.Permission) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if juno.BearerToken(req) != "" && m.authenticator.TokensEnabled() && m.serveBearer(w, req, next, perms) {
+			return
+		}
+
+		s, err := m.sessions.GetSession(req)
+		if err != nil {
+			log.Println("Unable to load session:", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		//the cookie is written just before the response headers, so providers that keep the session in the cookie see the handler's changes
+		cw := &cookieWriter{ResponseWriter: w}
+		cw.write = func() error {
+			return m.sessions.WriteCookie(cw.ResponseWriter, s)
+		}
+		defer cw.flush()
+
+		if csrf := m.csrfCheck(); csrf != nil {
+			err = csrf.Verify(req, s)
+			if err != nil {
+				http.Error(cw, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+		}
+
+		ctx := session.NewContext(req.Context(), s)
+
+		u, err := m.authenticator.IsAuthenticatedSessionContext(ctx, s)
+		if err != nil {
+			if !errors.Is(err, juno.ErrNotAuthenticated) && !errors.Is(err, juno.ErrUserNotFound) {
+				log.Println("Unable to load user:", err)
+				http.Error(cw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			u = nil
+		}
+
+		if m.serve(cw, req.WithContext(ctx), next, u, perms) {
+			//clean sessions are updated too so that activity extends their expiration, which providers write at most
+			//once every juno.LastSeenInterval. The handler has already responded, so the session is saved even if the
+			//client disconnects.
+			err = m.sessions.UpdateSessionContext(context.WithoutCancel(req.Context()), s)
+			if err != nil {
+				log.Println("Unable to persist session:", err)
+			}
+		}
+	})
+}
+
+//serveBearer authenticates requests carrying an Authorization: Bearer token, reporting whether it handled the request.
+//No session is loaded for them. Requests with an invalid token are rejected with 401 when permissions are required,
+//otherwise serveBearer reports false so the request is served with the cookie session, as though it carried no token.
+func (m *Middleware) serveBearer(w http.ResponseWriter, req *http.Request, next http.Handler, perms []juno.Permission) bool {
+	u, err := m.authenticator.AuthenticateBearer(req)
+	if err != nil {
+		if len(perms) == 0 {
+			return false
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return true
+	}
+	m.serve(w, req, next, u, perms)
+	return true
+}
+
+//serve loads u into the request context and calls next when u is granted perms, reporting whether next was called
+func (m *Middleware) serve(w http.ResponseWriter, req *http.Request, next http.Handler, u juno.User, perms []juno.Permission) bool {
+	ctx := req.Context()
+	var roles []juno.UserRole
+	if u != nil {
+		roles = juno.RolesOf(u)
+		ctx = user.NewContext(ctx, u)
+		ctx = userrole.NewContext(ctx, u.Role())
+		ctx = userrole.NewRolesContext(ctx, roles)
+	}
+
+	if len(perms) > 0 {
+		if u == nil {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return false
+		}
+		if !m.authorizer.GrantedAll(roles, perms...) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return false
+		}
+	}
+
+	next.ServeHTTP(w, req.WithContext(ctx))
+	return true
+}
+
+//cookieWriter calls write once, before the response headers are sent by WriteHeader, Write, Flush or Hijack,
+//or after the handler returns without writing. As the headers have not been sent yet, a failing write is answered
+//with 500 in place of the handler's response: the handler's status is dropped, Write and Hijack return the error,
+//and Flush sends the 500.
+type cookieWriter struct {
+	http.ResponseWriter
+	write   func() error
+	written bool
+	err     error
+}
+
+func (cw *cookieWriter) flush() {
+	if cw.written {
+		return
+	}
+	cw.written = true
+	cw.err = cw.write()
+	if cw.err != nil {
+		log.Println("Unable to write session cookie:", cw.err)
+		http.Error(cw.ResponseWriter, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+func (cw *cookieWriter) WriteHeader(code int) {
+	cw.flush()
+	if cw.err == nil {
+		cw.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (cw *cookieWriter) Write(b []byte) (int, error) {
+	cw.flush()
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+//Flush implements http.Flusher, so handlers can stream responses
+func (cw *cookieWriter) Flush() {
+	cw.flush()
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+//Hijack implements http.Hijacker, so handlers can upgrade connections
+func (cw *cookieWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	cw.flush()
+	if cw.err != nil {
+		return nil, nil, cw.err
+	}
+	hijacker, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("The ResponseWriter does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
+//Push implements http.Pusher for HTTP/2 server push
+func (cw *cookieWriter) Push(target string, opts *http.PushOptions) error {
+	pusher, ok := cw.ResponseWriter.(http.Pusher)
+	if !ok {
+		return http.ErrNotSupported
+	}
+	return pusher.Push(target, opts)
+}
+
+//Unwrap returns the wrapped ResponseWriter, for http.ResponseController
+func (cw *cookieWriter) Unwrap() http.ResponseWriter {
+	cw.flush()
+	return cw.ResponseWriter
+}
@@ -0,0 +1,428 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/syllabix/juno"
+	"github.com/syllabix/juno/mockrepo"
+	"github.com/syllabix/juno/session"
+	"github.com/syllabix/juno/user"
+	"github.com/syllabix/juno/userrole"
+)
+
+type mockSessionProvider struct {
+	session *juno.StdSession
+	updated bool
+}
+
+func (sp *mockSessionProvider) GetSession(req *http.Request) (juno.Session, error) {
+	return sp.session, nil
+}
+
+func (sp *mockSessionProvider) SetSession(s juno.Session) error {
+	return nil
+}
+
+func (sp *mockSessionProvider) EndSession(w http.ResponseWriter, s juno.Session) error {
+	return nil
+}
+
+func (sp *mockSessionProvider) UpdateSession(s juno.Session) error {
+	sp.updated = true
+	return nil
+}
+
+func (sp *mockSessionProvider) RegenerateSession(w http.ResponseWriter, s juno.Session) error {
+	return nil
+}
+
+func (sp *mockSessionProvider) WriteCookie(w http.ResponseWriter, s juno.Session) error {
+	return nil
+}
+
+type mockUserAuthRepo struct {
+	user *juno.StdUser
+	err  error
+}
+
+func (repo *mockUserAuthRepo) GetUserByCredentials(creds juno.Credentials) (juno.User, error) {
+	return repo.user, nil
+}
+
+func (repo *mockUserAuthRepo) GetUserFromSession(s juno.Session) (juno.User, error) {
+	if _, ok := s.Get(juno.USER_ID_SESSION_KEY); !ok {
+		return nil, juno.ErrNotAuthenticated
+	}
+	if repo.err != nil {
+		return nil, repo.err
+	}
+	return repo.user, nil
+}
+
+func mockMiddleware(sp juno.SessionProvider) *Middleware {
+	u := &juno.StdUser{UserID: 1, Email: "test@juno.com"}
+	u.RoleID = 1
+	authorizer, err := juno.NewAuthorizer(new(mockrepo.MockAuthRepo))
+	if err != nil {
+		panic(err)
+	}
+	return New(sp, juno.NewAuthenticator(&mockUserAuthRepo{user: u}), authorizer)
+}
+
+func TestHandleLoadsContext(t *testing.T) {
+	assert := assert.New(t)
+
+	sp := &mockSessionProvider{session: juno.NewStdSession()}
+	sp.session.Set(juno.USER_ID_SESSION_KEY, 1)
+	m := mockMiddleware(sp)
+
+	var called bool
+	handler := m.Handle(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		called = true
+		s, ok := session.FromContext(req.Context())
+		assert.True(ok, "The session should be available on the request context")
+		assert.Equal(sp.session.SessionID(), s.SessionID())
+		u, ok := user.FromContext(req.Context())
+		assert.True(ok, "The authenticated user should be available on the request context")
+		assert.Equal(1, u.ID())
+		role, ok := userrole.FromContext(req.Context())
+		assert.True(ok, "The user's role should be available on the request context")
+		assert.Equal("1", role.ID())
+		roles, ok := userrole.RolesFromContext(req.Context())
+		assert.True(ok, "Every role of the user should be available on the request context")
+		assert.Equal(1, len(roles))
+		s.Set("visited", true)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.True(called, "The wrapped handler should be called")
+	assert.True(sp.updated, "A dirty session should be persisted after the handler returns")
+}
+
+type contextSessionProvider struct {
+	mockSessionProvider
+	err error
+}
+
+func (sp *contextSessionProvider) SetSessionContext(ctx context.Context, s juno.Session) error {
+	return sp.SetSession(s)
+}
+
+func (sp *contextSessionProvider) EndSessionContext(ctx context.Context, w http.ResponseWriter, s juno.Session) error {
+	return sp.EndSession(w, s)
+}
+
+func (sp *contextSessionProvider) RegenerateSessionContext(ctx context.Context, w http.ResponseWriter, s juno.Session) error {
+	return sp.RegenerateSession(w, s)
+}
+
+func (sp *contextSessionProvider) UpdateSessionContext(ctx context.Context, s juno.Session) error {
+	sp.err = ctx.Err()
+	return sp.UpdateSession(s)
+}
+
+func TestHandleLoadsEveryRole(t *testing.T) {
+	assert := assert.New(t)
+
+	sp := &mockSessionProvider{session: juno.NewStdSession()}
+	sp.session.Set(juno.USER_ID_SESSION_KEY, 1)
+	m := mockMiddleware(sp)
+	u := &juno.StdUser{UserID: 1}
+	u.RoleID = 1
+	u.AssignedRoles = []juno.StdUserRole{{RoleID: 2}}
+	m.authenticator = juno.NewAuthenticator(&mockUserAuthRepo{user: u})
+
+	var ids []string
+	handler := m.Handle(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		roles, _ := userrole.RolesFromContext(req.Context())
+		for _, role := range roles {
+			ids = append(ids, role.ID())
+		}
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.Equal([]string{"1", "2"}, ids, "The assigned roles should be stored along with the primary role")
+}
+
+func TestHandleUserLoadFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	session := juno.NewStdSession()
+	session.Set(juno.USER_ID_SESSION_KEY, 1)
+	m := mockMiddleware(&mockSessionProvider{session: session})
+	called := false
+	handler := m.Handle(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		called = true
+	}))
+
+	m.authenticator = juno.NewAuthenticator(&mockUserAuthRepo{err: errors.New("connection refused")})
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	assert.False(called, "The handler should not be called when the user cannot be loaded")
+	assert.Equal(http.StatusInternalServerError, recorder.Code, "A repository error should be answered with 500")
+
+	m.authenticator = juno.NewAuthenticator(&mockUserAuthRepo{err: juno.ErrUserNotFound})
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	assert.True(called, "A session whose user no longer exists should be served as anonymous")
+	assert.Equal(http.StatusOK, recorder.Code)
+}
+
+func TestHandleExtendsCleanSession(t *testing.T) {
+	assert := assert.New(t)
+
+	sp := &mockSessionProvider{session: juno.NewStdSession()}
+	handler := mockMiddleware(sp).Handle(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.True(sp.updated, "A clean session should be updated so its expiration is extended")
+}
+
+func TestHandleSavesAfterDisconnect(t *testing.T) {
+	assert := assert.New(t)
+
+	sp := &contextSessionProvider{mockSessionProvider: mockSessionProvider{session: juno.NewStdSession()}}
+	m := mockMiddleware(sp)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	handler := m.Handle(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		s, _ := session.FromContext(req.Context())
+		s.Set("visited", true)
+		//the client disconnects while the handler is running
+		cancel()
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+	assert.True(sp.updated, "A dirty session should be persisted after the handler returns")
+	assert.NoError(sp.err, "The session should be saved with a context that is not cancelled with the request")
+}
+
+func TestRequire(t *testing.T) {
+	assert := assert.New(t)
+
+	update := juno.NewStdPermission("update", "You can update things")
+	update.PermissionID = 1
+	canDelete := juno.NewStdPermission("delete", "You can delete things")
+	canDelete.PermissionID = 2
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {})
+
+	anonymous := &mockSessionProvider{session: juno.NewStdSession()}
+	recorder := httptest.NewRecorder()
+	mockMiddleware(anonymous).Require(update)(next).ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(http.StatusUnauthorized, recorder.Code, "Requests without an authenticated user should be rejected with 401")
+
+	authenticated := &mockSessionProvider{session: juno.NewStdSession()}
+	authenticated.session.Set(juno.USER_ID_SESSION_KEY, 1)
+	m := mockMiddleware(authenticated)
+
+	recorder = httptest.NewRecorder()
+	m.Require(update, canDelete)(next).ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(http.StatusForbidden, recorder.Code, "Requests missing a required permission should be rejected with 403")
+
+	recorder = httptest.NewRecorder()
+	m.Require(update)(next).ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(http.StatusOK, recorder.Code, "Requests granted all required permissions should be let through")
+}
+
+type cookieSessionProvider struct {
+	mockSessionProvider
+	written map[string]interface{}
+}
+
+func (sp *cookieSessionProvider) WriteCookie(w http.ResponseWriter, s juno.Session) error {
+	sp.written = make(map[string]interface{})
+	for k, v := range s.Store() {
+		sp.written[k] = v
+	}
+	return nil
+}
+
+func TestHandleWritesCookieBeforeResponse(t *testing.T) {
+	assert := assert.New(t)
+
+	sp := &cookieSessionProvider{mockSessionProvider: mockSessionProvider{session: juno.NewStdSession()}}
+	m := mockMiddleware(sp)
+
+	handler := m.Handle(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		s, _ := session.FromContext(req.Context())
+		s.Set("theme", "dark")
+		w.Write([]byte("ok"))
+		s.Set("late", true)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	assert.Equal("dark", sp.written["theme"], "Changes made before the response is written should reach the cookie")
+	_, late := sp.written["late"]
+	assert.False(late, "The cookie should be written once, before the response body")
+}
+
+type failingCookieSessionProvider struct {
+	mockSessionProvider
+}
+
+func (sp *failingCookieSessionProvider) WriteCookie(w http.ResponseWriter, s juno.Session) error {
+	return errors.New("Cookie too large")
+}
+
+func TestHandleCookieWriteFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	m := mockMiddleware(&failingCookieSessionProvider{mockSessionProvider{session: juno.NewStdSession()}})
+
+	var writeErr error
+	handler := m.Handle(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_, writeErr = w.Write([]byte("created"))
+	}))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(http.StatusInternalServerError, recorder.Code, "A failure to write the cookie should be answered with 500")
+	assert.NotContains(recorder.Body.String(), "created", "The handler's response should be dropped")
+	assert.Error(writeErr, "The handler should see the failure when writing")
+
+	recorder = httptest.NewRecorder()
+	m.Handle(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {})).ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(http.StatusInternalServerError, recorder.Code, "A failure after a handler that wrote nothing should be answered with 500")
+}
+
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (r *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	r.hijacked = true
+	return nil, nil, nil
+}
+
+func TestHandlePassesThroughResponseWriter(t *testing.T) {
+	assert := assert.New(t)
+
+	sp := &cookieSessionProvider{mockSessionProvider: mockSessionProvider{session: juno.NewStdSession()}}
+	m := mockMiddleware(sp)
+
+	handler := m.Handle(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		s, _ := session.FromContext(req.Context())
+		s.Set("theme", "dark")
+		flusher, ok := w.(http.Flusher)
+		if assert.True(ok, "The ResponseWriter should implement http.Flusher") {
+			flusher.Flush()
+		}
+		_, ok = w.(http.Hijacker)
+		assert.True(ok, "The ResponseWriter should implement http.Hijacker")
+		unwrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if assert.True(ok, "The ResponseWriter should implement Unwrap") {
+			assert.NotNil(unwrapper.Unwrap())
+		}
+	}))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	assert.True(recorder.Flushed, "Flush should reach the wrapped ResponseWriter")
+	assert.Equal("dark", sp.written["theme"], "The cookie should be written before flushing")
+
+	hijacker := &hijackRecorder{ResponseRecorder: httptest.NewRecorder()}
+	m.Handle(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _, err := w.(http.Hijacker).Hijack()
+		assert.NoError(err)
+	})).ServeHTTP(hijacker, httptest.NewRequest("GET", "/", nil))
+	assert.True(hijacker.hijacked, "Hijack should reach the wrapped ResponseWriter")
+}
+
+func TestHandleBearerToken(t *testing.T) {
+	assert := assert.New(t)
+
+	sp := &mockSessionProvider{session: juno.NewStdSession()}
+	m := mockMiddleware(sp)
+	err := m.authenticator.EnableTokens(juno.TokenOptions{}, juno.TokenKey{ID: "k", Algorithm: juno.HS256, Key: []byte("0123456789abcdef0123456789abcdef")})
+	assert.NoError(err)
+	u := &juno.StdUser{UserID: 1}
+	token, err := m.authenticator.IssueToken(u)
+	assert.NoError(err)
+
+	var called bool
+	handler := m.Handle(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		called = true
+		authenticated, ok := user.FromContext(req.Context())
+		assert.True(ok, "The user from the bearer token should be available on the request context")
+		assert.Equal(1, authenticated.ID())
+		_, ok = session.FromContext(req.Context())
+		assert.False(ok, "No session should be loaded for bearer token requests")
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.True(called)
+
+	req.Header.Set("Authorization", "Bearer not.a.token")
+	recorder := httptest.NewRecorder()
+	m.Require(juno.NewStdPermission("read", "You can read things"))(handler).ServeHTTP(recorder, req)
+	assert.Equal(http.StatusUnauthorized, recorder.Code, "Requests with an invalid bearer token should be rejected with 401 when permissions are required")
+
+	var hasSession, hasUser bool
+	public := m.Handle(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, hasSession = session.FromContext(req.Context())
+		_, hasUser = user.FromContext(req.Context())
+	}))
+	recorder = httptest.NewRecorder()
+	public.ServeHTTP(recorder, req)
+	assert.Equal(http.StatusOK, recorder.Code, "Public routes should ignore an invalid bearer token")
+	assert.True(hasSession, "Public routes should serve an invalid bearer token with the cookie session")
+	assert.False(hasUser, "The request should be anonymous when the cookie session is not authenticated")
+}
+
+func TestHandleBearerTokenNotEnabled(t *testing.T) {
+	assert := assert.New(t)
+
+	sp := &mockSessionProvider{session: juno.NewStdSession()}
+	sp.session.Set(juno.USER_ID_SESSION_KEY, 1)
+	m := mockMiddleware(sp)
+
+	var authenticated bool
+	handler := m.Handle(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, authenticated = user.FromContext(req.Context())
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer some.other.scheme")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(http.StatusOK, recorder.Code, "Bearer headers should be ignored when tokens are not enabled")
+	assert.True(authenticated, "The cookie session should be used when tokens are not enabled")
+}
+
+func TestHandleCSRF(t *testing.T) {
+	assert := assert.New(t)
+
+	sp := &mockSessionProvider{session: juno.NewStdSession()}
+	m := mockMiddleware(sp)
+	csrf := juno.NewCSRF()
+	m.EnableCSRF(csrf)
+
+	var token string
+	handler := m.Handle(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		s, _ := session.FromContext(req.Context())
+		token, _ = csrf.Token(s)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.NotEmpty(token, "Safe requests should be let through to issue a token")
+	assert.True(sp.updated, "The CSRF secret should be persisted with the session")
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("POST", "/", nil))
+	assert.Equal(http.StatusForbidden, recorder.Code, "Unsafe requests without a token should be rejected")
+
+	recorder = httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set("X-CSRF-Token", token)
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(http.StatusOK, recorder.Code, "Unsafe requests with a valid token should be let through")
+}
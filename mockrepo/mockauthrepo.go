@@ -105,3 +105,15 @@ func (repo *MockAuthRepo) AssignPermissionToRole(r juno.Role, p juno.Permission)
 func (repo *MockAuthRepo) RevokePermissionFromRole(r juno.Role, p juno.Permission) error {
 	return nil
 }
+
+func (repo *MockAuthRepo) GetRoleParents() ([]juno.RoleParent, error) {
+	return []juno.RoleParent{}, nil
+}
+
+func (repo *MockAuthRepo) AssignParentToRole(r juno.Role, parent juno.Role) error {
+	return nil
+}
+
+func (repo *MockAuthRepo) RevokeParentFromRole(r juno.Role, parent juno.Role) error {
+	return nil
+}
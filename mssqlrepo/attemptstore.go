@@ -0,0 +1,57 @@
+package mssqlrepo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+//NewAttemptStore is a factory constructor for an mssql juno.AttemptStore, backed by dbo.LoginAttempts
+func NewAttemptStore(db *sql.DB) *AttemptStore {
+	return &AttemptStore{
+		db: db,
+	}
+}
+
+//AttemptStore is the mssql implementation of juno.AttemptStore, so failed logins are tracked across instances
+type AttemptStore struct {
+	db *sql.DB
+}
+
+const getattempts = `SELECT Failures, LastFailure FROM dbo.LoginAttempts WHERE AttemptKey = ?`
+
+//GetAttempts returns the number of failures recorded for key and the time of the last one
+func (s *AttemptStore) GetAttempts(ctx context.Context, key string) (int, time.Time, error) {
+	var failures int
+	var last time.Time
+	err := s.db.QueryRowContext(ctx, getattempts, key).Scan(&failures, &last)
+	if err == sql.ErrNoRows {
+		return 0, time.Time{}, nil
+	}
+	return failures, last, err
+}
+
+const recordfailure = `
+    MERGE dbo.LoginAttempts WITH (HOLDLOCK) AS target
+    USING (SELECT ? AS AttemptKey, ? AS LastFailure) AS source
+    ON target.AttemptKey = source.AttemptKey
+    WHEN MATCHED THEN
+        UPDATE SET Failures = target.Failures + 1, LastFailure = source.LastFailure
+    WHEN NOT MATCHED THEN
+        INSERT (AttemptKey, Failures, LastFailure) VALUES (source.AttemptKey, 1, source.LastFailure)
+    OUTPUT inserted.Failures;`
+
+//RecordFailure adds a failure at the provided time for key, returning the new number of failures
+func (s *AttemptStore) RecordFailure(ctx context.Context, key string, at time.Time) (int, error) {
+	var failures int
+	err := s.db.QueryRowContext(ctx, recordfailure, key, at).Scan(&failures)
+	return failures, err
+}
+
+const resetattempts = `DELETE FROM dbo.LoginAttempts WHERE AttemptKey = ?`
+
+//ResetAttempts forgets every failure recorded for key
+func (s *AttemptStore) ResetAttempts(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, resetattempts, key)
+	return err
+}
@@ -0,0 +1,45 @@
+package mssqlrepo
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestAttemptStore(t *testing.T) {
+	assert := assert.New(t)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(err)
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta(getattempts)).
+		WithArgs("username:test@juno.com").
+		WillReturnRows(sqlmock.NewRows([]string{"Failures", "LastFailure"}))
+	mock.ExpectQuery(regexp.QuoteMeta(recordfailure)).
+		WithArgs("username:test@juno.com", now).
+		WillReturnRows(sqlmock.NewRows([]string{"Failures"}).AddRow(1))
+	mock.ExpectExec(regexp.QuoteMeta(resetattempts)).
+		WithArgs("username:test@juno.com").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	store := NewAttemptStore(db)
+	ctx := context.Background()
+
+	failures, last, err := store.GetAttempts(ctx, "username:test@juno.com")
+	assert.NoError(err, "Unknown keys should not be an error")
+	assert.Equal(0, failures)
+	assert.True(last.IsZero())
+
+	failures, err = store.RecordFailure(ctx, "username:test@juno.com", now)
+	assert.NoError(err)
+	assert.Equal(1, failures)
+
+	assert.NoError(store.ResetAttempts(ctx, "username:test@juno.com"))
+	assert.NoError(mock.ExpectationsWereMet())
+}
@@ -0,0 +1,42 @@
+package mssqlrepo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/syllabix/juno"
+)
+
+//NewAuditSink is a factory constructor for an mssql juno.AuditSink, backed by dbo.AuditLog
+func NewAuditSink(db *sql.DB) *AuditSink {
+	return &AuditSink{
+		db: db,
+	}
+}
+
+//AuditSink is the mssql implementation of juno.AuditSink
+type AuditSink struct {
+	db *sql.DB
+}
+
+const insertauditevent = `
+    INSERT INTO dbo.AuditLog (EventTime, EventType, Actor, RoleID, PermissionID, Username, UserID, SessionID, IPAddress, Success, Error)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+//WriteAuditEvent inserts e into dbo.AuditLog
+func (s *AuditSink) WriteAuditEvent(ctx context.Context, e juno.AuditEvent) error {
+	_, err := s.db.ExecContext(ctx, insertauditevent,
+		e.Time,
+		e.Type,
+		nullString(e.Actor),
+		nullString(e.RoleID),
+		nullString(e.PermissionID),
+		nullString(e.Username),
+		sql.NullInt64{Int64: int64(e.UserID), Valid: e.UserID != 0},
+		nullString(e.SessionID),
+		nullString(e.IPAddress),
+		e.Success,
+		nullString(e.Error),
+	)
+	return err
+}
@@ -0,0 +1,41 @@
+package mssqlrepo
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+
+	"github.com/syllabix/juno"
+)
+
+func TestAuditSink(t *testing.T) {
+	assert := assert.New(t)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(err)
+	defer db.Close()
+
+	now := time.Now().UTC()
+	mock.ExpectExec(regexp.QuoteMeta(insertauditevent)).
+		WithArgs(now, juno.AuditLogin, sql.NullString{}, sql.NullString{}, sql.NullString{},
+			sql.NullString{String: "test@juno.com", Valid: true}, sql.NullInt64{Int64: 7, Valid: true},
+			sql.NullString{}, sql.NullString{String: "192.0.2.1", Valid: true}, true, sql.NullString{}).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	sink := NewAuditSink(db)
+	err = sink.WriteAuditEvent(context.Background(), juno.AuditEvent{
+		Time:      now,
+		Type:      juno.AuditLogin,
+		Username:  "test@juno.com",
+		UserID:    7,
+		IPAddress: "192.0.2.1",
+		Success:   true,
+	})
+	assert.NoError(err)
+	assert.NoError(mock.ExpectationsWereMet())
+}
@@ -1,6 +1,7 @@
 package mssqlrepo
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"time"
@@ -28,7 +29,12 @@ const getpermissions = `SELECT PermissionID, Label, Description FROM dbo.Permiss
 
 //GetPermissions returns all permissions
 func (r *AuthRepo) GetPermissions() ([]juno.Permission, error) {
-	rows, err := r.db.Query(getpermissions)
+	return r.GetPermissionsContext(context.Background())
+}
+
+//GetPermissionsContext is the same as GetPermissions, passing ctx through to the database
+func (r *AuthRepo) GetPermissionsContext(ctx context.Context) ([]juno.Permission, error) {
+	rows, err := r.db.QueryContext(ctx, getpermissions)
 	if err != nil {
 		return nil, err
 	}
@@ -57,12 +63,17 @@ func (r *AuthRepo) GetPermissions() ([]juno.Permission, error) {
 const getpermbyname = `SELECT PermissionID, Label, Description FROM dbo.Permissions WHERE Label = ?`
 
 func (r *AuthRepo) GetPermission(p juno.Permission) (juno.Permission, error) {
+	return r.GetPermissionContext(context.Background(), p)
+}
+
+//GetPermissionContext is the same as GetPermission, passing ctx through to the database
+func (r *AuthRepo) GetPermissionContext(ctx context.Context, p juno.Permission) (juno.Permission, error) {
 	stdPerm, ok := p.(*juno.StdPermission)
 	if !ok {
 		return nil, fmt.Errorf("Unexpected error type of %s recieved, expected %s", reflect.TypeOf(p), "*juno.StdPermission")
 	}
 	permission := new(juno.StdPermission)
-	err := r.db.QueryRow(getpermbyname, stdPerm.Label).Scan(&permission.PermissionID, &permission.Label, &permission.Description)
+	err := r.db.QueryRowContext(ctx, getpermbyname, stdPerm.Label).Scan(&permission.PermissionID, &permission.Label, &permission.Description)
 	if err != nil {
 		return nil, err
 	}
@@ -73,10 +84,15 @@ const insertpermission = `INSERT INTO dbo.Permissions (Label, Description) VALUE
 
 //AddPermission takes an implementation of the juno.Permission interface to create the permission
 func (r *AuthRepo) CreatePermission(p juno.Permission) (juno.Permission, error) {
+	return r.CreatePermissionContext(context.Background(), p)
+}
+
+//CreatePermissionContext is the same as CreatePermission, passing ctx through to the database
+func (r *AuthRepo) CreatePermissionContext(ctx context.Context, p juno.Permission) (juno.Permission, error) {
 	if stdPerm, ok := p.(*juno.StdPermission); ok {
-		result, err := r.db.Exec(insertpermission, stdPerm.Label, stdPerm.Description)
+		result, err := r.db.ExecContext(ctx, insertpermission, stdPerm.Label, stdPerm.Description)
 		if err != nil {
-			return nil, err
+			return nil, permissionError(err)
 		}
 		id, err := result.LastInsertId()
 		if err != nil {
@@ -88,10 +104,15 @@ func (r *AuthRepo) CreatePermission(p juno.Permission) (juno.Permission, error)
 	return nil, fmt.Errorf("Invalid Permissions type of %s passed to add function. Expecting juno.StdPermission", reflect.TypeOf(p))
 }
 
-const getroles = `SELECT * FROM dbo.UserRoles`
+const getroles = `SELECT RoleID, RoleName, Created FROM dbo.UserRoles`
 
 func (r *AuthRepo) GetRoles() ([]juno.Role, error) {
-	rows, err := r.db.Query(getroles)
+	return r.GetRolesContext(context.Background())
+}
+
+//GetRolesContext is the same as GetRoles, passing ctx through to the database
+func (r *AuthRepo) GetRolesContext(ctx context.Context) ([]juno.Role, error) {
+	rows, err := r.db.QueryContext(ctx, getroles)
 	if err != nil {
 		return nil, err
 	}
@@ -120,9 +141,14 @@ func (r *AuthRepo) GetRoles() ([]juno.Role, error) {
 const insertrole = `INSERT INTO dbo.UserRoles (RoleName) VALUES (?)`
 
 func (r *AuthRepo) CreateRole(role juno.Role) (juno.Role, error) {
+	return r.CreateRoleContext(context.Background(), role)
+}
+
+//CreateRoleContext is the same as CreateRole, passing ctx through to the database
+func (r *AuthRepo) CreateRoleContext(ctx context.Context, role juno.Role) (juno.Role, error) {
 	if stdrole, ok := role.(*juno.StdRole); ok {
 		stdrole.CreatedDate = time.Now()
-		result, err := r.db.Exec(insertrole, stdrole.RoleName)
+		result, err := r.db.ExecContext(ctx, insertrole, stdrole.RoleName)
 		if err != nil {
 			return nil, err
 		}
@@ -160,7 +186,12 @@ const getrolepermissions = `
 
 //GetRolePermissions returns a slice of RolePermission which is intended to associate a role with a granted permission
 func (r *AuthRepo) GetRolePermissions() ([]juno.RolePermission, error) {
-	rows, err := r.db.Query(getrolepermissions)
+	return r.GetRolePermissionsContext(context.Background())
+}
+
+//GetRolePermissionsContext is the same as GetRolePermissions, passing ctx through to the database
+func (r *AuthRepo) GetRolePermissionsContext(ctx context.Context) ([]juno.RolePermission, error) {
+	rows, err := r.db.QueryContext(ctx, getrolepermissions)
 	if err != nil {
 		return nil, err
 	}
@@ -189,6 +220,11 @@ const insertrolepermission = `INSERT INTO dbo.UserRolePermissionsMap (RoleID, Pe
 
 //AssignPermissionToRole grants a role a permission
 func (r *AuthRepo) AssignPermissionToRole(role juno.Role, perm juno.Permission) error {
+	return r.AssignPermissionToRoleContext(context.Background(), role, perm)
+}
+
+//AssignPermissionToRoleContext is the same as AssignPermissionToRole, passing ctx through to the database
+func (r *AuthRepo) AssignPermissionToRoleContext(ctx context.Context, role juno.Role, perm juno.Permission) error {
 	stdRole, ok := role.(*juno.StdRole)
 	if !ok {
 		return fmt.Errorf("Invalid Role type of %s passed to CreateRole. Expecting juno.StdRole", reflect.TypeOf(role))
@@ -197,7 +233,7 @@ func (r *AuthRepo) AssignPermissionToRole(role juno.Role, perm juno.Permission)
 	if !ok {
 		return fmt.Errorf("Invalid Permissions type of %s passed to add function. Expecting juno.StdPermission", reflect.TypeOf(perm))
 	}
-	_, err := r.db.Exec(insertrolepermission, stdRole.RoleID, stdPerm.PermissionID)
+	_, err := r.db.ExecContext(ctx, insertrolepermission, stdRole.RoleID, stdPerm.PermissionID)
 	return err
 }
 
@@ -205,6 +241,11 @@ const revokepermission = `DELETE FROM dbo.UserRolePermissionsMap WHERE RoleID =
 
 //RevokePermissionFromRole takes a juno.StdRole and juno.StdPermission (implementations of the respective interface) and removes their grant relationship in the database.
 func (r *AuthRepo) RevokePermissionFromRole(role juno.Role, perm juno.Permission) error {
+	return r.RevokePermissionFromRoleContext(context.Background(), role, perm)
+}
+
+//RevokePermissionFromRoleContext is the same as RevokePermissionFromRole, passing ctx through to the database
+func (r *AuthRepo) RevokePermissionFromRoleContext(ctx context.Context, role juno.Role, perm juno.Permission) error {
 	stdRole, ok := role.(*juno.StdRole)
 	if !ok {
 		return fmt.Errorf("Invalid Role type of %s passed to CreateRole. Expecting juno.StdRole", reflect.TypeOf(role))
@@ -213,21 +254,118 @@ func (r *AuthRepo) RevokePermissionFromRole(role juno.Role, perm juno.Permission
 	if !ok {
 		return fmt.Errorf("Invalid Permissions type of %s passed to add function. Expecting juno.StdPermission", reflect.TypeOf(perm))
 	}
-	_, err := r.db.Exec(revokepermission, stdRole.RoleID, stdPerm.PermissionID)
+	_, err := r.db.ExecContext(ctx, revokepermission, stdRole.RoleID, stdPerm.PermissionID)
 	return err
 }
 
-const getrole = `SELECT * FROM dbo.UserRoles WHERE RoleName = ?`
+const getrole = `SELECT RoleID, RoleName, Created FROM dbo.UserRoles WHERE RoleName = ?`
 
 func (r *AuthRepo) GetRole(role juno.Role) (juno.Role, error) {
+	return r.GetRoleContext(context.Background(), role)
+}
+
+//GetRoleContext is the same as GetRole, passing ctx through to the database
+func (r *AuthRepo) GetRoleContext(ctx context.Context, role juno.Role) (juno.Role, error) {
 	stdRole, ok := role.(*juno.StdRole)
 	if !ok {
 		return nil, fmt.Errorf("Invalid Role type of %s passed to GetRole. Expecting juno.StdRole", reflect.TypeOf(role))
 	}
 	var retRole juno.StdRole
-	err := r.db.QueryRow(getrole, stdRole.RoleName).Scan(&retRole.RoleID, &retRole.RoleName, &retRole.CreatedDate)
+	err := r.db.QueryRowContext(ctx, getrole, stdRole.RoleName).Scan(&retRole.RoleID, &retRole.RoleName, &retRole.CreatedDate)
 	if err != nil {
 		return nil, err
 	}
 	return &retRole, nil
 }
+
+//RoleParent is an implementation of juno.RoleParent, and used to expose the role hierarchy to Authorizer
+type RoleParent struct {
+	RID       int `db:"RoleID"`
+	ParentRID int `db:"ParentRoleID"`
+}
+
+//RoleID implements the juno.RoleParent RoleID getter
+func (rp *RoleParent) RoleID() string {
+	return strconv.Itoa(rp.RID)
+}
+
+//ParentID implements the juno.RoleParent ParentID getter
+func (rp *RoleParent) ParentID() string {
+	return strconv.Itoa(rp.ParentRID)
+}
+
+const getroleparents = `SELECT RoleID, ParentRoleID FROM dbo.UserRoleParentsMap`
+
+//GetRoleParents returns a slice of RoleParent which is intended to associate a role with the roles it inherits from
+func (r *AuthRepo) GetRoleParents() ([]juno.RoleParent, error) {
+	return r.GetRoleParentsContext(context.Background())
+}
+
+//GetRoleParentsContext is the same as GetRoleParents, passing ctx through to the database
+func (r *AuthRepo) GetRoleParentsContext(ctx context.Context) ([]juno.RoleParent, error) {
+	rows, err := r.db.QueryContext(ctx, getroleparents)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []juno.RoleParent{}
+	for rows.Next() {
+		rp := new(RoleParent)
+		err := rows.Scan(
+			&rp.RID,
+			&rp.ParentRID,
+		)
+		if err == nil {
+			results = append(results, rp)
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+const insertroleparent = `INSERT INTO dbo.UserRoleParentsMap (RoleID, ParentRoleID) VALUES (?, ?)`
+
+//AssignParentToRole makes role inherit the permissions granted to parent
+func (r *AuthRepo) AssignParentToRole(role juno.Role, parent juno.Role) error {
+	return r.AssignParentToRoleContext(context.Background(), role, parent)
+}
+
+//AssignParentToRoleContext is the same as AssignParentToRole, passing ctx through to the database
+func (r *AuthRepo) AssignParentToRoleContext(ctx context.Context, role juno.Role, parent juno.Role) error {
+	stdRole, ok := role.(*juno.StdRole)
+	if !ok {
+		return fmt.Errorf("Invalid Role type of %s passed to AssignParentToRole. Expecting juno.StdRole", reflect.TypeOf(role))
+	}
+	stdParent, ok := parent.(*juno.StdRole)
+	if !ok {
+		return fmt.Errorf("Invalid Role type of %s passed to AssignParentToRole. Expecting juno.StdRole", reflect.TypeOf(parent))
+	}
+	_, err := r.db.ExecContext(ctx, insertroleparent, stdRole.RoleID, stdParent.RoleID)
+	return err
+}
+
+const revokeroleparent = `DELETE FROM dbo.UserRoleParentsMap WHERE RoleID = ? AND ParentRoleID = ?`
+
+//RevokeParentFromRole stops role inheriting the permissions granted to parent
+func (r *AuthRepo) RevokeParentFromRole(role juno.Role, parent juno.Role) error {
+	return r.RevokeParentFromRoleContext(context.Background(), role, parent)
+}
+
+//RevokeParentFromRoleContext is the same as RevokeParentFromRole, passing ctx through to the database
+func (r *AuthRepo) RevokeParentFromRoleContext(ctx context.Context, role juno.Role, parent juno.Role) error {
+	stdRole, ok := role.(*juno.StdRole)
+	if !ok {
+		return fmt.Errorf("Invalid Role type of %s passed to RevokeParentFromRole. Expecting juno.StdRole", reflect.TypeOf(role))
+	}
+	stdParent, ok := parent.(*juno.StdRole)
+	if !ok {
+		return fmt.Errorf("Invalid Role type of %s passed to RevokeParentFromRole. Expecting juno.StdRole", reflect.TypeOf(parent))
+	}
+	_, err := r.db.ExecContext(ctx, revokeroleparent, stdRole.RoleID, stdParent.RoleID)
+	return err
+}
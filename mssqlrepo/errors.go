@@ -0,0 +1,36 @@
+package mssqlrepo
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/syllabix/juno"
+)
+
+//sqlErrorNumber is implemented by errors returned from the SQL Server driver
+type sqlErrorNumber interface {
+	SQLErrorNumber() int32
+}
+
+//SQL Server error numbers for unique index and unique constraint violations
+const (
+	errDuplicateKeyIndex      = 2601
+	errDuplicateKeyConstraint = 2627
+)
+
+func isDuplicateKey(err error) bool {
+	var numbered sqlErrorNumber
+	if errors.As(err, &numbered) {
+		n := numbered.SQLErrorNumber()
+		return n == errDuplicateKeyIndex || n == errDuplicateKeyConstraint
+	}
+	return false
+}
+
+//permissionError reports duplicate keys as juno.ErrDuplicatePermission so the Authorizer can recover from them
+func permissionError(err error) error {
+	if isDuplicateKey(err) {
+		return fmt.Errorf("%w: %v", juno.ErrDuplicatePermission, err)
+	}
+	return err
+}
@@ -0,0 +1,34 @@
+package mssqlrepo
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/syllabix/juno"
+)
+
+type numberedError int32
+
+func (e numberedError) SQLErrorNumber() int32 {
+	return int32(e)
+}
+
+func (e numberedError) Error() string {
+	return fmt.Sprintf("mssql error %d", int32(e))
+}
+
+func TestPermissionError(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(errors.Is(permissionError(numberedError(errDuplicateKeyConstraint)), juno.ErrDuplicatePermission),
+		"Unique constraint violations should be reported as duplicate permissions")
+	assert.True(errors.Is(permissionError(fmt.Errorf("insert: %w", numberedError(errDuplicateKeyIndex))), juno.ErrDuplicatePermission),
+		"Wrapped unique index violations should be reported as duplicate permissions")
+	assert.False(errors.Is(permissionError(numberedError(547)), juno.ErrDuplicatePermission),
+		"Other errors should be returned as they are")
+	assert.False(errors.Is(permissionError(errors.New("Cannot insert duplicate key row")), juno.ErrDuplicatePermission),
+		"Errors should not be matched by their message")
+}
@@ -0,0 +1,208 @@
+package mssqlrepo
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+//Migration is a single versioned schema change shipped with mssqlrepo
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+//Migrations returns every migration shipped with mssqlrepo ordered by version.
+//Files are named <version>-<name>.sql and only their "-- +migrate Up" section is used.
+func Migrations() ([]Migration, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	results := []Migration{}
+	for _, entry := range entries {
+		name := entry.Name()
+		prefix := strings.SplitN(name, "-", 2)[0]
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid migration file name %s, expecting a numeric version prefix", name)
+		}
+		contents, err := migrationFiles.ReadFile(path.Join("migrations", name))
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, Migration{
+			Version: version,
+			Name:    name,
+			SQL:     upSection(string(contents)),
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Version < results[j].Version
+	})
+	return results, nil
+}
+
+//upSection strips sql-migrate annotations, returning only the statements to apply
+func upSection(contents string) string {
+	if i := strings.Index(contents, "-- +migrate Down"); i >= 0 {
+		contents = contents[:i]
+	}
+	return strings.Replace(contents, "-- +migrate Up", "", 1)
+}
+
+const createversiontable = `
+    IF OBJECT_ID(N'dbo.JunoSchemaVersions', N'U') IS NULL
+    CREATE TABLE [dbo].[JunoSchemaVersions] (
+        [Version] INT NOT NULL,
+        [Name] NVARCHAR(255) NOT NULL,
+        [Applied] DATETIMEOFFSET NOT NULL
+            CONSTRAINT [DF_SchemaVersionApplied] DEFAULT (SYSDATETIMEOFFSET()),
+        CONSTRAINT [PK_SchemaVersion] PRIMARY KEY ([Version])
+    )`
+
+//getmigratelock takes an exclusive application lock until the transaction ends, returning the sp_getapplock status,
+//which is negative when the lock was not granted
+const getmigratelock = `
+    DECLARE @result INT
+    EXEC @result = sp_getapplock @Resource = N'JunoMigrate', @LockMode = N'Exclusive', @LockOwner = N'Transaction'
+    SELECT @result`
+
+const getversions = `SELECT Version FROM dbo.JunoSchemaVersions`
+
+const insertversion = `INSERT INTO dbo.JunoSchemaVersions (Version, Name) VALUES (?, ?)`
+
+//MigrateOptions configure Migrate
+type MigrateOptions struct {
+	//Baseline records every migration up to and including this version as applied without running it. It is to be set
+	//for databases created before Migrate existed, such as with sql-migrate or the example scripts, where the init
+	//migration is 1 and the v1.1 migration is 2.
+	Baseline int
+}
+
+//Migrate applies every migration that has not yet been applied to the database, in a single transaction that first takes
+//an exclusive application lock, so concurrent calls, such as from several instances starting up, wait for each other
+//rather than applying a migration twice. A failing migration rolls back every migration applied by the call.
+//Applied versions are recorded in dbo.JunoSchemaVersions, so it is safe to call on every start up.
+//Databases created without Migrate are to be adopted by setting MigrateOptions.Baseline to the version they are at.
+func Migrate(ctx context.Context, db *sql.DB, opts ...MigrateOptions) error {
+	var options MigrateOptions
+	if len(opts) > 0 {
+		options = opts[0]
+	}
+
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	err = migrate(ctx, tx, migrations, options)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func migrate(ctx context.Context, tx *sql.Tx, migrations []Migration, options MigrateOptions) error {
+	var lock int
+	err := tx.QueryRowContext(ctx, getmigratelock).Scan(&lock)
+	if err != nil {
+		return err
+	}
+	if lock < 0 {
+		return fmt.Errorf("Unable to take the migration lock, sp_getapplock returned %d", lock)
+	}
+
+	_, err = tx.ExecContext(ctx, createversiontable)
+	if err != nil {
+		return err
+	}
+
+	//the versions are read with the lock held, so migrations applied by a concurrent call are seen
+	applied, err := appliedVersions(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if applied[m.Version] {
+			continue
+		}
+		if m.Version <= options.Baseline {
+			_, err = tx.ExecContext(ctx, insertversion, m.Version, m.Name)
+			if err != nil {
+				return fmt.Errorf("Unable to record migration %s as applied: %v", m.Name, err)
+			}
+			continue
+		}
+		err = apply(ctx, tx, m)
+		if err != nil {
+			return fmt.Errorf("Unable to apply migration %s: %v", m.Name, err)
+		}
+	}
+	return nil
+}
+
+//SchemaVersion returns the highest migration version applied to the database, or 0 if none have been applied
+func SchemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	applied, err := appliedVersions(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+	version := 0
+	for v := range applied {
+		if v > version {
+			version = v
+		}
+	}
+	return version, nil
+}
+
+//querier is implemented by both *sql.DB and *sql.Tx
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func appliedVersions(ctx context.Context, db querier) (map[int]bool, error) {
+	rows, err := db.QueryContext(ctx, getversions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		err := rows.Scan(&version)
+		if err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+func apply(ctx context.Context, tx *sql.Tx, m Migration) error {
+	_, err := tx.ExecContext(ctx, m.SQL)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, insertversion, m.Version, m.Name)
+	return err
+}
@@ -0,0 +1,126 @@
+package mssqlrepo
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestMigrations(t *testing.T) {
+	assert := assert.New(t)
+
+	migrations, err := Migrations()
+	assert.NoError(err, "Embedded migrations should be readable")
+	assert.True(len(migrations) >= 2, "The init and v1.1 migrations should be embedded")
+	for i, m := range migrations {
+		assert.Equal(i+1, m.Version, "Migrations should be ordered by version without gaps")
+		assert.False(strings.Contains(m.SQL, "+migrate"), "sql-migrate annotations should be stripped")
+	}
+}
+
+func expectMigrateLock(mock sqlmock.Sqlmock, result int) {
+	mock.ExpectQuery(regexp.QuoteMeta(getmigratelock)).
+		WillReturnRows(sqlmock.NewRows([]string{"result"}).AddRow(result))
+}
+
+func TestMigrateSkipsAppliedVersions(t *testing.T) {
+	assert := assert.New(t)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(err)
+	defer db.Close()
+
+	migrations, _ := Migrations()
+
+	mock.ExpectBegin()
+	expectMigrateLock(mock, 0)
+	mock.ExpectExec("IF OBJECT_ID").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(getversions)).
+		WillReturnRows(sqlmock.NewRows([]string{"Version"}).AddRow(1))
+	for _, m := range migrations[1:] {
+		mock.ExpectExec(regexp.QuoteMeta(m.SQL)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(insertversion)).
+			WithArgs(m.Version, m.Name).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+
+	err = Migrate(context.Background(), db)
+	assert.NoError(err, "Migrate should only apply versions that have not been recorded")
+	assert.NoError(mock.ExpectationsWereMet())
+}
+
+func TestMigrateBaseline(t *testing.T) {
+	assert := assert.New(t)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(err)
+	defer db.Close()
+
+	migrations, _ := Migrations()
+
+	mock.ExpectBegin()
+	expectMigrateLock(mock, 0)
+	mock.ExpectExec("IF OBJECT_ID").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(getversions)).
+		WillReturnRows(sqlmock.NewRows([]string{"Version"}))
+	for _, m := range migrations[:2] {
+		mock.ExpectExec(regexp.QuoteMeta(insertversion)).
+			WithArgs(m.Version, m.Name).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	for _, m := range migrations[2:] {
+		mock.ExpectExec(regexp.QuoteMeta(m.SQL)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(insertversion)).
+			WithArgs(m.Version, m.Name).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+
+	err = Migrate(context.Background(), db, MigrateOptions{Baseline: 2})
+	assert.NoError(err, "Migrations up to the baseline should be recorded without being run")
+	assert.NoError(mock.ExpectationsWereMet())
+}
+
+func TestMigrateLock(t *testing.T) {
+	assert := assert.New(t)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	expectMigrateLock(mock, -1)
+	mock.ExpectRollback()
+
+	err = Migrate(context.Background(), db)
+	assert.Error(err, "Migrate should fail when the migration lock is not granted")
+	assert.NoError(mock.ExpectationsWereMet(), "Nothing should be read or applied without the migration lock")
+}
+
+func TestMigrateRollsBackOnFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(err)
+	defer db.Close()
+
+	migrations, _ := Migrations()
+
+	mock.ExpectBegin()
+	expectMigrateLock(mock, 1)
+	mock.ExpectExec("IF OBJECT_ID").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(getversions)).
+		WillReturnRows(sqlmock.NewRows([]string{"Version"}))
+	mock.ExpectExec(regexp.QuoteMeta(migrations[0].SQL)).WillReturnError(errors.New("syntax error"))
+	mock.ExpectRollback()
+
+	err = Migrate(context.Background(), db)
+	assert.Error(err)
+	assert.NoError(mock.ExpectationsWereMet(), "A failing migration should roll back the migration transaction")
+}
@@ -1,6 +1,6 @@
 -- +migrate Up
--- NOTE: This is an example migration script which you should copy into your project,
--- should you wish to use this package.
+-- NOTE: These migrations are embedded in mssqlrepo and applied by mssqlrepo.Migrate.
+-- They may also be copied into your project and run with sql-migrate.
 
 CREATE TABLE [dbo].[UserRoles] (
     [RoleID] INT NOT NULL IDENTITY (1,1),
@@ -0,0 +1,12 @@
+-- +migrate Up
+CREATE TABLE [dbo].[UserRoleParentsMap] (
+    [RoleID] INT NOT NULL,
+    [ParentRoleID] INT NOT NULL,
+    CONSTRAINT [PK_RoleParent] PRIMARY KEY (RoleID, ParentRoleID),
+    CONSTRAINT [FK_ParentMapRoleID] FOREIGN KEY ([RoleID]) REFERENCES dbo.UserRoles([RoleID]),
+    CONSTRAINT [FK_ParentMapParentRoleID] FOREIGN KEY ([ParentRoleID]) REFERENCES dbo.UserRoles([RoleID]),
+    CONSTRAINT [CK_RoleParentNotSelf] CHECK ([RoleID] <> [ParentRoleID])
+);
+
+-- +migrate Down
+DROP TABLE [dbo].[UserRoleParentsMap];
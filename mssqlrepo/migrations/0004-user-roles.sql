@@ -0,0 +1,15 @@
+-- +migrate Up
+CREATE TABLE [dbo].[UserRolesMap] (
+    [UserID] INT NOT NULL,
+    [RoleID] INT NOT NULL,
+    CONSTRAINT [PK_UserRole] PRIMARY KEY (UserID, RoleID),
+    CONSTRAINT [FK_UserRolesMapUserID] FOREIGN KEY ([UserID]) REFERENCES dbo.Users([UserID]),
+    CONSTRAINT [FK_UserRolesMapRoleID] FOREIGN KEY ([RoleID]) REFERENCES dbo.UserRoles([RoleID])
+);
+
+-- every existing user keeps their primary role
+INSERT INTO [dbo].[UserRolesMap] (UserID, RoleID)
+SELECT UserID, RoleID FROM [dbo].[Users];
+
+-- +migrate Down
+DROP TABLE [dbo].[UserRolesMap];
@@ -0,0 +1,6 @@
+-- +migrate Up
+-- argon2id and scrypt PHC hashes are longer than the 60 characters of a bcrypt hash
+ALTER TABLE [dbo].[Users] ALTER COLUMN [Password] nvarchar(255) NOT NULL;
+
+-- +migrate Down
+ALTER TABLE [dbo].[Users] ALTER COLUMN [Password] nvarchar(60) NOT NULL;
@@ -0,0 +1,10 @@
+-- +migrate Up
+CREATE TABLE [dbo].[LoginAttempts] (
+    [AttemptKey] NVARCHAR(320) NOT NULL,
+    [Failures] INT NOT NULL,
+    [LastFailure] DATETIMEOFFSET NOT NULL,
+    CONSTRAINT [PK_LoginAttempts] PRIMARY KEY ([AttemptKey])
+);
+
+-- +migrate Down
+DROP TABLE [dbo].[LoginAttempts];
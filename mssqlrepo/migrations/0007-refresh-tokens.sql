@@ -0,0 +1,19 @@
+-- +migrate Up
+CREATE TABLE [dbo].[RefreshTokens] (
+    [TokenHash] CHAR(64) NOT NULL,
+    [FamilyID] VARCHAR(64) NOT NULL,
+    [UserID] INT NOT NULL,
+    [Created] DATETIMEOFFSET NOT NULL,
+    [Expiration] DATETIMEOFFSET NOT NULL,
+    [Used] BIT NOT NULL
+        CONSTRAINT [DF_RefreshTokenUsed] DEFAULT (0),
+    [Revoked] BIT NOT NULL
+        CONSTRAINT [DF_RefreshTokenRevoked] DEFAULT (0),
+    CONSTRAINT [PK_RefreshTokenHash] PRIMARY KEY ([TokenHash]),
+    CONSTRAINT [FK_RefreshTokenUserID] FOREIGN KEY ([UserID]) REFERENCES dbo.Users([UserID])
+);
+
+CREATE INDEX [IX_RefreshTokenFamilyID] ON [dbo].[RefreshTokens] ([FamilyID]);
+
+-- +migrate Down
+DROP TABLE [dbo].[RefreshTokens];
@@ -0,0 +1,17 @@
+-- +migrate Up
+ALTER TABLE [dbo].[UserSessions]
+ADD [UserID] INT NULL,
+    [LastSeen] DATETIMEOFFSET NULL,
+    [IPAddress] NVARCHAR(45) NULL,
+    [UserAgent] NVARCHAR(512) NULL;
+
+ALTER TABLE [dbo].[UserSessions]
+ADD CONSTRAINT [FK_UserSessionsUserID] FOREIGN KEY ([UserID]) REFERENCES dbo.Users([UserID]);
+
+CREATE INDEX [IX_UserSessionsUserID] ON [dbo].[UserSessions] ([UserID]);
+
+-- +migrate Down
+DROP INDEX [IX_UserSessionsUserID] ON [dbo].[UserSessions];
+
+ALTER TABLE [dbo].[UserSessions]
+DROP CONSTRAINT [FK_UserSessionsUserID], COLUMN [UserID], [LastSeen], [IPAddress], [UserAgent];
@@ -0,0 +1,22 @@
+-- +migrate Up
+CREATE TABLE [dbo].[AuditLog] (
+    [AuditLogID] BIGINT IDENTITY(1,1) NOT NULL,
+    [EventTime] DATETIMEOFFSET NOT NULL,
+    [EventType] VARCHAR(64) NOT NULL,
+    [Actor] NVARCHAR(255) NULL,
+    [RoleID] VARCHAR(64) NULL,
+    [PermissionID] VARCHAR(64) NULL,
+    [Username] NVARCHAR(255) NULL,
+    [UserID] INT NULL,
+    [SessionID] CHAR(36) NULL,
+    [IPAddress] NVARCHAR(45) NULL,
+    [Success] BIT NOT NULL,
+    [Error] NVARCHAR(1024) NULL,
+    CONSTRAINT [PK_AuditLogID] PRIMARY KEY ([AuditLogID])
+);
+
+CREATE INDEX [IX_AuditLogEventTime] ON [dbo].[AuditLog] ([EventTime]);
+CREATE INDEX [IX_AuditLogUserID] ON [dbo].[AuditLog] ([UserID]);
+
+-- +migrate Down
+DROP TABLE [dbo].[AuditLog];
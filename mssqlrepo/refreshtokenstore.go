@@ -0,0 +1,68 @@
+package mssqlrepo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/syllabix/juno"
+)
+
+//NewRefreshTokenStore is a factory constructor for an mssql juno.RefreshTokenStore, backed by dbo.RefreshTokens
+func NewRefreshTokenStore(db *sql.DB) *RefreshTokenStore {
+	return &RefreshTokenStore{
+		db: db,
+	}
+}
+
+//RefreshTokenStore is the mssql implementation of juno.RefreshTokenStore
+type RefreshTokenStore struct {
+	db *sql.DB
+}
+
+const insertrefreshtoken = `
+    INSERT INTO dbo.RefreshTokens (TokenHash, FamilyID, UserID, Created, Expiration)
+    VALUES (?, ?, ?, ?, ?)`
+
+//CreateRefreshToken stores a new refresh token
+func (s *RefreshTokenStore) CreateRefreshToken(ctx context.Context, t juno.RefreshToken) error {
+	_, err := s.db.ExecContext(ctx, insertrefreshtoken, t.Hash, t.FamilyID, t.UserID, t.Created, t.Expiration)
+	return err
+}
+
+const getrefreshtoken = `
+    SELECT TokenHash, FamilyID, UserID, Created, Expiration, Used, Revoked
+    FROM dbo.RefreshTokens
+    WHERE TokenHash = ?`
+
+//GetRefreshToken returns the token with the provided hash, or juno.ErrInvalidRefreshToken
+func (s *RefreshTokenStore) GetRefreshToken(ctx context.Context, hash string) (*juno.RefreshToken, error) {
+	t := new(juno.RefreshToken)
+	err := s.db.QueryRowContext(ctx, getrefreshtoken, hash).Scan(&t.Hash, &t.FamilyID, &t.UserID, &t.Created, &t.Expiration, &t.Used, &t.Revoked)
+	if err == sql.ErrNoRows {
+		return nil, juno.ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+const userefreshtoken = `UPDATE dbo.RefreshTokens SET Used = 1 WHERE TokenHash = ? AND Used = 0`
+
+//UseRefreshToken marks the token as used, reporting false if it already was
+func (s *RefreshTokenStore) UseRefreshToken(ctx context.Context, hash string) (bool, error) {
+	result, err := s.db.ExecContext(ctx, userefreshtoken, hash)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows == 1, err
+}
+
+const revokerefreshtokenfamily = `UPDATE dbo.RefreshTokens SET Revoked = 1 WHERE FamilyID = ?`
+
+//RevokeRefreshTokenFamily revokes every token in the family
+func (s *RefreshTokenStore) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	_, err := s.db.ExecContext(ctx, revokerefreshtokenfamily, familyID)
+	return err
+}
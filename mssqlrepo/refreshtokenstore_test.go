@@ -0,0 +1,49 @@
+package mssqlrepo
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+
+	"github.com/syllabix/juno"
+)
+
+func TestRefreshTokenStore(t *testing.T) {
+	assert := assert.New(t)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(err)
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(getrefreshtoken)).
+		WithArgs("missing").
+		WillReturnRows(sqlmock.NewRows([]string{"TokenHash", "FamilyID", "UserID", "Created", "Expiration", "Used", "Revoked"}))
+	mock.ExpectExec(regexp.QuoteMeta(userefreshtoken)).
+		WithArgs("hash").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(userefreshtoken)).
+		WithArgs("hash").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(revokerefreshtokenfamily)).
+		WithArgs("family").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	store := NewRefreshTokenStore(db)
+	ctx := context.Background()
+
+	_, err = store.GetRefreshToken(ctx, "missing")
+	assert.Equal(juno.ErrInvalidRefreshToken, err)
+
+	fresh, err := store.UseRefreshToken(ctx, "hash")
+	assert.NoError(err)
+	assert.True(fresh, "The first use of a token should rotate it")
+	fresh, err = store.UseRefreshToken(ctx, "hash")
+	assert.NoError(err)
+	assert.False(fresh, "A token that was already used should be reported")
+
+	assert.NoError(store.RevokeRefreshTokenFamily(ctx, "family"))
+	assert.NoError(mock.ExpectationsWereMet())
+}
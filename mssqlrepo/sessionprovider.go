@@ -1,22 +1,29 @@
 package mssqlrepo
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 
 	"github.com/satori/go.uuid"
 
+	"sync"
 	"time"
 
-	"log"
-
 	"github.com/syllabix/juno"
 )
 
-//NewSessionProvider is a factory constructor used to create a useful instance of SessionProvider
-func NewSessionProvider(db *sql.DB, cookieProvider juno.CookieProvider, duration ...time.Duration) *SessionProvider {
+//NewSessionProvider is a factory constructor used to create a useful instance of SessionProvider.
+//An error is returned if the session statements could not be prepared against the database.
+func NewSessionProvider(db *sql.DB, cookieProvider juno.CookieProvider, duration ...time.Duration) (*SessionProvider, error) {
+	return NewSessionProviderRetry(context.Background(), db, cookieProvider, juno.RetryOptions{}, duration...)
+}
+
+//NewSessionProviderRetry is the same as NewSessionProvider, but retries preparing the session statements
+//according to retry, so services can wait for the database to come up
+func NewSessionProviderRetry(ctx context.Context, db *sql.DB, cookieProvider juno.CookieProvider, retry juno.RetryOptions, duration ...time.Duration) (*SessionProvider, error) {
 
 	var dur time.Duration
 	if len(duration) < 1 {
@@ -25,23 +32,32 @@ func NewSessionProvider(db *sql.DB, cookieProvider juno.CookieProvider, duration
 		dur = duration[0]
 	}
 
-	g, err := db.Prepare(getsession)
-	if err != nil {
-		log.Fatal("Session Provider failed to instantiate:", err)
-	}
-
-	i, err := db.Prepare(insertsession)
+	var g, i *sql.Stmt
+	err := juno.Retry(ctx, retry, func() error {
+		var err error
+		g, err = db.PrepareContext(ctx, getsession)
+		if err != nil {
+			return err
+		}
+		i, err = db.PrepareContext(ctx, insertsession)
+		if err != nil {
+			g.Close()
+			return err
+		}
+		return nil
+	})
 	if err != nil {
-		log.Fatal("Session Provider failed to instantiate:", err)
+		return nil, &juno.StartError{Component: "Session Provider", Err: err}
 	}
 
 	return &SessionProvider{
 		db:         db,
 		cookie:     cookieProvider,
 		duration:   dur,
+		codec:      juno.JSONCodec{},
 		getStmt:    g,
 		insertStmt: i,
-	}
+	}, nil
 }
 
 //SessionProvider is an implementation of juno.SessionProvider using mssql as it's backing store
@@ -51,27 +67,83 @@ type SessionProvider struct {
 	duration   time.Duration
 	getStmt    *sql.Stmt
 	insertStmt *sql.Stmt
+
+	mu       sync.RWMutex
+	absolute time.Duration
+	codec    juno.SessionCodec
+}
+
+//SetAbsoluteTimeout limits how long a session lasts after it was started, however active it is.
+//The duration passed to the constructor remains the idle timeout.
+func (sp *SessionProvider) SetAbsoluteTimeout(absolute time.Duration) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	sp.absolute = absolute
+}
+
+//SetCodec sets the codec used to persist session stores, replacing the default juno.JSONCodec.
+//Stored sessions are not re-encoded, so sessions written with the previous codec can no longer be read.
+func (sp *SessionProvider) SetCodec(codec juno.SessionCodec) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	sp.codec = codec
+}
+
+func (sp *SessionProvider) absoluteTimeout() time.Duration {
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
+	return sp.absolute
+}
+
+func (sp *SessionProvider) sessionCodec() juno.SessionCodec {
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
+	return sp.codec
+}
+
+//extend moves the expiration of s to the idle timeout from now, returning the new expiration. For a juno.StdSession
+//it is capped by the absolute timeout, and the start time is set when missing.
+func (sp *SessionProvider) extend(s juno.Session) time.Time {
+	session, err := juno.AsStdSession(s)
+	if err != nil {
+		return time.Now().Add(sp.duration)
+	}
+	if session.Created.IsZero() {
+		session.Created = time.Now()
+	}
+	session.Extend(sp.duration, sp.absoluteTimeout())
+	return session.Expiration
+}
+
+//extensionDue reports whether the expiration of s is to be written when its store did not change
+func (sp *SessionProvider) extensionDue(s juno.Session) bool {
+	session, err := juno.AsStdSession(s)
+	return err != nil || session.ExtensionDue(sp.duration, sp.absoluteTimeout())
 }
 
 const getsession = `
-    SELECT cast(GUID as char(36)), Expiration, ContentsJSON FROM dbo.UserSessions
+    SELECT cast(GUID as char(36)), StartTime, Expiration, ContentsJSON, LastSeen, IPAddress, UserAgent FROM dbo.UserSessions
     WHERE GUID = ?
 		AND Expiration > SYSDATETIMEOFFSET()
 `
 
-//GetSession tries to retrieve an existing session, if it failes, it creates one. If session creation failed, it returns an error
+//GetSession tries to retrieve an existing session, if it failes, it creates one. If session creation failed, it returns an error.
+//Sessions past the idle or absolute timeout are replaced with a new one. The client ip and user agent are recorded
+//with the session, and the last seen time is updated at most once every juno.LastSeenInterval.
 func (sp *SessionProvider) GetSession(req *http.Request) (juno.Session, error) {
 	baseSession, err := sp.cookie.Read(req)
 	if err != nil {
-		session := juno.NewStdSession(sp.duration)
-		err = sp.SetSession(session)
-		return session, err
+		return sp.newSession(req)
 	}
 
 	var (
 		guid         string
+		created      time.Time
 		expiration   time.Time
 		contentsJSON sql.NullString
+		lastSeen     sql.NullTime
+		ip           sql.NullString
+		userAgent    sql.NullString
 	)
 
 	qID, err := uuid.FromString(baseSession.SessionID())
@@ -79,12 +151,10 @@ func (sp *SessionProvider) GetSession(req *http.Request) (juno.Session, error) {
 		return nil, fmt.Errorf("Invalid GUID: %v", baseSession.SessionID())
 	}
 
-	err = sp.getStmt.QueryRow(qID).Scan(&guid, &expiration, &contentsJSON)
+	err = sp.getStmt.QueryRowContext(req.Context(), qID).Scan(&guid, &created, &expiration, &contentsJSON, &lastSeen, &ip, &userAgent)
 
 	if err == sql.ErrNoRows {
-		session := juno.NewStdSession(sp.duration)
-		err = sp.SetSession(session)
-		return session, err
+		return sp.newSession(req)
 	} else if err != nil {
 		return nil, err
 	}
@@ -97,32 +167,76 @@ func (sp *SessionProvider) GetSession(req *http.Request) (juno.Session, error) {
 
 	session := new(juno.StdSession)
 	session.ID = sessionID
+	session.Created = created
 	session.Expiration = expiration
 
+	if session.AbsoluteExpired(sp.absoluteTimeout()) {
+		_, err = sp.db.ExecContext(req.Context(), deletesession, guid)
+		if err != nil {
+			return nil, err
+		}
+		return sp.newSession(req)
+	}
+
 	if contentsJSON.Valid {
-		var store map[string]interface{}
-		err := json.Unmarshal([]byte(contentsJSON.String), &store)
+		store, err := sp.sessionCodec().Decode([]byte(contentsJSON.String))
 		if err != nil {
 			return session, err
 		}
 		session.ReplaceStore(store)
 	}
 
+	seen := juno.SessionInfo{LastSeen: lastSeen.Time, IPAddress: ip.String, UserAgent: userAgent.String}
+	if seen.Outdated(req) {
+		//the session is still valid when its metadata cannot be recorded, so the failure does not fail the request
+		_, err = sp.db.ExecContext(req.Context(), touchsession, time.Now(), nullString(juno.ClientIP(req)), nullString(req.UserAgent()), guid)
+		if err != nil {
+			log.Println("Unable to record session activity:", err)
+		}
+	}
+
 	return session, nil
 }
 
-const insertsession = `INSERT INTO dbo.UserSessions (GUID, Expiration) VALUES (?, ?)`
+const touchsession = `
+    UPDATE dbo.UserSessions
+    SET LastSeen = ?, IPAddress = ?, UserAgent = ?
+    WHERE GUID = ?`
+
+const insertsession = `
+    INSERT INTO dbo.UserSessions (GUID, StartTime, Expiration, LastSeen, IPAddress, UserAgent)
+    VALUES (?, ?, ?, ?, ?, ?)`
+
+//newSession creates and stores a new session for req, recording the client ip and user agent
+func (sp *SessionProvider) newSession(req *http.Request) (juno.Session, error) {
+	session := juno.NewStdSession(sp.duration)
+	err := sp.insert(req.Context(), session, juno.ClientIP(req), req.UserAgent())
+	return session, err
+}
 
 //SetSession creates a new session and stores it in the database
 func (sp *SessionProvider) SetSession(s juno.Session) error {
-	exp := time.Now().Add(sp.duration)
-	_, err := sp.insertStmt.Exec(s.SessionID(), exp)
+	return sp.SetSessionContext(context.Background(), s)
+}
+
+//SetSessionContext is the same as SetSession, passing ctx through to the database
+func (sp *SessionProvider) SetSessionContext(ctx context.Context, s juno.Session) error {
+	return sp.insert(ctx, s, "", "")
+}
+
+func (sp *SessionProvider) insert(ctx context.Context, s juno.Session, ip, userAgent string) error {
+	exp := sp.extend(s)
+	created := time.Now()
+	if session, err := juno.AsStdSession(s); err == nil {
+		created = session.Created
+	}
+	_, err := sp.insertStmt.ExecContext(ctx, s.SessionID(), created, exp, time.Now(), nullString(ip), nullString(userAgent))
 	return err
 }
 
 const updatesessionDirty = `
     UPDATE dbo.UserSessions
-    SET Expiration = ?, ContentsJSON = ?
+    SET Expiration = ?, ContentsJSON = ?, UserID = ?
     WHERE GUID = ?`
 
 const updatesessionClean = `
@@ -130,19 +244,29 @@ const updatesessionClean = `
     SET Expiration = ?
     WHERE GUID = ?`
 
-//UpdateSession updates the session expiration and contents if dirty
+//UpdateSession updates the session expiration and contents if dirty. The expiration is extended by the idle timeout,
+//but never past the absolute timeout. The expiration of a clean session is written at most once every juno.LastSeenInterval.
+//The session is indexed by the user stored under juno.USER_ID_SESSION_KEY.
 func (sp *SessionProvider) UpdateSession(s juno.Session) error {
-	exp := time.Now().Add(sp.duration)
+	return sp.UpdateSessionContext(context.Background(), s)
+}
+
+//UpdateSessionContext is the same as UpdateSession, passing ctx through to the database
+func (sp *SessionProvider) UpdateSessionContext(ctx context.Context, s juno.Session) error {
+	if !s.StoreDirty() && !sp.extensionDue(s) {
+		return nil
+	}
+	exp := sp.extend(s)
 	if s.StoreDirty() {
-		contentsJSON, err := json.Marshal(s.Store())
+		contentsJSON, err := sp.sessionCodec().Encode(s.Store())
 		if err != nil {
 			return err
 		}
 
-		_, err = sp.db.Exec(updatesessionDirty, exp, string(contentsJSON), s.SessionID())
+		_, err = sp.db.ExecContext(ctx, updatesessionDirty, exp, string(contentsJSON), sessionUserID(s), s.SessionID())
 		return err
 	} else {
-		_, err := sp.db.Exec(updatesessionClean, exp, s.SessionID())
+		_, err := sp.db.ExecContext(ctx, updatesessionClean, exp, s.SessionID())
 		return err
 	}
 }
@@ -151,12 +275,127 @@ const deletesession = `DELETE FROM dbo.UserSessions WHERE GUID = ?`
 
 //EndSession terminates a session be removing it from the database and invlaidating the cookie
 func (sp *SessionProvider) EndSession(w http.ResponseWriter, s juno.Session) error {
+	return sp.EndSessionContext(context.Background(), w, s)
+}
+
+//EndSessionContext is the same as EndSession, passing ctx through to the database
+func (sp *SessionProvider) EndSessionContext(ctx context.Context, w http.ResponseWriter, s juno.Session) error {
 	sp.cookie.Invalidate(w)
-	_, err := sp.db.Exec(deletesession, s.SessionID())
+	_, err := sp.db.ExecContext(ctx, deletesession, s.SessionID())
 	return err
 }
 
+const regeneratesession = `INSERT INTO dbo.UserSessions (GUID, StartTime, Expiration, ContentsJSON, UserID) VALUES (?, ?, ?, ?, ?)`
+
+//RegenerateSession gives the session a new id in a single transaction, and rewrites the cookie
+func (sp *SessionProvider) RegenerateSession(w http.ResponseWriter, s juno.Session) error {
+	return sp.RegenerateSessionContext(context.Background(), w, s)
+}
+
+//RegenerateSessionContext is the same as RegenerateSession, passing ctx through to the database
+func (sp *SessionProvider) RegenerateSessionContext(ctx context.Context, w http.ResponseWriter, s juno.Session) error {
+	session, err := juno.AsStdSession(s)
+	if err != nil {
+		return err
+	}
+	contentsJSON, err := sp.sessionCodec().Encode(s.Store())
+	if err != nil {
+		return err
+	}
+	id := uuid.NewV4()
+	//the new id keeps the start time, so regenerating does not extend the absolute timeout
+	exp := sp.extend(session)
+
+	tx, err := sp.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, regeneratesession, id.String(), session.Created, exp, string(contentsJSON), sessionUserID(s))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.ExecContext(ctx, deletesession, s.SessionID())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	session.ID = id
+	return sp.cookie.Set(w, session)
+}
+
 //SaveSession sets the session id on the cookie
 func (sp *SessionProvider) WriteCookie(w http.ResponseWriter, s juno.Session) error {
 	return sp.cookie.Set(w, s)
 }
+
+const listusersessions = `
+    SELECT cast(GUID as char(36)), StartTime, LastSeen, Expiration, IPAddress, UserAgent FROM dbo.UserSessions
+    WHERE UserID = ?
+        AND Expiration > SYSDATETIMEOFFSET()
+    ORDER BY LastSeen DESC`
+
+//ListUserSessions returns the active sessions of a user, most recently seen first
+func (sp *SessionProvider) ListUserSessions(ctx context.Context, userID int) ([]juno.SessionInfo, error) {
+	rows, err := sp.db.QueryContext(ctx, listusersessions, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []juno.SessionInfo
+	for rows.Next() {
+		var (
+			info      juno.SessionInfo
+			lastSeen  sql.NullTime
+			ip        sql.NullString
+			userAgent sql.NullString
+		)
+		err = rows.Scan(&info.SessionID, &info.Created, &lastSeen, &info.Expiration, &ip, &userAgent)
+		if err != nil {
+			return nil, err
+		}
+		info.UserID = userID
+		info.LastSeen = lastSeen.Time
+		info.IPAddress = ip.String
+		info.UserAgent = userAgent.String
+		sessions = append(sessions, info)
+	}
+	return sessions, rows.Err()
+}
+
+const deleteusersession = `DELETE FROM dbo.UserSessions WHERE UserID = ? AND GUID = ?`
+
+//EndUserSession ends one session of a user. Sessions of other users are not affected.
+func (sp *SessionProvider) EndUserSession(ctx context.Context, userID int, sessionID string) error {
+	_, err := sp.db.ExecContext(ctx, deleteusersession, userID, sessionID)
+	return err
+}
+
+const deleteusersessions = `DELETE FROM dbo.UserSessions WHERE UserID = ?`
+
+//EndUserSessions ends every session of a user except the provided session ids, such as the current one
+func (sp *SessionProvider) EndUserSessions(ctx context.Context, userID int, except ...string) error {
+	query := deleteusersessions
+	args := []interface{}{userID}
+	for _, id := range except {
+		query += " AND GUID <> ?"
+		args = append(args, id)
+	}
+	_, err := sp.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+func sessionUserID(s juno.Session) sql.NullInt64 {
+	id, ok := juno.SessionUserID(s)
+	return sql.NullInt64{Int64: int64(id), Valid: ok}
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
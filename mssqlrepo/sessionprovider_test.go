@@ -0,0 +1,191 @@
+package mssqlrepo
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+
+	"github.com/syllabix/juno"
+)
+
+func TestRegenerateSession(t *testing.T) {
+	assert := assert.New(t)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(err)
+	defer db.Close()
+
+	mock.ExpectPrepare(regexp.QuoteMeta(getsession))
+	mock.ExpectPrepare(regexp.QuoteMeta(insertsession))
+	cookie := juno.NewStdCookieProvider(securecookie.GenerateRandomKey(32), securecookie.GenerateRandomKey(32), "test-cookie")
+	sp, err := NewSessionProvider(db, cookie)
+	assert.NoError(err)
+
+	session := juno.NewStdSession()
+	session.Set(juno.USER_ID_SESSION_KEY, 120)
+	oldID := session.SessionID()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(regeneratesession)).
+		WithArgs(sqlmock.AnyArg(), session.Created, sqlmock.AnyArg(), `{"$types":{"userid":"int"},"userid":120}`, 120).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(deletesession)).
+		WithArgs(oldID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	recorder := httptest.NewRecorder()
+	err = sp.RegenerateSession(recorder, session)
+	assert.NoError(err)
+	assert.NotEqual(oldID, session.SessionID(), "The session should be given a new id in place")
+	userID, _ := session.Get(juno.USER_ID_SESSION_KEY)
+	assert.Equal(120, userID, "The store should be kept")
+	assert.Equal(1, len(recorder.HeaderMap["Set-Cookie"]), "The cookie should be rewritten with the new id")
+	assert.NoError(mock.ExpectationsWereMet())
+}
+
+func TestSessionAbsoluteTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(err)
+	defer db.Close()
+
+	mock.ExpectPrepare(regexp.QuoteMeta(getsession))
+	mock.ExpectPrepare(regexp.QuoteMeta(insertsession))
+	cookie := juno.NewStdCookieProvider(securecookie.GenerateRandomKey(32), securecookie.GenerateRandomKey(32), "test-cookie")
+	sp, err := NewSessionProvider(db, cookie, time.Hour)
+	assert.NoError(err)
+	sp.SetAbsoluteTimeout(24 * time.Hour)
+
+	session := juno.NewStdSession()
+	session.Created = time.Now().Add(-23*time.Hour - 30*time.Minute)
+	sp.extend(session)
+	assert.Equal(session.Created.Add(24*time.Hour), session.Expiration, "The idle expiration should be capped by the absolute timeout")
+	assert.True(session.Remaining() <= 30*time.Minute, "The remaining lifetime should reflect the absolute timeout")
+
+	recorder := httptest.NewRecorder()
+	cookie.Set(recorder, session)
+	req := &http.Request{Header: http.Header{"Cookie": recorder.HeaderMap["Set-Cookie"]}}
+
+	started := time.Now().Add(-25 * time.Hour)
+	mock.ExpectQuery(regexp.QuoteMeta(getsession)).
+		WillReturnRows(sqlmock.NewRows([]string{"GUID", "StartTime", "Expiration", "ContentsJSON", "LastSeen", "IPAddress", "UserAgent"}).
+			AddRow(session.SessionID(), started, time.Now().Add(time.Minute), nil, nil, nil, nil))
+	mock.ExpectExec(regexp.QuoteMeta(deletesession)).
+		WithArgs(session.SessionID()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(insertsession)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	loaded, err := sp.GetSession(req)
+	assert.NoError(err)
+	assert.NotEqual(session.SessionID(), loaded.SessionID(), "A session past the absolute timeout should be replaced, even while it is active")
+	assert.NoError(mock.ExpectationsWereMet())
+}
+
+func TestSessionLastSeen(t *testing.T) {
+	assert := assert.New(t)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(err)
+	defer db.Close()
+
+	mock.ExpectPrepare(regexp.QuoteMeta(getsession))
+	mock.ExpectPrepare(regexp.QuoteMeta(insertsession))
+	cookie := juno.NewStdCookieProvider(securecookie.GenerateRandomKey(32), securecookie.GenerateRandomKey(32), "test-cookie")
+	sp, err := NewSessionProvider(db, cookie)
+	assert.NoError(err)
+
+	session := juno.NewStdSession()
+	recorder := httptest.NewRecorder()
+	cookie.Set(recorder, session)
+	req := &http.Request{
+		Header:     http.Header{"Cookie": recorder.HeaderMap["Set-Cookie"], "User-Agent": []string{"test-agent"}},
+		RemoteAddr: "10.0.0.1:5000",
+	}
+	columns := []string{"GUID", "StartTime", "Expiration", "ContentsJSON", "LastSeen", "IPAddress", "UserAgent"}
+
+	mock.ExpectQuery(regexp.QuoteMeta(getsession)).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(session.SessionID(), session.Created, session.Expiration, nil, time.Now(), "10.0.0.1", "test-agent"))
+	_, err = sp.GetSession(req)
+	assert.NoError(err)
+	assert.NoError(mock.ExpectationsWereMet(), "A recently seen session should not be written")
+
+	mock.ExpectQuery(regexp.QuoteMeta(getsession)).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(session.SessionID(), session.Created, session.Expiration, nil, time.Now().Add(-2*juno.LastSeenInterval), "10.0.0.1", "test-agent"))
+	mock.ExpectExec(regexp.QuoteMeta(touchsession)).
+		WithArgs(sqlmock.AnyArg(), "10.0.0.1", "test-agent", session.SessionID()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	_, err = sp.GetSession(req)
+	assert.NoError(err)
+	assert.NoError(mock.ExpectationsWereMet(), "The last seen time should be updated after the interval")
+
+	mock.ExpectQuery(regexp.QuoteMeta(getsession)).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(session.SessionID(), session.Created, session.Expiration, nil, time.Now(), "10.0.0.2", "test-agent"))
+	mock.ExpectExec(regexp.QuoteMeta(touchsession)).
+		WithArgs(sqlmock.AnyArg(), "10.0.0.1", "test-agent", session.SessionID()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	_, err = sp.GetSession(req)
+	assert.NoError(err)
+	assert.NoError(mock.ExpectationsWereMet(), "A change of ip should be recorded immediately")
+
+	mock.ExpectQuery(regexp.QuoteMeta(getsession)).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(session.SessionID(), session.Created, session.Expiration, nil, nil, nil, nil))
+	mock.ExpectExec(regexp.QuoteMeta(touchsession)).
+		WillReturnError(errors.New("Deadlock"))
+	loaded, err := sp.GetSession(req)
+	assert.NoError(err, "A failure to record the session activity should not fail the request")
+	assert.Equal(session.SessionID(), loaded.SessionID())
+	assert.NoError(mock.ExpectationsWereMet())
+}
+
+func TestUserSessions(t *testing.T) {
+	assert := assert.New(t)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(err)
+	defer db.Close()
+
+	mock.ExpectPrepare(regexp.QuoteMeta(getsession))
+	mock.ExpectPrepare(regexp.QuoteMeta(insertsession))
+	cookie := juno.NewStdCookieProvider(securecookie.GenerateRandomKey(32), securecookie.GenerateRandomKey(32), "test-cookie")
+	sp, err := NewSessionProvider(db, cookie)
+	assert.NoError(err)
+
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta(listusersessions)).
+		WithArgs(120).
+		WillReturnRows(sqlmock.NewRows([]string{"GUID", "StartTime", "LastSeen", "Expiration", "IPAddress", "UserAgent"}).
+			AddRow("a", now, now, now.Add(time.Hour), "10.0.0.1", "test-agent").
+			AddRow("b", now, nil, now.Add(time.Hour), nil, nil))
+	sessions, err := sp.ListUserSessions(context.Background(), 120)
+	assert.NoError(err)
+	assert.Equal(2, len(sessions), "Every active session should be listed")
+	assert.Equal("10.0.0.1", sessions[0].IPAddress, "The session metadata should be returned")
+	assert.Equal(120, sessions[1].UserID, "The user id should be set")
+	assert.True(sessions[1].LastSeen.IsZero(), "Sessions never seen should have a zero last seen time")
+
+	mock.ExpectExec(regexp.QuoteMeta(deleteusersession)).
+		WithArgs(120, "a").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(sp.EndUserSession(context.Background(), 120, "a"))
+
+	mock.ExpectExec(regexp.QuoteMeta(deleteusersessions+" AND GUID <> ?")).
+		WithArgs(120, "b").
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	assert.NoError(sp.EndUserSessions(context.Background(), 120, "b"))
+	assert.NoError(mock.ExpectationsWereMet())
+}
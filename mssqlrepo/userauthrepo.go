@@ -1,9 +1,9 @@
 package mssqlrepo
 
 import (
+	"context"
 	"database/sql"
 
-	"errors"
 
 	"github.com/syllabix/juno"
 )
@@ -28,9 +28,21 @@ const selectbyusername = `
 
 //GetUserByCredentials returns a juno.User for the the provided juno.Credentials
 func (repo *UserAuthenticationRepo) GetUserByCredentials(creds juno.Credentials) (juno.User, error) {
+	return repo.GetUserByCredentialsContext(context.Background(), creds)
+}
+
+//GetUserByCredentialsContext is the same as GetUserByCredentials, passing ctx through to the database
+func (repo *UserAuthenticationRepo) GetUserByCredentialsContext(ctx context.Context, creds juno.Credentials) (juno.User, error) {
 	email := creds.GetUsername()
 	user := juno.StdUser{}
-	err := repo.db.QueryRow(selectbyusername, email).Scan(&user.UserID, &user.Email, &user.Password, &user.RoleID, &user.RoleName, &user.Created, &user.Modified, &user.LastLogin)
+	err := repo.db.QueryRowContext(ctx, selectbyusername, email).Scan(&user.UserID, &user.Email, &user.Password, &user.RoleID, &user.RoleName, &user.Created, &user.Modified, &user.LastLogin)
+	if err == sql.ErrNoRows {
+		return nil, juno.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = repo.loadRoles(ctx, &user)
 	if err != nil {
 		return nil, err
 	}
@@ -45,14 +57,86 @@ const selectbyid = `
 
 //GetUserFromSession returns a juno.User from a provided user.Session
 func (repo *UserAuthenticationRepo) GetUserFromSession(s juno.Session) (juno.User, error) {
-	id, ok := s.Get(juno.USER_ID_SESSION_KEY)
+	return repo.GetUserFromSessionContext(context.Background(), s)
+}
+
+//GetUserFromSessionContext is the same as GetUserFromSession, passing ctx through to the database
+func (repo *UserAuthenticationRepo) GetUserFromSessionContext(ctx context.Context, s juno.Session) (juno.User, error) {
+	id, ok := juno.GetInt(s, juno.USER_ID_SESSION_KEY)
 	if !ok {
-		return nil, errors.New("Session is not authenticated")
+		return nil, juno.ErrNotAuthenticated
 	}
+	return repo.GetUserByID(ctx, id)
+}
+
+//GetUserByID implements juno.UserByIDRepo, returning the user with the provided id
+func (repo *UserAuthenticationRepo) GetUserByID(ctx context.Context, id int) (juno.User, error) {
 	user := new(juno.StdUser)
-	err := repo.db.QueryRow(selectbyid, id).Scan(&user.UserID, &user.Email, &user.RoleID, &user.RoleName)
+	err := repo.db.QueryRowContext(ctx, selectbyid, id).Scan(&user.UserID, &user.Email, &user.RoleID, &user.RoleName)
+	if err == sql.ErrNoRows {
+		return nil, juno.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = repo.loadRoles(ctx, user)
 	if err != nil {
 		return nil, err
 	}
 	return user, nil
 }
+
+const selectuserroles = `
+    SELECT UserRoles.RoleID, UserRoles.RoleName
+    FROM dbo.UserRolesMap
+    JOIN dbo.UserRoles ON UserRolesMap.RoleID = UserRoles.RoleID
+    WHERE UserRolesMap.UserID = ?`
+
+//loadRoles sets every role assigned to the user through dbo.UserRolesMap
+func (repo *UserAuthenticationRepo) loadRoles(ctx context.Context, user *juno.StdUser) error {
+	rows, err := repo.db.QueryContext(ctx, selectuserroles, user.UserID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	roles := []juno.StdUserRole{}
+	for rows.Next() {
+		var role juno.StdUserRole
+		err := rows.Scan(&role.RoleID, &role.RoleName)
+		if err == nil {
+			roles = append(roles, role)
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+	user.AssignedRoles = roles
+	return nil
+}
+
+const insertuserrole = `INSERT INTO dbo.UserRolesMap (UserID, RoleID) VALUES (?, ?)`
+
+//AssignRoleToUser assigns an additional role to the user with the provided id
+func (repo *UserAuthenticationRepo) AssignRoleToUser(ctx context.Context, userID int, role juno.UserRole) error {
+	_, err := repo.db.ExecContext(ctx, insertuserrole, userID, role.ID())
+	return err
+}
+
+const deleteuserrole = `DELETE FROM dbo.UserRolesMap WHERE UserID = ? AND RoleID = ?`
+
+//RevokeRoleFromUser removes an assigned role from the user with the provided id
+func (repo *UserAuthenticationRepo) RevokeRoleFromUser(ctx context.Context, userID int, role juno.UserRole) error {
+	_, err := repo.db.ExecContext(ctx, deleteuserrole, userID, role.ID())
+	return err
+}
+
+const updatepassword = `UPDATE dbo.Users SET Password = ?, Modified = SYSDATETIMEOFFSET() WHERE UserID = ?`
+
+//UpdatePasswordHash implements juno.PasswordRehasher, storing a new password hash for the user
+func (repo *UserAuthenticationRepo) UpdatePasswordHash(ctx context.Context, user juno.User, hash string) error {
+	_, err := repo.db.ExecContext(ctx, updatepassword, hash, user.ID())
+	return err
+}
@@ -0,0 +1,62 @@
+package mssqlrepo
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+
+	"github.com/syllabix/juno"
+)
+
+func TestGetUserFromSessionLoadsRoles(t *testing.T) {
+	assert := assert.New(t)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(err)
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(selectbyid)).
+		WithArgs(120).
+		WillReturnRows(sqlmock.NewRows([]string{"UserID", "Email", "RoleID", "RoleName"}).AddRow(120, "test@juno.com", 2, "blogger"))
+	mock.ExpectQuery(regexp.QuoteMeta(selectuserroles)).
+		WithArgs(120).
+		WillReturnRows(sqlmock.NewRows([]string{"RoleID", "RoleName"}).AddRow(2, "blogger").AddRow(4, "sales"))
+
+	session := juno.NewStdSession()
+	session.Set(juno.USER_ID_SESSION_KEY, 120)
+
+	repo := NewUserAuthenticationRepo(db)
+	user, err := repo.GetUserFromSession(session)
+	assert.NoError(err)
+	roles := juno.RolesOf(user)
+	assert.Equal(2, len(roles), "Every role in dbo.UserRolesMap should be loaded, without repeating the primary role")
+	assert.Equal("2", roles[0].ID())
+	assert.Equal("4", roles[1].ID())
+	assert.NoError(mock.ExpectationsWereMet())
+}
+
+type credentials struct {
+	username, password string
+}
+
+func (c credentials) GetUsername() string { return c.username }
+func (c credentials) GetPassword() string { return c.password }
+
+func TestGetUserByCredentialsNotFound(t *testing.T) {
+	assert := assert.New(t)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(err)
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(selectbyusername)).
+		WithArgs("nobody@juno.com").
+		WillReturnRows(sqlmock.NewRows([]string{"UserID", "Email", "Password", "RoleID", "RoleName", "Created", "Modified", "LastLogin"}))
+
+	repo := NewUserAuthenticationRepo(db)
+	_, err = repo.GetUserByCredentials(credentials{"nobody@juno.com", "s3cret"})
+	assert.Equal(juno.ErrUserNotFound, err, "Unknown usernames should be reported with juno.ErrUserNotFound")
+	assert.NoError(mock.ExpectationsWereMet())
+}
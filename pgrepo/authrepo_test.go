@@ -0,0 +1,69 @@
+package pgrepo
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+
+	"github.com/syllabix/juno"
+)
+
+func TestCreatePermission(t *testing.T) {
+	assert := assert.New(t)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(err)
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(insertpermission)).
+		WithArgs("update", "You can update things").
+		WillReturnRows(sqlmock.NewRows([]string{"permission_id"}).AddRow(7))
+
+	repo := NewAuthRepo(db)
+	perm, err := repo.CreatePermission(juno.NewStdPermission("update", "You can update things"))
+	assert.NoError(err, "Creating a permission should work without error")
+	assert.Equal("7", perm.ID(), "The id returned by the insert should be set on the permission")
+	assert.NoError(mock.ExpectationsWereMet())
+}
+
+func TestCreateRole(t *testing.T) {
+	assert := assert.New(t)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(err)
+	defer db.Close()
+
+	created := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta(insertrole)).
+		WithArgs("blogger").
+		WillReturnRows(sqlmock.NewRows([]string{"role_id", "created"}).AddRow(3, created))
+
+	repo := NewAuthRepo(db)
+	role, err := repo.CreateRole(juno.NewStdRole("blogger"))
+	assert.NoError(err, "Creating a role should work without error")
+	assert.Equal("3", role.ID(), "The id returned by the insert should be set on the role")
+	assert.Equal(created, role.(*juno.StdRole).CreatedDate)
+	assert.NoError(mock.ExpectationsWereMet())
+}
+
+func TestGetRolePermissions(t *testing.T) {
+	assert := assert.New(t)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(err)
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(getrolepermissions)).
+		WillReturnRows(sqlmock.NewRows([]string{"role_id", "permission_id"}).AddRow(1, 2).AddRow(1, 3))
+
+	repo := NewAuthRepo(db)
+	rps, err := repo.GetRolePermissions()
+	assert.NoError(err)
+	assert.Equal(2, len(rps))
+	assert.Equal("1", rps[0].RoleID())
+	assert.Equal("3", rps[1].PermissionID())
+	assert.NoError(mock.ExpectationsWereMet())
+}
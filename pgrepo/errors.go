@@ -0,0 +1,25 @@
+package pgrepo
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/syllabix/juno"
+)
+
+//sqlState is implemented by errors returned from PostgreSQL drivers such as lib/pq and pgx
+type sqlState interface {
+	SQLState() string
+}
+
+//uniqueViolation is the PostgreSQL error code for a unique constraint violation
+const uniqueViolation = "23505"
+
+//permissionError reports unique violations as juno.ErrDuplicatePermission so the Authorizer can recover from them
+func permissionError(err error) error {
+	var state sqlState
+	if errors.As(err, &state) && state.SQLState() == uniqueViolation {
+		return fmt.Errorf("%w: %v", juno.ErrDuplicatePermission, err)
+	}
+	return err
+}
@@ -0,0 +1,18 @@
+package pgrepo
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+)
+
+//Schema is the DDL for every table used by the pgrepo implementations
+//
+//go:embed schema.sql
+var Schema string
+
+//CreateSchema applies Schema to the provided database. It is safe to call on every start up.
+func CreateSchema(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, Schema)
+	return err
+}
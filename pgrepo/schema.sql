@@ -0,0 +1,47 @@
+-- Schema for the pgrepo implementations of juno.AuthRepo, juno.UserAuthRepo and juno.SessionProvider.
+-- Every statement is idempotent so the schema can be applied on each start up.
+
+CREATE TABLE IF NOT EXISTS user_roles (
+    role_id SERIAL PRIMARY KEY,
+    role_name VARCHAR(50) NOT NULL UNIQUE,
+    created TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    permission_id SERIAL PRIMARY KEY,
+    label VARCHAR(50) NOT NULL UNIQUE,
+    description VARCHAR(255) NULL,
+    created TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS user_role_permissions (
+    role_id INT NOT NULL REFERENCES user_roles (role_id),
+    permission_id INT NOT NULL REFERENCES permissions (permission_id),
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS user_role_parents (
+    role_id INT NOT NULL REFERENCES user_roles (role_id),
+    parent_role_id INT NOT NULL REFERENCES user_roles (role_id),
+    PRIMARY KEY (role_id, parent_role_id),
+    CHECK (role_id <> parent_role_id)
+);
+
+CREATE TABLE IF NOT EXISTS users (
+    user_id SERIAL PRIMARY KEY,
+    email VARCHAR(255) NOT NULL UNIQUE,
+    password VARCHAR(255) NOT NULL,
+    role_id INT NOT NULL REFERENCES user_roles (role_id),
+    created TIMESTAMPTZ NOT NULL DEFAULT now(),
+    modified TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_login TIMESTAMPTZ NULL
+);
+
+CREATE TABLE IF NOT EXISTS user_sessions (
+    guid UUID PRIMARY KEY,
+    start_time TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expiration TIMESTAMPTZ NOT NULL,
+    contents JSONB NULL
+);
+
+CREATE INDEX IF NOT EXISTS user_sessions_expiration_idx ON user_sessions (expiration);
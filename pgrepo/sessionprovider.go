@@ -0,0 +1,280 @@
+package pgrepo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/satori/go.uuid"
+
+	"github.com/syllabix/juno"
+)
+
+//NewSessionProvider is a factory constructor used to create a useful instance of SessionProvider
+func NewSessionProvider(db *sql.DB, cookieProvider juno.CookieProvider, duration ...time.Duration) *SessionProvider {
+
+	var dur time.Duration
+	if len(duration) < 1 {
+		dur = time.Minute * 30
+	} else {
+		dur = duration[0]
+	}
+
+	return &SessionProvider{
+		db:       db,
+		cookie:   cookieProvider,
+		duration: dur,
+		codec:    juno.JSONCodec{},
+	}
+}
+
+//SessionProvider is an implementation of juno.SessionProvider using PostgreSQL as its backing store.
+//Session stores are kept in a jsonb column with juno.JSONCodec by default, so their values keep their types.
+type SessionProvider struct {
+	db       *sql.DB
+	cookie   juno.CookieProvider
+	duration time.Duration
+
+	mu       sync.RWMutex
+	codec    juno.SessionCodec
+	absolute time.Duration
+}
+
+//SetCodec sets the codec used to persist session stores, replacing the default juno.JSONCodec. As the contents column
+//is jsonb, the codec must encode stores as JSON. Stored sessions are not re-encoded, so sessions written with the
+//previous codec can no longer be read.
+func (sp *SessionProvider) SetCodec(codec juno.SessionCodec) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	sp.codec = codec
+}
+
+func (sp *SessionProvider) sessionCodec() juno.SessionCodec {
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
+	return sp.codec
+}
+
+//SetAbsoluteTimeout limits how long a session lasts after it was started, however active it is.
+//The duration passed to the constructor remains the idle timeout.
+func (sp *SessionProvider) SetAbsoluteTimeout(absolute time.Duration) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	sp.absolute = absolute
+}
+
+func (sp *SessionProvider) absoluteTimeout() time.Duration {
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
+	return sp.absolute
+}
+
+//extend moves the expiration of s to the idle timeout from now, returning the new expiration. For a juno.StdSession
+//it is capped by the absolute timeout, and the start time is set when missing.
+func (sp *SessionProvider) extend(s juno.Session) time.Time {
+	session, err := juno.AsStdSession(s)
+	if err != nil {
+		return time.Now().Add(sp.duration)
+	}
+	if session.Created.IsZero() {
+		session.Created = time.Now()
+	}
+	session.Extend(sp.duration, sp.absoluteTimeout())
+	return session.Expiration
+}
+
+//extensionDue reports whether the expiration of s is to be written when its store did not change
+func (sp *SessionProvider) extensionDue(s juno.Session) bool {
+	session, err := juno.AsStdSession(s)
+	return err != nil || session.ExtensionDue(sp.duration, sp.absoluteTimeout())
+}
+
+//created returns the start time of s, which is now for sessions other than a juno.StdSession
+func created(s juno.Session) time.Time {
+	if session, err := juno.AsStdSession(s); err == nil {
+		return session.Created
+	}
+	return time.Now()
+}
+
+const getsession = `
+    SELECT guid::text, start_time, expiration, contents FROM user_sessions
+    WHERE guid = $1
+        AND expiration > now()`
+
+//GetSession tries to retrieve an existing session, if it fails, it creates one. If session creation failed, it returns an error.
+//Sessions past the absolute timeout are replaced with a new one.
+func (sp *SessionProvider) GetSession(req *http.Request) (juno.Session, error) {
+	baseSession, err := sp.cookie.Read(req)
+	if err != nil {
+		session := juno.NewStdSession(sp.duration)
+		err = sp.SetSessionContext(req.Context(), session)
+		return session, err
+	}
+
+	var (
+		guid       string
+		started    time.Time
+		expiration time.Time
+		contents   []byte
+	)
+
+	qID, err := uuid.FromString(baseSession.SessionID())
+	if err != nil {
+		return nil, fmt.Errorf("Invalid GUID: %v", baseSession.SessionID())
+	}
+
+	err = sp.db.QueryRowContext(req.Context(), getsession, qID.String()).Scan(&guid, &started, &expiration, &contents)
+
+	if err == sql.ErrNoRows {
+		session := juno.NewStdSession(sp.duration)
+		err = sp.SetSessionContext(req.Context(), session)
+		return session, err
+	} else if err != nil {
+		return nil, err
+	}
+
+	sessionID, err := uuid.FromString(guid)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid GUID: %v", guid)
+	}
+
+	session := new(juno.StdSession)
+	session.ID = sessionID
+	session.Created = started
+	session.Expiration = expiration
+
+	if session.AbsoluteExpired(sp.absoluteTimeout()) {
+		_, err = sp.db.ExecContext(req.Context(), deletesession, guid)
+		if err != nil {
+			return nil, err
+		}
+		session := juno.NewStdSession(sp.duration)
+		err = sp.SetSessionContext(req.Context(), session)
+		return session, err
+	}
+
+	if contents != nil {
+		store, err := sp.sessionCodec().Decode(contents)
+		if err != nil {
+			return session, err
+		}
+		session.ReplaceStore(store)
+	}
+
+	return session, nil
+}
+
+const insertsession = `INSERT INTO user_sessions (guid, start_time, expiration) VALUES ($1, $2, $3)`
+
+//SetSession creates a new session and stores it in the database
+func (sp *SessionProvider) SetSession(s juno.Session) error {
+	return sp.SetSessionContext(context.Background(), s)
+}
+
+//SetSessionContext is the same as SetSession, passing ctx through to the database
+func (sp *SessionProvider) SetSessionContext(ctx context.Context, s juno.Session) error {
+	exp := sp.extend(s)
+	_, err := sp.db.ExecContext(ctx, insertsession, s.SessionID(), created(s), exp)
+	return err
+}
+
+const updatesessionDirty = `
+    UPDATE user_sessions
+    SET expiration = $1, contents = $2
+    WHERE guid = $3`
+
+const updatesessionClean = `
+    UPDATE user_sessions
+    SET expiration = $1
+    WHERE guid = $2`
+
+//UpdateSession updates the session expiration and contents if dirty. The expiration is extended by the idle timeout,
+//but never past the absolute timeout. The expiration of a clean session is written at most once every juno.LastSeenInterval.
+func (sp *SessionProvider) UpdateSession(s juno.Session) error {
+	return sp.UpdateSessionContext(context.Background(), s)
+}
+
+//UpdateSessionContext is the same as UpdateSession, passing ctx through to the database
+func (sp *SessionProvider) UpdateSessionContext(ctx context.Context, s juno.Session) error {
+	if !s.StoreDirty() && !sp.extensionDue(s) {
+		return nil
+	}
+	exp := sp.extend(s)
+	if s.StoreDirty() {
+		contents, err := sp.sessionCodec().Encode(s.Store())
+		if err != nil {
+			return err
+		}
+		_, err = sp.db.ExecContext(ctx, updatesessionDirty, exp, string(contents), s.SessionID())
+		return err
+	}
+	_, err := sp.db.ExecContext(ctx, updatesessionClean, exp, s.SessionID())
+	return err
+}
+
+const deletesession = `DELETE FROM user_sessions WHERE guid = $1`
+
+//EndSession terminates a session by removing it from the database and invalidating the cookie
+func (sp *SessionProvider) EndSession(w http.ResponseWriter, s juno.Session) error {
+	return sp.EndSessionContext(context.Background(), w, s)
+}
+
+//EndSessionContext is the same as EndSession, passing ctx through to the database
+func (sp *SessionProvider) EndSessionContext(ctx context.Context, w http.ResponseWriter, s juno.Session) error {
+	sp.cookie.Invalidate(w)
+	_, err := sp.db.ExecContext(ctx, deletesession, s.SessionID())
+	return err
+}
+
+const regeneratesession = `INSERT INTO user_sessions (guid, start_time, expiration, contents) VALUES ($1, $2, $3, $4)`
+
+//RegenerateSession gives the session a new id in a single transaction, and rewrites the cookie
+func (sp *SessionProvider) RegenerateSession(w http.ResponseWriter, s juno.Session) error {
+	return sp.RegenerateSessionContext(context.Background(), w, s)
+}
+
+//RegenerateSessionContext is the same as RegenerateSession, passing ctx through to the database
+func (sp *SessionProvider) RegenerateSessionContext(ctx context.Context, w http.ResponseWriter, s juno.Session) error {
+	session, err := juno.AsStdSession(s)
+	if err != nil {
+		return err
+	}
+	contents, err := sp.sessionCodec().Encode(s.Store())
+	if err != nil {
+		return err
+	}
+	id := uuid.NewV4()
+	//the new id keeps the start time, so regenerating does not extend the absolute timeout
+	exp := sp.extend(session)
+
+	tx, err := sp.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, regeneratesession, id.String(), session.Created, exp, string(contents))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.ExecContext(ctx, deletesession, s.SessionID())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	session.ID = id
+	return sp.cookie.Set(w, session)
+}
+
+//WriteCookie sets the session id on the cookie
+func (sp *SessionProvider) WriteCookie(w http.ResponseWriter, s juno.Session) error {
+	return sp.cookie.Set(w, s)
+}
@@ -0,0 +1,187 @@
+package pgrepo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+
+	"github.com/syllabix/juno"
+)
+
+var cookieProvider = juno.NewStdCookieProvider(securecookie.GenerateRandomKey(32), securecookie.GenerateRandomKey(32), "test-cookie")
+
+func TestGetSession(t *testing.T) {
+	assert := assert.New(t)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(err)
+	defer db.Close()
+
+	existing := juno.NewStdSession()
+	recorder := httptest.NewRecorder()
+	cookieProvider.Set(recorder, existing)
+	request := &http.Request{Header: http.Header{"Cookie": recorder.HeaderMap["Set-Cookie"]}}
+
+	mock.ExpectQuery(regexp.QuoteMeta(getsession)).
+		WithArgs(existing.SessionID()).
+		WillReturnRows(sqlmock.NewRows([]string{"guid", "start_time", "expiration", "contents"}).
+			AddRow(existing.SessionID(), existing.Created, existing.Expiration, []byte(`{"userid":120}`)))
+
+	sp := NewSessionProvider(db, cookieProvider)
+	session, err := sp.GetSession(request)
+	assert.NoError(err, "Loading a stored session should work without error")
+	assert.Equal(existing.SessionID(), session.SessionID())
+	userID, found := session.Get(juno.USER_ID_SESSION_KEY)
+	assert.True(found, "Session contents should be loaded from the contents column")
+	assert.EqualValues(120, userID)
+	assert.Equal(existing.Created.Unix(), session.(*juno.StdSession).Created.Unix(), "The start time should be loaded into Created")
+	assert.NoError(mock.ExpectationsWereMet())
+}
+
+func TestGetSessionWithoutCookie(t *testing.T) {
+	assert := assert.New(t)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(err)
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta(insertsession)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	sp := NewSessionProvider(db, cookieProvider, time.Hour)
+	session, err := sp.GetSession(&http.Request{})
+	assert.NoError(err, "A request without a cookie should get a new session")
+	assert.NotNil(session)
+	assert.NoError(mock.ExpectationsWereMet())
+}
+
+func TestUpdateSessionDirty(t *testing.T) {
+	assert := assert.New(t)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(err)
+	defer db.Close()
+
+	session := juno.NewStdSession()
+	session.Set(juno.USER_ID_SESSION_KEY, 120)
+
+	mock.ExpectExec(regexp.QuoteMeta(updatesessionDirty)).
+		WithArgs(sqlmock.AnyArg(), `{"$types":{"userid":"int"},"userid":120}`, session.SessionID()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	sp := NewSessionProvider(db, cookieProvider)
+	assert.NoError(sp.UpdateSession(session), "Dirty sessions should persist their contents as JSON")
+	assert.NoError(mock.ExpectationsWereMet())
+}
+
+func TestGetSessionAbsoluteTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(err)
+	defer db.Close()
+
+	existing := juno.NewStdSession()
+	recorder := httptest.NewRecorder()
+	cookieProvider.Set(recorder, existing)
+	request := &http.Request{Header: http.Header{"Cookie": recorder.HeaderMap["Set-Cookie"]}}
+
+	mock.ExpectQuery(regexp.QuoteMeta(getsession)).
+		WithArgs(existing.SessionID()).
+		WillReturnRows(sqlmock.NewRows([]string{"guid", "start_time", "expiration", "contents"}).
+			AddRow(existing.SessionID(), time.Now().Add(-2*time.Hour), time.Now().Add(time.Hour), []byte(`{}`)))
+	mock.ExpectExec(regexp.QuoteMeta(deletesession)).
+		WithArgs(existing.SessionID()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(insertsession)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	sp := NewSessionProvider(db, cookieProvider)
+	sp.SetAbsoluteTimeout(time.Hour)
+	session, err := sp.GetSession(request)
+	assert.NoError(err, "A session past the absolute timeout should be replaced without error")
+	assert.NotEqual(existing.SessionID(), session.SessionID(), "A session past the absolute timeout should be replaced")
+	assert.NoError(mock.ExpectationsWereMet())
+}
+
+func TestUpdateSessionAbsoluteTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(err)
+	defer db.Close()
+
+	session := juno.NewStdSession()
+	session.Created = time.Now().Add(-50 * time.Minute)
+	session.Expiration = time.Now()
+
+	mock.ExpectExec(regexp.QuoteMeta(updatesessionClean)).
+		WithArgs(sqlmock.AnyArg(), session.SessionID()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	sp := NewSessionProvider(db, cookieProvider, time.Hour)
+	sp.SetAbsoluteTimeout(time.Hour)
+	assert.NoError(sp.UpdateSession(session))
+	assert.Equal(session.Created.Add(time.Hour), session.Expiration, "The expiration should not be extended past the absolute timeout")
+	assert.NoError(mock.ExpectationsWereMet())
+}
+
+func TestUpdateSessionCleanThrottled(t *testing.T) {
+	assert := assert.New(t)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(err)
+	defer db.Close()
+
+	sp := NewSessionProvider(db, cookieProvider, time.Hour)
+	session := juno.NewStdSession(time.Hour)
+	assert.NoError(sp.UpdateSession(session), "A recently extended clean session should not be written")
+
+	session.Expiration = time.Now().Add(time.Hour - 2*juno.LastSeenInterval)
+	mock.ExpectExec(regexp.QuoteMeta(updatesessionClean)).
+		WithArgs(sqlmock.AnyArg(), session.SessionID()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(sp.UpdateSession(session))
+	assert.NoError(mock.ExpectationsWereMet(), "The expiration should be written once LastSeenInterval has passed")
+}
+
+type upperKeyCodec struct {
+	juno.JSONCodec
+}
+
+func (c upperKeyCodec) Encode(store map[string]interface{}) ([]byte, error) {
+	upper := make(map[string]interface{}, len(store))
+	for key, val := range store {
+		upper[strings.ToUpper(key)] = val
+	}
+	return c.JSONCodec.Encode(upper)
+}
+
+func TestSetCodec(t *testing.T) {
+	assert := assert.New(t)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(err)
+	defer db.Close()
+
+	session := juno.NewStdSession()
+	session.Set(juno.USER_ID_SESSION_KEY, 120)
+
+	mock.ExpectExec(regexp.QuoteMeta(updatesessionDirty)).
+		WithArgs(sqlmock.AnyArg(), `{"$types":{"USERID":"int"},"USERID":120}`, session.SessionID()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	sp := NewSessionProvider(db, cookieProvider)
+	sp.SetCodec(upperKeyCodec{})
+	assert.NoError(sp.UpdateSession(session))
+	assert.NoError(mock.ExpectationsWereMet(), "Session stores should be encoded with the codec set by SetCodec")
+}
@@ -0,0 +1,88 @@
+package pgrepo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/syllabix/juno"
+)
+
+//NewUserAuthenticationRepo constructor
+func NewUserAuthenticationRepo(db *sql.DB) *UserAuthenticationRepo {
+	return &UserAuthenticationRepo{
+		db: db,
+	}
+}
+
+//UserAuthenticationRepo is the PostgreSQL implementation of the juno.UserAuthRepo
+type UserAuthenticationRepo struct {
+	db *sql.DB
+}
+
+const selectbyusername = `
+    SELECT users.user_id, users.email, users.password, user_roles.role_id, user_roles.role_name, users.created, users.modified, users.last_login
+    FROM users
+    JOIN user_roles ON users.role_id = user_roles.role_id
+    WHERE users.email = $1`
+
+//GetUserByCredentials returns a juno.User for the the provided juno.Credentials
+func (repo *UserAuthenticationRepo) GetUserByCredentials(creds juno.Credentials) (juno.User, error) {
+	return repo.GetUserByCredentialsContext(context.Background(), creds)
+}
+
+//GetUserByCredentialsContext is the same as GetUserByCredentials, passing ctx through to the database
+func (repo *UserAuthenticationRepo) GetUserByCredentialsContext(ctx context.Context, creds juno.Credentials) (juno.User, error) {
+	email := creds.GetUsername()
+	user := juno.StdUser{}
+	var lastLogin sql.NullTime
+	err := repo.db.QueryRowContext(ctx, selectbyusername, email).Scan(&user.UserID, &user.Email, &user.Password, &user.RoleID, &user.RoleName, &user.Created, &user.Modified, &lastLogin)
+	if err == sql.ErrNoRows {
+		return nil, juno.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	user.LastLogin = lastLogin.Time
+	return &user, nil
+}
+
+const selectbyid = `
+    SELECT users.user_id, users.email, user_roles.role_id, user_roles.role_name
+    FROM users
+    JOIN user_roles ON users.role_id = user_roles.role_id
+    WHERE users.user_id = $1`
+
+//GetUserFromSession returns a juno.User from a provided juno.Session
+func (repo *UserAuthenticationRepo) GetUserFromSession(s juno.Session) (juno.User, error) {
+	return repo.GetUserFromSessionContext(context.Background(), s)
+}
+
+//GetUserFromSessionContext is the same as GetUserFromSession, passing ctx through to the database
+func (repo *UserAuthenticationRepo) GetUserFromSessionContext(ctx context.Context, s juno.Session) (juno.User, error) {
+	id, ok := juno.GetInt(s, juno.USER_ID_SESSION_KEY)
+	if !ok {
+		return nil, juno.ErrNotAuthenticated
+	}
+	return repo.GetUserByID(ctx, id)
+}
+
+//GetUserByID implements juno.UserByIDRepo, returning the user with the provided id
+func (repo *UserAuthenticationRepo) GetUserByID(ctx context.Context, id int) (juno.User, error) {
+	user := new(juno.StdUser)
+	err := repo.db.QueryRowContext(ctx, selectbyid, id).Scan(&user.UserID, &user.Email, &user.RoleID, &user.RoleName)
+	if err == sql.ErrNoRows {
+		return nil, juno.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+const updatepassword = `UPDATE users SET password = $1, modified = now() WHERE user_id = $2`
+
+//UpdatePasswordHash implements juno.PasswordRehasher, storing a new password hash for the user
+func (repo *UserAuthenticationRepo) UpdatePasswordHash(ctx context.Context, user juno.User, hash string) error {
+	_, err := repo.db.ExecContext(ctx, updatepassword, hash, user.ID())
+	return err
+}
@@ -0,0 +1,238 @@
+package juno
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+//Policy effects
+const (
+	Permit = "permit"
+	Deny   = "deny"
+)
+
+//Policy combining algorithms
+const (
+	//DenyOverrides denies when any applicable policy denies, otherwise permits when any applicable policy permits
+	DenyOverrides = "deny-overrides"
+	//PermitOverrides permits when any applicable policy permits, otherwise denies when any applicable policy denies
+	PermitOverrides = "permit-overrides"
+)
+
+type (
+	//Attributed is to be implemented by users and resources that expose attributes to policy conditions
+	Attributed interface {
+		Attributes() map[string]interface{}
+	}
+
+	//Policy is an attribute based rule. It applies to a request for one of its Actions, or for any action when Actions
+	//is empty, when its Condition is true. Conditions are expressions over the subject, resource and environment
+	//attributes and the action, such as:
+	//
+	//	resource.amount < 500 && subject.department == 'sales'
+	//
+	//They support ==, !=, <, <=, >, >=, in [list], && (and), || (or), ! (not), parentheses, numbers, quoted strings,
+	//true, false and null. Missing attributes are null. Comparing a missing attribute with anything but the null literal
+	//is unknown, as is using it as a condition, and negating unknown stays unknown, so a condition over a missing
+	//attribute, such as !(resource.amount > 500) or subject.department != 'sales', does not apply.
+	//An empty Condition is always true.
+	Policy struct {
+		ID          string   `json:"id"`
+		Description string   `json:"description,omitempty"`
+		Effect      string   `json:"effect"`
+		Actions     []string `json:"actions,omitempty"`
+		Condition   string   `json:"condition,omitempty"`
+		condition   expression
+	}
+
+	//PolicySet is a list of policies and the algorithm combining their effects
+	PolicySet struct {
+		Algorithm string   `json:"algorithm"`
+		Policies  []Policy `json:"policies"`
+	}
+
+	//AccessRequest describes an attempt by Subject to perform Action on Resource. The Resource may be Attributed or a
+	//map[string]interface{} of attributes, and Environment carries attributes of the request such as the client ip.
+	AccessRequest struct {
+		Subject     User
+		Action      Permission
+		Resource    interface{}
+		Environment map[string]interface{}
+	}
+)
+
+//ParsePolicySet decodes a JSON policy set and compiles its conditions. The algorithm defaults to deny-overrides.
+func ParsePolicySet(data []byte) (*PolicySet, error) {
+	set := new(PolicySet)
+	err := json.Unmarshal(data, set)
+	if err != nil {
+		return nil, err
+	}
+	err = set.compile()
+	if err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+//LoadPolicyFile reads and parses a JSON policy set from path
+func LoadPolicyFile(path string) (*PolicySet, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	set, err := ParsePolicySet(data)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to load policies from %s: %v", path, err)
+	}
+	return set, nil
+}
+
+//compile validates the set and compiles every policy condition
+func (set *PolicySet) compile() error {
+	switch set.Algorithm {
+	case "":
+		set.Algorithm = DenyOverrides
+	case DenyOverrides, PermitOverrides:
+	default:
+		return fmt.Errorf("Unknown policy combining algorithm %s", set.Algorithm)
+	}
+	for i := range set.Policies {
+		policy := &set.Policies[i]
+		if policy.Effect != Permit && policy.Effect != Deny {
+			return fmt.Errorf("Policy %s has unknown effect %s", policy.ID, policy.Effect)
+		}
+		if policy.Condition == "" {
+			policy.condition = literalExpr{true}
+			continue
+		}
+		condition, err := parseExpression(policy.Condition)
+		if err != nil {
+			return fmt.Errorf("Policy %s: %v", policy.ID, err)
+		}
+		policy.condition = condition
+	}
+	return nil
+}
+
+//appliesTo reports whether the policy covers action, matched by permission id or, for a StdPermission, by label
+func (policy *Policy) appliesTo(action Permission) bool {
+	if len(policy.Actions) == 0 {
+		return true
+	}
+	for _, name := range policy.Actions {
+		if name == action.ID() {
+			return true
+		}
+		if std, ok := action.(*StdPermission); ok && name == std.Label {
+			return true
+		}
+	}
+	return false
+}
+
+//policyResult is the outcome of evaluating a policy set
+type policyResult struct {
+	//Effect is Permit or Deny, or empty when no policy applied
+	Effect string
+	//Evaluated are the ids of the policies covering the action whose condition was evaluated
+	Evaluated []string
+	//Matched are the ids of the policies whose condition was true
+	Matched []string
+}
+
+//evaluate runs every policy covering the action against attrs and combines the effects of those that match
+func (set *PolicySet) evaluate(action Permission, attrs map[string]interface{}) (policyResult, error) {
+	var result policyResult
+	permitted, denied := false, false
+	for i := range set.Policies {
+		policy := &set.Policies[i]
+		if !policy.appliesTo(action) {
+			continue
+		}
+		result.Evaluated = append(result.Evaluated, policy.ID)
+		ok, err := evalBool(policy.condition, attrs)
+		if err != nil {
+			return result, fmt.Errorf("Policy %s: %v", policy.ID, err)
+		}
+		if !ok {
+			continue
+		}
+		result.Matched = append(result.Matched, policy.ID)
+		if policy.Effect == Permit {
+			permitted = true
+		} else {
+			denied = true
+		}
+	}
+
+	switch {
+	case denied && (set.Algorithm == DenyOverrides || !permitted):
+		result.Effect = Deny
+	case permitted:
+		result.Effect = Permit
+	}
+	return result, nil
+}
+
+//requestAttributes builds the attributes available to conditions. The subject has id, username and roles (role ids),
+//merged with its own Attributes when it is Attributed. The environment has time, a time.Time, unless provided.
+func requestAttributes(req AccessRequest) map[string]interface{} {
+	subject := map[string]interface{}{}
+	if req.Subject != nil {
+		roles := []string{}
+		for _, role := range RolesOf(req.Subject) {
+			roles = append(roles, role.ID())
+		}
+		subject["id"] = req.Subject.ID()
+		subject["username"] = req.Subject.GetUsername()
+		subject["roles"] = roles
+		if attributed, ok := req.Subject.(Attributed); ok {
+			for k, v := range attributed.Attributes() {
+				subject[k] = v
+			}
+		}
+	}
+
+	resource := map[string]interface{}{}
+	switch r := req.Resource.(type) {
+	case Attributed:
+		resource = r.Attributes()
+	case map[string]interface{}:
+		resource = r
+	}
+
+	environment := map[string]interface{}{"time": time.Now()}
+	for k, v := range req.Environment {
+		environment[k] = v
+	}
+
+	action := ""
+	if req.Action != nil {
+		action = req.Action.ID()
+	}
+	return map[string]interface{}{
+		"subject":     subject,
+		"resource":    resource,
+		"environment": environment,
+		"action":      action,
+	}
+}
+
+//SetPolicies makes Evaluate check set before the role and permission grants
+func (mngr *Authorizer) SetPolicies(set *PolicySet) {
+	mngr.Lock()
+	defer mngr.Unlock()
+	mngr.policies = set
+}
+
+//Evaluate decides an AccessRequest with the attribute based policies set with SetPolicies, combined by the set's algorithm.
+//When no policy applies, it falls back to Authorize, so the role and permission grants and registered conditions decide.
+//Decide explains the outcome.
+func (mngr *Authorizer) Evaluate(ctx context.Context, req AccessRequest) (bool, error) {
+	decision, err := mngr.Decide(ctx, req)
+	return decision.Allowed, err
+}
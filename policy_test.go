@@ -0,0 +1,133 @@
+package juno
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockDepartmentUser struct {
+	StdUser
+	department string
+}
+
+func (u *mockDepartmentUser) Attributes() map[string]interface{} {
+	return map[string]interface{}{"department": u.department}
+}
+
+func TestExpressions(t *testing.T) {
+	assert := assert.New(t)
+
+	attrs := map[string]interface{}{
+		"subject":  map[string]interface{}{"id": 42, "department": "sales", "roles": []string{"1", "4"}},
+		"resource": map[string]interface{}{"amount": 120.5, "owner": 42, "tags": []interface{}{"urgent"}},
+		"action":   "refund",
+	}
+	cases := map[string]bool{
+		"resource.amount < 500 && subject.department == 'sales'":    true,
+		"resource.amount >= 500 or subject.department == \"sales\"": true,
+		"!(resource.amount < 500)":                                  false,
+		"not resource.amount > 100":                                 false,
+		"resource.owner == subject.id":                              true,
+		"'4' in subject.roles":                                      true,
+		"'urgent' in resource.tags && action == 'refund'":           true,
+		"subject.department in ['support', 'billing']":              false,
+		"resource.amount > -1":                                      true,
+		"resource.missing < 10":                                     false,
+		"resource.missing == null":                                  true,
+		"resource.missing":                                          false,
+		"!resource.missing":                                         false,
+		"!(resource.missing > 500)":                                 false,
+		"not resource.missing in ['support']":                       false,
+		"subject.missing != 'sales'":                                false,
+		"!(subject.missing == 'sales')":                             false,
+		"resource.missing != null":                                  false,
+		"!(resource.missing == null)":                               false,
+		"resource.amount != null":                                   true,
+		"resource.missing > 500 || resource.amount > 100":           true,
+		"!(resource.missing > 500 && resource.amount > 500)":        true,
+		"true && (false || subject.id != 7)":                        true,
+	}
+	for src, expected := range cases {
+		expr, err := parseExpression(src)
+		if !assert.NoError(err, "%s should parse", src) {
+			continue
+		}
+		result, err := evalBool(expr, attrs)
+		assert.NoError(err, "%s should evaluate", src)
+		assert.Equal(expected, result, "%s should be %v", src, expected)
+	}
+
+	for _, src := range []string{"resource.amount <", "(true", "'unterminated", "a == b == c", "resource.amount # 1", "and"} {
+		_, err := parseExpression(src)
+		assert.Error(err, "%s should not parse", src)
+	}
+
+	expr, _ := parseExpression("subject.department < 5")
+	_, err := evalBool(expr, attrs)
+	assert.Error(err, "Comparing a string with a number should be an error")
+}
+
+func TestEvaluatePolicies(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	set, err := LoadPolicyFile("testdata/policies.json")
+	assert.NoError(err, "The policy file should load")
+	authorizer := mockAuthorizer()
+	authorizer.SetPolicies(set)
+
+	refund := NewStdPermission("refund", "Refund an order")
+	refund.PermissionID = 5
+	seller := &mockDepartmentUser{department: "sales"}
+	seller.StdUserRole = sales.StdUserRole
+	support := &mockDepartmentUser{department: "support"}
+	support.StdUserRole = sales.StdUserRole
+
+	ok, err := authorizer.Evaluate(ctx, AccessRequest{Subject: seller, Action: refund, Resource: map[string]interface{}{"amount": 120}})
+	assert.NoError(err)
+	assert.True(ok, "A matching permit policy should allow the action without a role grant")
+
+	ok, _ = authorizer.Evaluate(ctx, AccessRequest{Subject: seller, Action: refund, Resource: map[string]interface{}{"amount": 900}})
+	assert.False(ok, "The condition should be checked against the resource")
+
+	ok, _ = authorizer.Evaluate(ctx, AccessRequest{Subject: support, Action: refund, Resource: map[string]interface{}{"amount": 120}})
+	assert.False(ok, "The condition should be checked against the subject")
+
+	frozen := map[string]interface{}{"amount": 120, "frozen": true}
+	ok, _ = authorizer.Evaluate(ctx, AccessRequest{Subject: seller, Action: refund, Resource: frozen})
+	assert.False(ok, "A matching deny policy should override a permit with deny-overrides")
+
+	set.Algorithm = PermitOverrides
+	ok, _ = authorizer.Evaluate(ctx, AccessRequest{Subject: seller, Action: refund, Resource: frozen})
+	assert.True(ok, "A matching permit policy should override a deny with permit-overrides")
+	set.Algorithm = DenyOverrides
+
+	user := &StdUser{UserID: 42}
+	user.StdUserRole = admin.StdUserRole
+	ok, err = authorizer.Evaluate(ctx, AccessRequest{Subject: user, Action: update})
+	assert.NoError(err)
+	assert.True(ok, "Without an applicable policy, the role grant should decide")
+
+	ok, _ = authorizer.Evaluate(ctx, AccessRequest{Subject: user, Action: update, Environment: map[string]interface{}{"maintenance": true}})
+	assert.False(ok, "Environment attributes should be available to policies")
+
+	ok, _ = authorizer.Evaluate(ctx, AccessRequest{Subject: user, Action: canDelete})
+	assert.False(ok, "Without an applicable policy, a missing role grant should deny")
+}
+
+func TestParsePolicySetErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := ParsePolicySet([]byte(`{"algorithm": "first-applicable", "policies": []}`))
+	assert.Error(err, "Unknown combining algorithms should be rejected")
+	_, err = ParsePolicySet([]byte(`{"policies": [{"id": "p", "effect": "allow"}]}`))
+	assert.Error(err, "Unknown effects should be rejected")
+	_, err = ParsePolicySet([]byte(`{"policies": [{"id": "p", "effect": "permit", "condition": "subject.id =="}]}`))
+	assert.Error(err, "Invalid conditions should be rejected when loading")
+
+	set, err := ParsePolicySet([]byte(`{"policies": [{"id": "p", "effect": "permit"}]}`))
+	assert.NoError(err)
+	assert.Equal(DenyOverrides, set.Algorithm, "The algorithm should default to deny-overrides")
+}
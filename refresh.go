@@ -0,0 +1,165 @@
+package juno
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+type (
+	//RefreshToken is a stored refresh token. Only the hash of the token is stored, and every token rotated from
+	//the same login shares a FamilyID.
+	RefreshToken struct {
+		Hash       string
+		FamilyID   string
+		UserID     int
+		Created    time.Time
+		Expiration time.Time
+		Used       bool
+		Revoked    bool
+	}
+
+	//RefreshTokenStore is to be implemented by the persistance mechanism for refresh tokens
+	RefreshTokenStore interface {
+		CreateRefreshToken(ctx context.Context, t RefreshToken) error
+		//GetRefreshToken returns the token with the provided hash, or ErrInvalidRefreshToken
+		GetRefreshToken(ctx context.Context, hash string) (*RefreshToken, error)
+		//UseRefreshToken marks the token as used, reporting false if it already was, so concurrent refreshes cannot both rotate it
+		UseRefreshToken(ctx context.Context, hash string) (bool, error)
+		//RevokeRefreshTokenFamily revokes every token in the family
+		RevokeRefreshTokenFamily(ctx context.Context, familyID string) error
+	}
+)
+
+var (
+	//ErrInvalidRefreshToken is returned when a refresh token is unknown, expired or revoked
+	ErrInvalidRefreshToken = errors.New("The provided refresh token is not valid.")
+	//ErrRefreshTokenReused is returned when a refresh token that was already rotated is used again. Its family is revoked.
+	ErrRefreshTokenReused = errors.New("The provided refresh token has already been used.")
+)
+
+//EnableRefreshTokens lets the Authenticator issue refresh tokens stored in store, valid for ttl or 30 days when ttl is zero.
+//It requires EnableTokens for the access tokens.
+func (a *Authenticator) EnableRefreshTokens(store RefreshTokenStore, ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = 30 * 24 * time.Hour
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.refreshTokens = store
+	a.refreshTTL = ttl
+}
+
+//refreshSettings returns the RefreshTokenStore and ttl set with EnableRefreshTokens
+func (a *Authenticator) refreshSettings() (RefreshTokenStore, time.Duration) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.refreshTokens, a.refreshTTL
+}
+
+//IssueRefreshToken returns a refresh token for u, starting a new token family
+func (a *Authenticator) IssueRefreshToken(ctx context.Context, u User) (string, error) {
+	family, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+	return a.issueRefreshToken(ctx, u.ID(), family)
+}
+
+//Refresh exchanges a refresh token for a new access token and a new refresh token. The presented refresh token is rotated,
+//so it cannot be used again. If a rotated token is presented, its whole family is revoked and ErrRefreshTokenReused is returned,
+//as either the client or an attacker holds a stolen token.
+func (a *Authenticator) Refresh(ctx context.Context, refreshToken string) (accessToken string, newRefreshToken string, err error) {
+	store, _ := a.refreshSettings()
+	if store == nil {
+		return "", "", ErrTokensNotEnabled
+	}
+	hash := hashRefreshToken(refreshToken)
+	stored, err := store.GetRefreshToken(ctx, hash)
+	if err != nil {
+		return "", "", err
+	}
+	if stored.Revoked || time.Now().After(stored.Expiration) {
+		return "", "", ErrInvalidRefreshToken
+	}
+
+	fresh, err := store.UseRefreshToken(ctx, hash)
+	if err != nil {
+		return "", "", err
+	}
+	if !fresh {
+		err = store.RevokeRefreshTokenFamily(ctx, stored.FamilyID)
+		if err != nil {
+			return "", "", err
+		}
+		return "", "", ErrRefreshTokenReused
+	}
+
+	//the user is reloaded so the access token carries their current roles
+	u, err := a.userByID(ctx, stored.UserID)
+	if err != nil {
+		return "", "", err
+	}
+	accessToken, err = a.IssueToken(u)
+	if err != nil {
+		return "", "", err
+	}
+	newRefreshToken, err = a.issueRefreshToken(ctx, stored.UserID, stored.FamilyID)
+	if err != nil {
+		return "", "", err
+	}
+	return accessToken, newRefreshToken, nil
+}
+
+//RevokeRefreshToken revokes the family of the provided refresh token, such as when the user logs out
+func (a *Authenticator) RevokeRefreshToken(ctx context.Context, refreshToken string) error {
+	store, _ := a.refreshSettings()
+	if store == nil {
+		return ErrTokensNotEnabled
+	}
+	stored, err := store.GetRefreshToken(ctx, hashRefreshToken(refreshToken))
+	if err != nil {
+		return err
+	}
+	return store.RevokeRefreshTokenFamily(ctx, stored.FamilyID)
+}
+
+func (a *Authenticator) issueRefreshToken(ctx context.Context, userID int, family string) (string, error) {
+	store, ttl := a.refreshSettings()
+	if store == nil {
+		return "", ErrTokensNotEnabled
+	}
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	err = store.CreateRefreshToken(ctx, RefreshToken{
+		Hash:       hashRefreshToken(token),
+		FamilyID:   family,
+		UserID:     userID,
+		Created:    now,
+		Expiration: now.Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
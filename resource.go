@@ -0,0 +1,91 @@
+package juno
+
+import (
+	"context"
+	"errors"
+)
+
+type (
+	//Owned is to be implemented by resources that belong to a single user, such as a blog post
+	Owned interface {
+		OwnerID() int
+	}
+
+	//Tenanted is to be implemented by users and resources that belong to a tenant
+	Tenanted interface {
+		TenantID() string
+	}
+
+	//Condition is a check that must pass, in addition to the role grant, for a subject to act on a resource.
+	//Conditions are registered per Permission with Authorizer.AddCondition.
+	Condition func(ctx context.Context, subject User, resource interface{}) (bool, error)
+)
+
+var (
+	//ErrConditionNotApplicable is returned by built in conditions when the subject or resource does not expose the attributes they check
+	ErrConditionNotApplicable = errors.New("Resource does not support this condition")
+)
+
+//OwnerOnly is a Condition that passes when the resource is Owned by the subject
+func OwnerOnly() Condition {
+	return func(ctx context.Context, subject User, resource interface{}) (bool, error) {
+		owned, ok := resource.(Owned)
+		if !ok {
+			return false, ErrConditionNotApplicable
+		}
+		return owned.OwnerID() == subject.ID(), nil
+	}
+}
+
+//SameTenant is a Condition that passes when both the subject and resource are Tenanted by the same tenant
+func SameTenant() Condition {
+	return func(ctx context.Context, subject User, resource interface{}) (bool, error) {
+		subjectTenant, ok := subject.(Tenanted)
+		if !ok {
+			return false, ErrConditionNotApplicable
+		}
+		resourceTenant, ok := resource.(Tenanted)
+		if !ok {
+			return false, ErrConditionNotApplicable
+		}
+		return subjectTenant.TenantID() == resourceTenant.TenantID(), nil
+	}
+}
+
+//AnyCondition is a Condition that passes when at least one of the provided conditions passes.
+//Conditions that are not applicable to the resource are treated as failing.
+func AnyCondition(conditions ...Condition) Condition {
+	return func(ctx context.Context, subject User, resource interface{}) (bool, error) {
+		for _, condition := range conditions {
+			ok, err := condition(ctx, subject, resource)
+			if err != nil && !errors.Is(err, ErrConditionNotApplicable) {
+				return false, err
+			}
+			if ok {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+}
+
+//AddCondition registers conditions that must all pass, in addition to the role grant, before Authorize allows the permission
+func (mngr *Authorizer) AddCondition(p Permission, conditions ...Condition) {
+	mngr.Lock()
+	defer mngr.Unlock()
+	if mngr.conditions == nil {
+		mngr.conditions = make(map[string][]Condition)
+	}
+	mngr.conditions[p.ID()] = append(mngr.conditions[p.ID()], conditions...)
+}
+
+//Authorize verifies if subject may perform action on resource. One of the subject's roles must be granted the action,
+//and every Condition registered for the action must pass. Conditions that are not applicable to the resource deny the action.
+func (mngr *Authorizer) Authorize(ctx context.Context, subject User, action Permission, resource interface{}) (bool, error) {
+	if subject == nil {
+		return false, nil
+	}
+
+	decision, err := mngr.decide(ctx, subject, action, resource)
+	return decision.Allowed, err
+}
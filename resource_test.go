@@ -0,0 +1,92 @@
+package juno
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockPost struct {
+	owner  int
+	tenant string
+}
+
+func (p *mockPost) OwnerID() int {
+	return p.owner
+}
+
+func (p *mockPost) TenantID() string {
+	return p.tenant
+}
+
+type mockTenantUser struct {
+	StdUser
+	tenant string
+}
+
+func (u *mockTenantUser) TenantID() string {
+	return u.tenant
+}
+
+func TestAuthorizeOwnerOnly(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	authorizer := mockAuthorizer()
+	authorizer.AddCondition(update, OwnerOnly())
+
+	user := &StdUser{UserID: 42}
+	user.StdUserRole = admin.StdUserRole
+
+	ok, err := authorizer.Authorize(ctx, user, update, &mockPost{owner: 42})
+	assert.NoError(err)
+	assert.True(ok, "Owners should be authorized to update their own resources")
+
+	ok, err = authorizer.Authorize(ctx, user, update, &mockPost{owner: 7})
+	assert.NoError(err)
+	assert.False(ok, "Users should not be authorized to update resources they do not own")
+
+	ok, err = authorizer.Authorize(ctx, user, update, "not owned")
+	assert.NoError(err)
+	assert.False(ok, "Resources that do not expose an owner should be denied")
+
+	outsider := &StdUser{UserID: 42}
+	outsider.RoleID = 9999
+	ok, _ = authorizer.Authorize(ctx, outsider, update, &mockPost{owner: 42})
+	assert.False(ok, "The role must still be granted the permission")
+}
+
+func TestAuthorizeSameTenant(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	authorizer := mockAuthorizer()
+	authorizer.AddCondition(update, AnyCondition(OwnerOnly(), SameTenant()))
+
+	user := &mockTenantUser{tenant: "7"}
+	user.UserID = 1
+	user.StdUserRole = admin.StdUserRole
+
+	ok, err := authorizer.Authorize(ctx, user, update, &mockPost{owner: 99, tenant: "7"})
+	assert.NoError(err)
+	assert.True(ok, "Users should be authorized for resources in their own tenant")
+
+	ok, err = authorizer.Authorize(ctx, user, update, &mockPost{owner: 99, tenant: "8"})
+	assert.NoError(err)
+	assert.False(ok, "Users should not be authorized for resources in another tenant")
+}
+
+func TestAnyConditionWrappedNotApplicable(t *testing.T) {
+	assert := assert.New(t)
+
+	notApplicable := func(ctx context.Context, subject User, resource interface{}) (bool, error) {
+		return false, fmt.Errorf("Resource has no region: %w", ErrConditionNotApplicable)
+	}
+	user := &StdUser{UserID: 42}
+
+	ok, err := AnyCondition(notApplicable, OwnerOnly())(context.Background(), user, &mockPost{owner: 42})
+	assert.NoError(err, "A wrapped ErrConditionNotApplicable should be treated as failing, not as an error")
+	assert.True(ok, "The remaining conditions should still be checked")
+}
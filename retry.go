@@ -0,0 +1,41 @@
+package juno
+
+import (
+	"context"
+	"time"
+)
+
+//RetryOptions configure how start up work against a repository is retried, so services can wait for a database to come up
+type RetryOptions struct {
+	//Attempts is the total number of attempts. Values below 1 are treated as a single attempt.
+	Attempts int
+	//Delay is the wait before the second attempt, doubled after every further failure
+	Delay time.Duration
+	//MaxDelay caps the wait between attempts when greater than zero
+	MaxDelay time.Duration
+}
+
+//Retry calls fn until it succeeds, the attempts in opts are exhausted, or ctx is done. The last error from fn is returned.
+func Retry(ctx context.Context, opts RetryOptions, fn func() error) error {
+	delay := opts.Delay
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || attempt >= opts.Attempts {
+			return err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		delay *= 2
+		if opts.MaxDelay > 0 && delay > opts.MaxDelay {
+			delay = opts.MaxDelay
+		}
+	}
+}
@@ -26,6 +26,12 @@ type RolePermission interface {
 	PermissionID() string
 }
 
+// RoleParent is an interface that exposes a role and one of the parent roles it inherits permissions from
+type RoleParent interface {
+	RoleID() string
+	ParentID() string
+}
+
 //Roles is a map of string keys to Role
 type Roles map[string]Role
 
@@ -1,7 +1,10 @@
 package juno
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"math"
 	"net/http"
 	"sync"
 	"time"
@@ -10,13 +13,28 @@ import (
 )
 
 type (
-	//The SessionProvider is to be implemented by the persistance mechanism for sessions and injected into the session manager
+	//The SessionProvider is to be implemented by the persistance mechanism for sessions and injected into the session manager.
+	//Providers expire sessions after their idle timeout, and may also end active sessions a fixed time after they started.
 	SessionProvider interface {
 		GetSession(*http.Request) (Session, error)
 		SetSession(Session) error
 		EndSession(http.ResponseWriter, Session) error
 		UpdateSession(Session) error
 		WriteCookie(http.ResponseWriter, Session) error
+		//RegenerateSession gives the session a new id, moving its store to the new id, removing the old id from the store,
+		//and rewriting the cookie. It is to be called whenever the privileges of the session change, such as after login,
+		//to prevent session fixation. The session is updated in place, so it stays valid for the rest of the request.
+		RegenerateSession(http.ResponseWriter, Session) error
+	}
+
+	//SessionProviderContext is a SessionProvider that also accepts a context, so cancellation and deadlines reach the data store.
+	//GetSession already receives a context through the request.
+	SessionProviderContext interface {
+		SessionProvider
+		SetSessionContext(context.Context, Session) error
+		EndSessionContext(context.Context, http.ResponseWriter, Session) error
+		UpdateSessionContext(context.Context, Session) error
+		RegenerateSessionContext(context.Context, http.ResponseWriter, Session) error
 	}
 
 	CookieProvider interface {
@@ -45,6 +63,8 @@ var (
 	ErrNoSessionID      = errors.New("Cookie does not have valid session id")
 	ErrInvalidSessionID = errors.New("Session ID present is not valid")
 	ErrSessionExpired   = errors.New("Your session has expired.")
+	//ErrUnsupportedSession is returned when an operation requires a *StdSession
+	ErrUnsupportedSession = errors.New("Session must be a juno.StdSession")
 )
 
 const USER_ID_SESSION_KEY = "userid"
@@ -58,16 +78,29 @@ func NewStdSession(duration ...time.Duration) *StdSession {
 	} else {
 		exp = duration[0]
 	}
+	now := time.Now()
 	return &StdSession{
 		ID:         uuid.NewV4(),
-		Expiration: time.Now().Add(exp),
+		Created:    now,
+		Expiration: now.Add(exp),
 		store:      make(map[string]interface{}),
 	}
 }
 
+//AsStdSession returns s as a *StdSession, or ErrUnsupportedSession
+func AsStdSession(s Session) (*StdSession, error) {
+	std, ok := s.(*StdSession)
+	if !ok {
+		return nil, ErrUnsupportedSession
+	}
+	return std, nil
+}
+
 //StdSession is an implementation of the juno.Session interface
 type StdSession struct {
-	ID         uuid.UUID `db:"GUID"`
+	ID uuid.UUID `db:"GUID"`
+	//Created is when the session was started, from which its absolute lifetime is measured
+	Created    time.Time `db:"StartTime"`
 	Expiration time.Time `db:"Expiration"`
 	store      map[string]interface{}
 	storeDirty bool
@@ -84,6 +117,41 @@ func (s *StdSession) Expired() bool {
 	return time.Now().After(s.Expiration)
 }
 
+//Remaining returns the time left until the session expires, or zero if it has expired
+func (s *StdSession) Remaining() time.Duration {
+	remaining := time.Until(s.Expiration)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+//Extend moves the expiration to idle from now. When absolute is greater than zero, the expiration never passes
+//absolute after Created, so an active session still ends.
+func (s *StdSession) Extend(idle, absolute time.Duration) {
+	s.Expiration = SessionExpiration(time.Now(), s.Created, idle, absolute)
+}
+
+//AbsoluteExpired reports whether the session was created more than absolute ago. It is false when absolute is not greater than zero.
+func (s *StdSession) AbsoluteExpired(absolute time.Duration) bool {
+	return absolute > 0 && time.Now().After(s.Created.Add(absolute))
+}
+
+//ExtensionDue reports whether a SessionProvider is to write the extended expiration of a session whose store did not
+//change. It is false when the expiration was extended less than LastSeenInterval ago, to avoid a write on every request.
+func (s *StdSession) ExtensionDue(idle, absolute time.Duration) bool {
+	return s.Expiration.Before(SessionExpiration(time.Now().Add(-LastSeenInterval), s.Created, idle, absolute))
+}
+
+//SessionExpiration returns idle after now, capped at absolute after created when absolute is greater than zero
+func SessionExpiration(now, created time.Time, idle, absolute time.Duration) time.Time {
+	exp := now.Add(idle)
+	if absolute > 0 && created.Add(absolute).Before(exp) {
+		return created.Add(absolute)
+	}
+	return exp
+}
+
 //Get a value off the session
 func (s *StdSession) Get(key string) (interface{}, bool) {
 	s.RLock()
@@ -92,6 +160,144 @@ func (s *StdSession) Get(key string) (interface{}, bool) {
 	return val, ok
 }
 
+//GetInt returns an integer value of s. Numbers of other types are accepted when they are whole and fit an int,
+//so sessions stored before values were typed, and decoded as plain JSON, can still be read.
+//Like the other typed getters it returns false when the key is missing or holds a value of another type.
+func GetInt(s Session, key string) (int, bool) {
+	n, ok := GetInt64(s, key)
+	if !ok || int64(int(n)) != n {
+		return 0, false
+	}
+	return int(n), true
+}
+
+//GetInt64 is the same as GetInt, for int64 values
+func GetInt64(s Session, key string) (int64, bool) {
+	val, ok := s.Get(key)
+	if !ok {
+		return 0, false
+	}
+	switch n := val.(type) {
+	case int:
+		return int64(n), true
+	case int8:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint:
+		return uintToInt64(uint64(n))
+	case uint8:
+		return int64(n), true
+	case uint16:
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	case uint64:
+		return uintToInt64(n)
+	case float32:
+		return floatToInt64(float64(n))
+	case float64:
+		return floatToInt64(n)
+	case json.Number:
+		i, err := n.Int64()
+		return i, err == nil
+	}
+	return 0, false
+}
+
+func uintToInt64(n uint64) (int64, bool) {
+	if n > math.MaxInt64 {
+		return 0, false
+	}
+	return int64(n), true
+}
+
+func floatToInt64(n float64) (int64, bool) {
+	//float64(math.MaxInt64) rounds up to 2^63, which does not fit an int64
+	if n != math.Trunc(n) || n < math.MinInt64 || n >= math.MaxInt64 {
+		return 0, false
+	}
+	return int64(n), true
+}
+
+//GetFloat64 returns a number value of s as a float64
+func GetFloat64(s Session, key string) (float64, bool) {
+	val, ok := s.Get(key)
+	if !ok {
+		return 0, false
+	}
+	switch n := val.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+//GetString returns a string value of s
+func GetString(s Session, key string) (string, bool) {
+	val, ok := s.Get(key)
+	if !ok {
+		return "", false
+	}
+	str, ok := val.(string)
+	return str, ok
+}
+
+//GetBool returns a bool value of s
+func GetBool(s Session, key string) (bool, bool) {
+	val, ok := s.Get(key)
+	if !ok {
+		return false, false
+	}
+	b, ok := val.(bool)
+	return b, ok
+}
+
+//GetTime returns a time value of s. RFC 3339 strings decoded from plain JSON are also accepted.
+func GetTime(s Session, key string) (time.Time, bool) {
+	val, ok := s.Get(key)
+	if !ok {
+		return time.Time{}, false
+	}
+	switch t := val.(type) {
+	case time.Time:
+		return t, true
+	case string:
+		parsed, err := time.Parse(time.RFC3339Nano, t)
+		return parsed, err == nil
+	}
+	return time.Time{}, false
+}
+
 //Set a value on the session
 func (s *StdSession) Set(key string, value interface{}) {
 	s.Lock()
@@ -0,0 +1,408 @@
+package sqliterepo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/syllabix/juno"
+)
+
+//The NewAuthRepo func return a fully instantiated auth repository that implements the juno.AuthRepo interface.
+//The tables it needs are created the first time it is used.
+func NewAuthRepo(db *sql.DB) *AuthRepo {
+	return &AuthRepo{
+		db:     db,
+		schema: &schema{db: db},
+	}
+}
+
+//AuthRepo is the struct that implements the juno.AuthRepo interface for SQLite
+type AuthRepo struct {
+	db     *sql.DB
+	schema *schema
+}
+
+const getpermissions = `SELECT permission_id, label, COALESCE(description, '') FROM permissions`
+
+//GetPermissions returns all permissions
+func (r *AuthRepo) GetPermissions() ([]juno.Permission, error) {
+	return r.GetPermissionsContext(context.Background())
+}
+
+//GetPermissionsContext is the same as GetPermissions, passing ctx through to the database
+func (r *AuthRepo) GetPermissionsContext(ctx context.Context) ([]juno.Permission, error) {
+	if err := r.schema.ready(ctx); err != nil {
+		return nil, err
+	}
+	rows, err := r.db.QueryContext(ctx, getpermissions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []juno.Permission{}
+	for rows.Next() {
+		permission := new(juno.StdPermission)
+		err := rows.Scan(
+			&permission.PermissionID,
+			&permission.Label,
+			&permission.Description,
+		)
+		if err == nil {
+			results = append(results, permission)
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+const getpermbyname = `SELECT permission_id, label, COALESCE(description, '') FROM permissions WHERE label = ?`
+
+//GetPermission looks up a permission by its label
+func (r *AuthRepo) GetPermission(p juno.Permission) (juno.Permission, error) {
+	return r.GetPermissionContext(context.Background(), p)
+}
+
+//GetPermissionContext is the same as GetPermission, passing ctx through to the database
+func (r *AuthRepo) GetPermissionContext(ctx context.Context, p juno.Permission) (juno.Permission, error) {
+	stdPerm, ok := p.(*juno.StdPermission)
+	if !ok {
+		return nil, fmt.Errorf("Unexpected error type of %s recieved, expected %s", reflect.TypeOf(p), "*juno.StdPermission")
+	}
+	if err := r.schema.ready(ctx); err != nil {
+		return nil, err
+	}
+	permission := new(juno.StdPermission)
+	err := r.db.QueryRowContext(ctx, getpermbyname, stdPerm.Label).Scan(&permission.PermissionID, &permission.Label, &permission.Description)
+	if err != nil {
+		return nil, err
+	}
+	return permission, nil
+}
+
+const insertpermission = `INSERT INTO permissions (label, description) VALUES (?, ?)`
+
+//CreatePermission takes an implementation of the juno.Permission interface to create the permission
+func (r *AuthRepo) CreatePermission(p juno.Permission) (juno.Permission, error) {
+	return r.CreatePermissionContext(context.Background(), p)
+}
+
+//CreatePermissionContext is the same as CreatePermission, passing ctx through to the database
+func (r *AuthRepo) CreatePermissionContext(ctx context.Context, p juno.Permission) (juno.Permission, error) {
+	if stdPerm, ok := p.(*juno.StdPermission); ok {
+		if err := r.schema.ready(ctx); err != nil {
+			return nil, err
+		}
+		result, err := r.db.ExecContext(ctx, insertpermission, stdPerm.Label, stdPerm.Description)
+		if err != nil {
+			return nil, permissionError(err)
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		stdPerm.PermissionID = int(id)
+		return stdPerm, nil
+	}
+	return nil, fmt.Errorf("Invalid Permissions type of %s passed to add function. Expecting juno.StdPermission", reflect.TypeOf(p))
+}
+
+const getroles = `SELECT role_id, role_name, created FROM user_roles`
+
+//GetRoles returns all roles
+func (r *AuthRepo) GetRoles() ([]juno.Role, error) {
+	return r.GetRolesContext(context.Background())
+}
+
+//GetRolesContext is the same as GetRoles, passing ctx through to the database
+func (r *AuthRepo) GetRolesContext(ctx context.Context) ([]juno.Role, error) {
+	if err := r.schema.ready(ctx); err != nil {
+		return nil, err
+	}
+	rows, err := r.db.QueryContext(ctx, getroles)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []juno.Role{}
+	for rows.Next() {
+		role := juno.NewStdRole("")
+		err := rows.Scan(
+			&role.RoleID,
+			&role.RoleName,
+			&role.CreatedDate,
+		)
+		if err == nil {
+			results = append(results, role)
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+const insertrole = `INSERT INTO user_roles (role_name, created) VALUES (?, ?)`
+
+//CreateRole stores a new role, setting its generated id and creation date
+func (r *AuthRepo) CreateRole(role juno.Role) (juno.Role, error) {
+	return r.CreateRoleContext(context.Background(), role)
+}
+
+//CreateRoleContext is the same as CreateRole, passing ctx through to the database
+func (r *AuthRepo) CreateRoleContext(ctx context.Context, role juno.Role) (juno.Role, error) {
+	if stdrole, ok := role.(*juno.StdRole); ok {
+		if err := r.schema.ready(ctx); err != nil {
+			return nil, err
+		}
+		stdrole.CreatedDate = time.Now().UTC()
+		result, err := r.db.ExecContext(ctx, insertrole, stdrole.RoleName, stdrole.CreatedDate)
+		if err != nil {
+			return nil, err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		stdrole.RoleID = int(id)
+		return stdrole, nil
+	}
+	return nil, fmt.Errorf("Invalid Role type of %s passed to CreateRole. Expecting juno.StdRole", reflect.TypeOf(role))
+}
+
+//RolePermission is an implementation of juno.RolePermission, and used to expose the role/permission grant relationships to Authorizer
+type RolePermission struct {
+	RID int `db:"role_id"`
+	PID int `db:"permission_id"`
+}
+
+//RoleID implements the juno.RolePermission RoleID getter
+func (rp *RolePermission) RoleID() string {
+	return strconv.Itoa(rp.RID)
+}
+
+//PermissionID implements the juno.RolePermission PermissionID getter
+func (rp *RolePermission) PermissionID() string {
+	return strconv.Itoa(rp.PID)
+}
+
+const getrolepermissions = `SELECT role_id, permission_id FROM user_role_permissions`
+
+//GetRolePermissions returns a slice of RolePermission which is intended to associate a role with a granted permission
+func (r *AuthRepo) GetRolePermissions() ([]juno.RolePermission, error) {
+	return r.GetRolePermissionsContext(context.Background())
+}
+
+//GetRolePermissionsContext is the same as GetRolePermissions, passing ctx through to the database
+func (r *AuthRepo) GetRolePermissionsContext(ctx context.Context) ([]juno.RolePermission, error) {
+	if err := r.schema.ready(ctx); err != nil {
+		return nil, err
+	}
+	rows, err := r.db.QueryContext(ctx, getrolepermissions)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []juno.RolePermission{}
+	for rows.Next() {
+		rp := new(RolePermission)
+		err := rows.Scan(
+			&rp.RID,
+			&rp.PID,
+		)
+		if err == nil {
+			results = append(results, rp)
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+const insertrolepermission = `INSERT INTO user_role_permissions (role_id, permission_id) VALUES (?, ?)`
+
+//AssignPermissionToRole grants a role a permission
+func (r *AuthRepo) AssignPermissionToRole(role juno.Role, perm juno.Permission) error {
+	return r.AssignPermissionToRoleContext(context.Background(), role, perm)
+}
+
+//AssignPermissionToRoleContext is the same as AssignPermissionToRole, passing ctx through to the database
+func (r *AuthRepo) AssignPermissionToRoleContext(ctx context.Context, role juno.Role, perm juno.Permission) error {
+	stdRole, ok := role.(*juno.StdRole)
+	if !ok {
+		return fmt.Errorf("Invalid Role type of %s passed to AssignPermissionToRole. Expecting juno.StdRole", reflect.TypeOf(role))
+	}
+	stdPerm, ok := perm.(*juno.StdPermission)
+	if !ok {
+		return fmt.Errorf("Invalid Permissions type of %s passed to AssignPermissionToRole. Expecting juno.StdPermission", reflect.TypeOf(perm))
+	}
+	if err := r.schema.ready(ctx); err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx, insertrolepermission, stdRole.RoleID, stdPerm.PermissionID)
+	return err
+}
+
+const revokepermission = `DELETE FROM user_role_permissions WHERE role_id = ? AND permission_id = ?`
+
+//RevokePermissionFromRole takes a juno.StdRole and juno.StdPermission (implementations of the respective interface) and removes their grant relationship in the database.
+func (r *AuthRepo) RevokePermissionFromRole(role juno.Role, perm juno.Permission) error {
+	return r.RevokePermissionFromRoleContext(context.Background(), role, perm)
+}
+
+//RevokePermissionFromRoleContext is the same as RevokePermissionFromRole, passing ctx through to the database
+func (r *AuthRepo) RevokePermissionFromRoleContext(ctx context.Context, role juno.Role, perm juno.Permission) error {
+	stdRole, ok := role.(*juno.StdRole)
+	if !ok {
+		return fmt.Errorf("Invalid Role type of %s passed to RevokePermissionFromRole. Expecting juno.StdRole", reflect.TypeOf(role))
+	}
+	stdPerm, ok := perm.(*juno.StdPermission)
+	if !ok {
+		return fmt.Errorf("Invalid Permissions type of %s passed to RevokePermissionFromRole. Expecting juno.StdPermission", reflect.TypeOf(perm))
+	}
+	if err := r.schema.ready(ctx); err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx, revokepermission, stdRole.RoleID, stdPerm.PermissionID)
+	return err
+}
+
+const getrole = `SELECT role_id, role_name, created FROM user_roles WHERE role_name = ?`
+
+//GetRole looks up a role by its name
+func (r *AuthRepo) GetRole(role juno.Role) (juno.Role, error) {
+	return r.GetRoleContext(context.Background(), role)
+}
+
+//GetRoleContext is the same as GetRole, passing ctx through to the database
+func (r *AuthRepo) GetRoleContext(ctx context.Context, role juno.Role) (juno.Role, error) {
+	stdRole, ok := role.(*juno.StdRole)
+	if !ok {
+		return nil, fmt.Errorf("Invalid Role type of %s passed to GetRole. Expecting juno.StdRole", reflect.TypeOf(role))
+	}
+	if err := r.schema.ready(ctx); err != nil {
+		return nil, err
+	}
+	retRole := juno.NewStdRole("")
+	err := r.db.QueryRowContext(ctx, getrole, stdRole.RoleName).Scan(&retRole.RoleID, &retRole.RoleName, &retRole.CreatedDate)
+	if err != nil {
+		return nil, err
+	}
+	return retRole, nil
+}
+
+//RoleParent is an implementation of juno.RoleParent, and used to expose the role hierarchy to Authorizer
+type RoleParent struct {
+	RID       int `db:"role_id"`
+	ParentRID int `db:"parent_role_id"`
+}
+
+//RoleID implements the juno.RoleParent RoleID getter
+func (rp *RoleParent) RoleID() string {
+	return strconv.Itoa(rp.RID)
+}
+
+//ParentID implements the juno.RoleParent ParentID getter
+func (rp *RoleParent) ParentID() string {
+	return strconv.Itoa(rp.ParentRID)
+}
+
+const getroleparents = `SELECT role_id, parent_role_id FROM user_role_parents`
+
+//GetRoleParents returns a slice of RoleParent which is intended to associate a role with the roles it inherits from
+func (r *AuthRepo) GetRoleParents() ([]juno.RoleParent, error) {
+	return r.GetRoleParentsContext(context.Background())
+}
+
+//GetRoleParentsContext is the same as GetRoleParents, passing ctx through to the database
+func (r *AuthRepo) GetRoleParentsContext(ctx context.Context) ([]juno.RoleParent, error) {
+	if err := r.schema.ready(ctx); err != nil {
+		return nil, err
+	}
+	rows, err := r.db.QueryContext(ctx, getroleparents)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []juno.RoleParent{}
+	for rows.Next() {
+		rp := new(RoleParent)
+		err := rows.Scan(
+			&rp.RID,
+			&rp.ParentRID,
+		)
+		if err == nil {
+			results = append(results, rp)
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+const insertroleparent = `INSERT INTO user_role_parents (role_id, parent_role_id) VALUES (?, ?)`
+
+//AssignParentToRole makes role inherit the permissions granted to parent
+func (r *AuthRepo) AssignParentToRole(role juno.Role, parent juno.Role) error {
+	return r.AssignParentToRoleContext(context.Background(), role, parent)
+}
+
+//AssignParentToRoleContext is the same as AssignParentToRole, passing ctx through to the database
+func (r *AuthRepo) AssignParentToRoleContext(ctx context.Context, role juno.Role, parent juno.Role) error {
+	stdRole, ok := role.(*juno.StdRole)
+	if !ok {
+		return fmt.Errorf("Invalid Role type of %s passed to AssignParentToRole. Expecting juno.StdRole", reflect.TypeOf(role))
+	}
+	stdParent, ok := parent.(*juno.StdRole)
+	if !ok {
+		return fmt.Errorf("Invalid Role type of %s passed to AssignParentToRole. Expecting juno.StdRole", reflect.TypeOf(parent))
+	}
+	if err := r.schema.ready(ctx); err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx, insertroleparent, stdRole.RoleID, stdParent.RoleID)
+	return err
+}
+
+const revokeroleparent = `DELETE FROM user_role_parents WHERE role_id = ? AND parent_role_id = ?`
+
+//RevokeParentFromRole stops role inheriting the permissions granted to parent
+func (r *AuthRepo) RevokeParentFromRole(role juno.Role, parent juno.Role) error {
+	return r.RevokeParentFromRoleContext(context.Background(), role, parent)
+}
+
+//RevokeParentFromRoleContext is the same as RevokeParentFromRole, passing ctx through to the database
+func (r *AuthRepo) RevokeParentFromRoleContext(ctx context.Context, role juno.Role, parent juno.Role) error {
+	stdRole, ok := role.(*juno.StdRole)
+	if !ok {
+		return fmt.Errorf("Invalid Role type of %s passed to RevokeParentFromRole. Expecting juno.StdRole", reflect.TypeOf(role))
+	}
+	stdParent, ok := parent.(*juno.StdRole)
+	if !ok {
+		return fmt.Errorf("Invalid Role type of %s passed to RevokeParentFromRole. Expecting juno.StdRole", reflect.TypeOf(parent))
+	}
+	if err := r.schema.ready(ctx); err != nil {
+		return err
+	}
+	_, err := r.db.ExecContext(ctx, revokeroleparent, stdRole.RoleID, stdParent.RoleID)
+	return err
+}
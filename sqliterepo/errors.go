@@ -0,0 +1,60 @@
+package sqliterepo
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/syllabix/juno"
+)
+
+//sqliteErrorCode is implemented by errors returned from SQLite drivers exposing the extended result code,
+//such as modernc.org/sqlite
+type sqliteErrorCode interface {
+	Code() int
+}
+
+//SQLite extended result codes for unique and primary key constraint violations
+const (
+	errConstraintPrimaryKey = 1555
+	errConstraintUnique     = 2067
+)
+
+func isDuplicateKey(err error) bool {
+	for ; err != nil; err = errors.Unwrap(err) {
+		code, ok := extendedCode(err)
+		if ok {
+			return code == errConstraintUnique || code == errConstraintPrimaryKey
+		}
+	}
+	return false
+}
+
+//extendedCode returns the extended result code of a driver error. mattn/go-sqlite3 errors carry it in an ExtendedCode
+//field rather than a method, so the field is read without importing the driver.
+func extendedCode(err error) (int, bool) {
+	if coded, ok := err.(sqliteErrorCode); ok {
+		return coded.Code(), true
+	}
+	v := reflect.ValueOf(err)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return 0, false
+	}
+	field := v.FieldByName("ExtendedCode")
+	switch field.Kind() {
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return int(field.Int()), true
+	}
+	return 0, false
+}
+
+//permissionError reports unique constraint failures as juno.ErrDuplicatePermission so the Authorizer can recover from them
+func permissionError(err error) error {
+	if isDuplicateKey(err) {
+		return fmt.Errorf("%w: %v", juno.ErrDuplicatePermission, err)
+	}
+	return err
+}
@@ -0,0 +1,50 @@
+package sqliterepo
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/syllabix/juno"
+)
+
+type codedError int
+
+func (e codedError) Code() int {
+	return int(e)
+}
+
+func (e codedError) Error() string {
+	return fmt.Sprintf("sqlite error %d", int(e))
+}
+
+//mattnError has the shape of sqlite3.Error from mattn/go-sqlite3, which exposes its codes as fields
+type mattnError struct {
+	Code         int
+	ExtendedCode int
+}
+
+func (e mattnError) Error() string {
+	return fmt.Sprintf("sqlite error %d", e.ExtendedCode)
+}
+
+func TestPermissionError(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(errors.Is(permissionError(codedError(errConstraintUnique)), juno.ErrDuplicatePermission),
+		"Unique constraint violations should be reported as duplicate permissions")
+	assert.True(errors.Is(permissionError(fmt.Errorf("insert: %w", codedError(errConstraintPrimaryKey))), juno.ErrDuplicatePermission),
+		"Wrapped primary key violations should be reported as duplicate permissions")
+	assert.False(errors.Is(permissionError(codedError(19)), juno.ErrDuplicatePermission),
+		"Other constraint violations should be returned as they are")
+	assert.True(errors.Is(permissionError(mattnError{Code: 19, ExtendedCode: errConstraintUnique}), juno.ErrDuplicatePermission),
+		"Unique constraint violations from mattn/go-sqlite3 should be reported as duplicate permissions")
+	assert.True(errors.Is(permissionError(fmt.Errorf("insert: %w", &mattnError{Code: 19, ExtendedCode: errConstraintPrimaryKey})), juno.ErrDuplicatePermission),
+		"Wrapped primary key violations from mattn/go-sqlite3 should be reported as duplicate permissions")
+	assert.False(errors.Is(permissionError(mattnError{Code: 19, ExtendedCode: 787}), juno.ErrDuplicatePermission),
+		"Foreign key violations from mattn/go-sqlite3 should be returned as they are")
+	assert.False(errors.Is(permissionError(errors.New("UNIQUE constraint failed: permissions.name")), juno.ErrDuplicatePermission),
+		"Errors should not be matched by their message")
+}
@@ -0,0 +1,78 @@
+package sqliterepo
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+//Schema is the DDL for every table used by the sqliterepo implementations.
+//Session expiration is stored as unix seconds so it can be compared against strftime('%s', 'now').
+const Schema = `
+CREATE TABLE IF NOT EXISTS user_roles (
+    role_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    role_name TEXT NOT NULL UNIQUE,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    permission_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    label TEXT NOT NULL UNIQUE,
+    description TEXT NULL,
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS user_role_permissions (
+    role_id INTEGER NOT NULL REFERENCES user_roles (role_id),
+    permission_id INTEGER NOT NULL REFERENCES permissions (permission_id),
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS user_role_parents (
+    role_id INTEGER NOT NULL REFERENCES user_roles (role_id),
+    parent_role_id INTEGER NOT NULL REFERENCES user_roles (role_id),
+    PRIMARY KEY (role_id, parent_role_id),
+    CHECK (role_id <> parent_role_id)
+);
+
+CREATE TABLE IF NOT EXISTS users (
+    user_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    email TEXT NOT NULL UNIQUE,
+    password TEXT NOT NULL,
+    role_id INTEGER NOT NULL REFERENCES user_roles (role_id),
+    created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    modified TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_login TIMESTAMP NULL
+);
+
+CREATE TABLE IF NOT EXISTS user_sessions (
+    guid TEXT PRIMARY KEY,
+    start_time INTEGER NOT NULL DEFAULT (CAST(strftime('%s', 'now') AS INTEGER)),
+    expiration INTEGER NOT NULL,
+    contents TEXT NULL
+);
+
+CREATE INDEX IF NOT EXISTS user_sessions_expiration_idx ON user_sessions (expiration);
+`
+
+//schema lazily creates the tables in Schema the first time a repository touches the database
+type schema struct {
+	sync.Mutex
+	db      *sql.DB
+	created bool
+}
+
+//ready creates the tables on first use. A failed attempt is retried on the next call.
+func (s *schema) ready(ctx context.Context) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.created {
+		return nil
+	}
+	_, err := s.db.ExecContext(ctx, Schema)
+	if err != nil {
+		return err
+	}
+	s.created = true
+	return nil
+}
@@ -0,0 +1,298 @@
+package sqliterepo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/satori/go.uuid"
+
+	"github.com/syllabix/juno"
+)
+
+//NewSessionProvider is a factory constructor used to create a useful instance of SessionProvider.
+//The tables it needs are created the first time it is used.
+func NewSessionProvider(db *sql.DB, cookieProvider juno.CookieProvider, duration ...time.Duration) *SessionProvider {
+
+	var dur time.Duration
+	if len(duration) < 1 {
+		dur = time.Minute * 30
+	} else {
+		dur = duration[0]
+	}
+
+	return &SessionProvider{
+		db:       db,
+		schema:   &schema{db: db},
+		cookie:   cookieProvider,
+		duration: dur,
+		codec:    juno.JSONCodec{},
+	}
+}
+
+//SessionProvider is an implementation of juno.SessionProvider using SQLite as its backing store
+type SessionProvider struct {
+	db       *sql.DB
+	schema   *schema
+	cookie   juno.CookieProvider
+	duration time.Duration
+
+	mu       sync.RWMutex
+	codec    juno.SessionCodec
+	absolute time.Duration
+}
+
+//SetCodec sets the codec used to persist session stores, replacing the default juno.JSONCodec.
+//Stored sessions are not re-encoded, so sessions written with the previous codec can no longer be read.
+func (sp *SessionProvider) SetCodec(codec juno.SessionCodec) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	sp.codec = codec
+}
+
+func (sp *SessionProvider) sessionCodec() juno.SessionCodec {
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
+	return sp.codec
+}
+
+//SetAbsoluteTimeout limits how long a session lasts after it was started, however active it is.
+//The duration passed to the constructor remains the idle timeout.
+func (sp *SessionProvider) SetAbsoluteTimeout(absolute time.Duration) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	sp.absolute = absolute
+}
+
+func (sp *SessionProvider) absoluteTimeout() time.Duration {
+	sp.mu.RLock()
+	defer sp.mu.RUnlock()
+	return sp.absolute
+}
+
+//extend moves the expiration of s to the idle timeout from now, returning the new expiration. For a juno.StdSession
+//it is capped by the absolute timeout, and the start time is set when missing.
+func (sp *SessionProvider) extend(s juno.Session) time.Time {
+	session, err := juno.AsStdSession(s)
+	if err != nil {
+		return time.Now().Add(sp.duration)
+	}
+	if session.Created.IsZero() {
+		session.Created = time.Now()
+	}
+	session.Extend(sp.duration, sp.absoluteTimeout())
+	return session.Expiration
+}
+
+//extensionDue reports whether the expiration of s is to be written when its store did not change
+func (sp *SessionProvider) extensionDue(s juno.Session) bool {
+	session, err := juno.AsStdSession(s)
+	return err != nil || session.ExtensionDue(sp.duration, sp.absoluteTimeout())
+}
+
+//created returns the start time of s, which is now for sessions other than a juno.StdSession
+func created(s juno.Session) time.Time {
+	if session, err := juno.AsStdSession(s); err == nil {
+		return session.Created
+	}
+	return time.Now()
+}
+
+const getsession = `
+    SELECT guid, start_time, expiration, contents FROM user_sessions
+    WHERE guid = ?
+        AND expiration > CAST(strftime('%s', 'now') AS INTEGER)`
+
+//GetSession tries to retrieve an existing session, if it fails, it creates one. If session creation failed, it returns an error.
+//Sessions past the absolute timeout are replaced with a new one.
+func (sp *SessionProvider) GetSession(req *http.Request) (juno.Session, error) {
+	baseSession, err := sp.cookie.Read(req)
+	if err != nil {
+		session := juno.NewStdSession(sp.duration)
+		err = sp.SetSessionContext(req.Context(), session)
+		return session, err
+	}
+
+	if err := sp.schema.ready(req.Context()); err != nil {
+		return nil, err
+	}
+
+	var (
+		guid       string
+		started    int64
+		expiration int64
+		contents   sql.NullString
+	)
+
+	qID, err := uuid.FromString(baseSession.SessionID())
+	if err != nil {
+		return nil, fmt.Errorf("Invalid GUID: %v", baseSession.SessionID())
+	}
+
+	err = sp.db.QueryRowContext(req.Context(), getsession, qID.String()).Scan(&guid, &started, &expiration, &contents)
+
+	if err == sql.ErrNoRows {
+		session := juno.NewStdSession(sp.duration)
+		err = sp.SetSessionContext(req.Context(), session)
+		return session, err
+	} else if err != nil {
+		return nil, err
+	}
+
+	sessionID, err := uuid.FromString(guid)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid GUID: %v", guid)
+	}
+
+	session := new(juno.StdSession)
+	session.ID = sessionID
+	session.Created = time.Unix(started, 0)
+	session.Expiration = time.Unix(expiration, 0)
+
+	if session.AbsoluteExpired(sp.absoluteTimeout()) {
+		_, err = sp.db.ExecContext(req.Context(), deletesession, guid)
+		if err != nil {
+			return nil, err
+		}
+		session := juno.NewStdSession(sp.duration)
+		err = sp.SetSessionContext(req.Context(), session)
+		return session, err
+	}
+
+	if contents.Valid {
+		store, err := sp.sessionCodec().Decode([]byte(contents.String))
+		if err != nil {
+			return session, err
+		}
+		session.ReplaceStore(store)
+	}
+
+	return session, nil
+}
+
+const insertsession = `INSERT INTO user_sessions (guid, start_time, expiration) VALUES (?, ?, ?)`
+
+//SetSession creates a new session and stores it in the database
+func (sp *SessionProvider) SetSession(s juno.Session) error {
+	return sp.SetSessionContext(context.Background(), s)
+}
+
+//SetSessionContext is the same as SetSession, passing ctx through to the database
+func (sp *SessionProvider) SetSessionContext(ctx context.Context, s juno.Session) error {
+	if err := sp.schema.ready(ctx); err != nil {
+		return err
+	}
+	exp := sp.extend(s).Unix()
+	_, err := sp.db.ExecContext(ctx, insertsession, s.SessionID(), created(s).Unix(), exp)
+	return err
+}
+
+const updatesessionDirty = `
+    UPDATE user_sessions
+    SET expiration = ?, contents = ?
+    WHERE guid = ?`
+
+const updatesessionClean = `
+    UPDATE user_sessions
+    SET expiration = ?
+    WHERE guid = ?`
+
+//UpdateSession updates the session expiration and contents if dirty. The expiration is extended by the idle timeout,
+//but never past the absolute timeout. The expiration of a clean session is written at most once every juno.LastSeenInterval.
+func (sp *SessionProvider) UpdateSession(s juno.Session) error {
+	return sp.UpdateSessionContext(context.Background(), s)
+}
+
+//UpdateSessionContext is the same as UpdateSession, passing ctx through to the database
+func (sp *SessionProvider) UpdateSessionContext(ctx context.Context, s juno.Session) error {
+	if !s.StoreDirty() && !sp.extensionDue(s) {
+		return nil
+	}
+	if err := sp.schema.ready(ctx); err != nil {
+		return err
+	}
+	exp := sp.extend(s).Unix()
+	if s.StoreDirty() {
+		contents, err := sp.sessionCodec().Encode(s.Store())
+		if err != nil {
+			return err
+		}
+		_, err = sp.db.ExecContext(ctx, updatesessionDirty, exp, string(contents), s.SessionID())
+		return err
+	}
+	_, err := sp.db.ExecContext(ctx, updatesessionClean, exp, s.SessionID())
+	return err
+}
+
+const deletesession = `DELETE FROM user_sessions WHERE guid = ?`
+
+//EndSession terminates a session by removing it from the database and invalidating the cookie
+func (sp *SessionProvider) EndSession(w http.ResponseWriter, s juno.Session) error {
+	return sp.EndSessionContext(context.Background(), w, s)
+}
+
+//EndSessionContext is the same as EndSession, passing ctx through to the database
+func (sp *SessionProvider) EndSessionContext(ctx context.Context, w http.ResponseWriter, s juno.Session) error {
+	sp.cookie.Invalidate(w)
+	if err := sp.schema.ready(ctx); err != nil {
+		return err
+	}
+	_, err := sp.db.ExecContext(ctx, deletesession, s.SessionID())
+	return err
+}
+
+const regeneratesession = `INSERT INTO user_sessions (guid, start_time, expiration, contents) VALUES (?, ?, ?, ?)`
+
+//RegenerateSession gives the session a new id in a single transaction, and rewrites the cookie
+func (sp *SessionProvider) RegenerateSession(w http.ResponseWriter, s juno.Session) error {
+	return sp.RegenerateSessionContext(context.Background(), w, s)
+}
+
+//RegenerateSessionContext is the same as RegenerateSession, passing ctx through to the database
+func (sp *SessionProvider) RegenerateSessionContext(ctx context.Context, w http.ResponseWriter, s juno.Session) error {
+	session, err := juno.AsStdSession(s)
+	if err != nil {
+		return err
+	}
+	if err := sp.schema.ready(ctx); err != nil {
+		return err
+	}
+	contents, err := sp.sessionCodec().Encode(s.Store())
+	if err != nil {
+		return err
+	}
+	id := uuid.NewV4()
+	//the new id keeps the start time, so regenerating does not extend the absolute timeout
+	exp := sp.extend(session)
+
+	tx, err := sp.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, regeneratesession, id.String(), session.Created.Unix(), exp.Unix(), string(contents))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.ExecContext(ctx, deletesession, s.SessionID())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	session.ID = id
+	session.Expiration = time.Unix(exp.Unix(), 0)
+	return sp.cookie.Set(w, session)
+}
+
+//WriteCookie sets the session id on the cookie
+func (sp *SessionProvider) WriteCookie(w http.ResponseWriter, s juno.Session) error {
+	return sp.cookie.Set(w, s)
+}
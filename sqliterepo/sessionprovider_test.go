@@ -0,0 +1,99 @@
+package sqliterepo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/DATA-DOG/go-sqlmock.v1"
+
+	"github.com/syllabix/juno"
+)
+
+var cookieProvider = juno.NewStdCookieProvider(securecookie.GenerateRandomKey(32), securecookie.GenerateRandomKey(32), "test-cookie")
+
+func TestSchemaCreatedOnFirstUse(t *testing.T) {
+	assert := assert.New(t)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(err)
+	defer db.Close()
+
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS user_roles").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(insertsession)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(insertsession)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	sp := NewSessionProvider(db, cookieProvider)
+	assert.NoError(sp.SetSession(juno.NewStdSession()), "The schema should be created before the first insert")
+	assert.NoError(sp.SetSession(juno.NewStdSession()), "The schema should only be created once")
+	assert.NoError(mock.ExpectationsWereMet())
+}
+
+func TestGetSessionUnixExpiration(t *testing.T) {
+	assert := assert.New(t)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(err)
+	defer db.Close()
+
+	existing := juno.NewStdSession()
+	recorder := httptest.NewRecorder()
+	cookieProvider.Set(recorder, existing)
+	request := &http.Request{Header: http.Header{"Cookie": recorder.HeaderMap["Set-Cookie"]}}
+
+	expiration := time.Now().Add(time.Hour).Unix()
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS user_roles").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(getsession)).
+		WithArgs(existing.SessionID()).
+		WillReturnRows(sqlmock.NewRows([]string{"guid", "start_time", "expiration", "contents"}).
+			AddRow(existing.SessionID(), existing.Created.Unix(), expiration, `{"userid":120}`))
+
+	sp := NewSessionProvider(db, cookieProvider)
+	session, err := sp.GetSession(request)
+	assert.NoError(err, "Loading a stored session should work without error")
+	assert.Equal(existing.SessionID(), session.SessionID())
+	assert.Equal(expiration, session.(*juno.StdSession).Expiration.Unix(), "Expiration should be read back from unix seconds")
+	_, found := session.Get(juno.USER_ID_SESSION_KEY)
+	assert.True(found, "Session contents should be loaded from the contents column")
+	assert.NoError(mock.ExpectationsWereMet())
+}
+
+func TestGetSessionAbsoluteTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(err)
+	defer db.Close()
+
+	existing := juno.NewStdSession()
+	recorder := httptest.NewRecorder()
+	cookieProvider.Set(recorder, existing)
+	request := &http.Request{Header: http.Header{"Cookie": recorder.HeaderMap["Set-Cookie"]}}
+
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS user_roles").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(getsession)).
+		WithArgs(existing.SessionID()).
+		WillReturnRows(sqlmock.NewRows([]string{"guid", "start_time", "expiration", "contents"}).
+			AddRow(existing.SessionID(), time.Now().Add(-2*time.Hour).Unix(), time.Now().Add(time.Hour).Unix(), `{}`))
+	mock.ExpectExec(regexp.QuoteMeta(deletesession)).
+		WithArgs(existing.SessionID()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(insertsession)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	sp := NewSessionProvider(db, cookieProvider)
+	sp.SetAbsoluteTimeout(time.Hour)
+	session, err := sp.GetSession(request)
+	assert.NoError(err, "A session past the absolute timeout should be replaced without error")
+	assert.NotEqual(existing.SessionID(), session.SessionID(), "A session past the absolute timeout should be replaced")
+	assert.NoError(mock.ExpectationsWereMet())
+}
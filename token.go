@@ -0,0 +1,367 @@
+package juno
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Supported token signing algorithms
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+)
+
+var (
+	//ErrInvalidToken is returned when a bearer token is malformed, has an invalid signature or claims that do not match
+	ErrInvalidToken = errors.New("The provided token is not valid.")
+	//ErrTokenExpired is returned when a bearer token is past its expiration, including the leeway
+	ErrTokenExpired = errors.New("The provided token has expired.")
+	//ErrNoBearerToken is returned when a request does not carry an Authorization: Bearer header
+	ErrNoBearerToken = errors.New("The request does not have a bearer token.")
+	//ErrTokensNotEnabled is returned when tokens are issued or verified before EnableTokens was called
+	ErrTokensNotEnabled = errors.New("Token authentication is not enabled.")
+)
+
+type (
+	//TokenKey is a key used to sign or verify tokens, identified in the token header by its ID (kid)
+	TokenKey struct {
+		ID        string
+		Algorithm string
+		//Key is a []byte secret for HS256, an *rsa.PrivateKey or *rsa.PublicKey for RS256,
+		//or an ed25519.PrivateKey or ed25519.PublicKey for EdDSA. Public keys can only verify tokens.
+		Key interface{}
+	}
+
+	//TokenOptions configure the tokens issued and accepted by an Authenticator
+	TokenOptions struct {
+		Issuer   string
+		Audience string
+		//TTL is how long issued tokens are valid, defaulting to 15 minutes
+		TTL time.Duration
+		//Leeway is the clock skew allowed when checking the expiration and not before claims
+		Leeway time.Duration
+	}
+
+	//TokenClaims are the claims carried by tokens issued by an Authenticator. RoleIDs are the roles of the user when the
+	//token was issued, while AuthenticateBearer loads the user's current roles through the UserAuthRepo.
+	TokenClaims struct {
+		Subject   string   `json:"sub"`
+		UserID    int      `json:"uid"`
+		RoleIDs   []string `json:"roles,omitempty"`
+		Issuer    string   `json:"iss,omitempty"`
+		Audience  Audience `json:"aud,omitempty"`
+		IssuedAt  int64    `json:"iat"`
+		NotBefore int64    `json:"nbf"`
+		ExpiresAt int64    `json:"exp"`
+		TokenID   string   `json:"jti"`
+	}
+
+	//Audience is the aud claim of a token. As allowed by RFC 7519 it is decoded from either a string or an array
+	//of strings, and encoded as a string when it holds a single value.
+	Audience []string
+
+	tokenHeader struct {
+		Algorithm string `json:"alg"`
+		Type      string `json:"typ"`
+		KeyID     string `json:"kid,omitempty"`
+	}
+)
+
+//EnableTokens lets the Authenticator issue and verify bearer tokens. The first key signs new tokens, so services that
+//only verify tokens can be configured with public keys. Every key is accepted when verifying, so keys can be rotated by
+//prepending a new key and dropping the old one once its tokens have expired.
+func (a *Authenticator) EnableTokens(opts TokenOptions, keys ...TokenKey) error {
+	if len(keys) == 0 {
+		return errors.New("At least one token key is required")
+	}
+	for _, key := range keys {
+		if err := key.validate(); err != nil {
+			return err
+		}
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = 15 * time.Minute
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.tokenOpts = opts
+	a.tokenKeys = keys
+	return nil
+}
+
+//tokenSettings returns the options and keys set with EnableTokens
+func (a *Authenticator) tokenSettings() (TokenOptions, []TokenKey) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.tokenOpts, a.tokenKeys
+}
+
+//TokensEnabled reports whether EnableTokens was called, so bearer tokens can be verified
+func (a *Authenticator) TokensEnabled() bool {
+	_, keys := a.tokenSettings()
+	return len(keys) > 0
+}
+
+//IssueToken returns a signed token carrying the user id and role ids of u
+func (a *Authenticator) IssueToken(u User) (string, error) {
+	opts, keys := a.tokenSettings()
+	if len(keys) == 0 {
+		return "", ErrTokensNotEnabled
+	}
+	key := keys[0]
+
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims := TokenClaims{
+		Subject:   strconv.Itoa(u.ID()),
+		UserID:    u.ID(),
+		Issuer:    opts.Issuer,
+		IssuedAt:  now.Unix(),
+		NotBefore: now.Unix(),
+		ExpiresAt: now.Add(opts.TTL).Unix(),
+		TokenID:   hex.EncodeToString(jti),
+	}
+	if opts.Audience != "" {
+		claims.Audience = Audience{opts.Audience}
+	}
+	for _, role := range RolesOf(u) {
+		claims.RoleIDs = append(claims.RoleIDs, role.ID())
+	}
+
+	header, err := json.Marshal(tokenHeader{Algorithm: key.Algorithm, Type: "JWT", KeyID: key.ID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := encodeSegment(header) + "." + encodeSegment(payload)
+	signature, err := key.sign([]byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + encodeSegment(signature), nil
+}
+
+//VerifyToken checks the signature and claims of token, returning the claims when it is valid
+func (a *Authenticator) VerifyToken(token string) (*TokenClaims, error) {
+	opts, keys := a.tokenSettings()
+	if len(keys) == 0 {
+		return nil, ErrTokensNotEnabled
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	var header tokenHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrInvalidToken
+	}
+	key, ok := tokenKey(keys, header.KeyID)
+	//the algorithm is bound to the key, so a token cannot pick a weaker algorithm or "none"
+	if !ok || header.Algorithm != key.Algorithm {
+		return nil, ErrInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !key.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return nil, ErrInvalidToken
+	}
+
+	claims := new(TokenClaims)
+	if err := decodeSegment(parts[1], claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	now := time.Now()
+	leeway := int64(opts.Leeway / time.Second)
+	if now.Unix() > claims.ExpiresAt+leeway {
+		return nil, ErrTokenExpired
+	}
+	if now.Unix() < claims.NotBefore-leeway {
+		return nil, ErrInvalidToken
+	}
+	if claims.Issuer != opts.Issuer || !claims.Audience.accepts(opts.Audience) {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+//BearerToken returns the token from the Authorization: Bearer header of req, or an empty string
+func BearerToken(req *http.Request) string {
+	auth := req.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+//AuthenticateBearer verifies the Authorization: Bearer token of req and loads its user through the UserAuthRepo,
+//so the same User and UserRole are returned as for a cookie session
+func (a *Authenticator) AuthenticateBearer(req *http.Request) (User, error) {
+	token := BearerToken(req)
+	if token == "" {
+		return nil, ErrNoBearerToken
+	}
+	claims, err := a.VerifyToken(token)
+	if err != nil {
+		return nil, err
+	}
+	return a.UserFromClaims(req.Context(), claims)
+}
+
+//UserFromClaims loads the user identified by claims through the UserAuthRepo
+func (a *Authenticator) UserFromClaims(ctx context.Context, claims *TokenClaims) (User, error) {
+	return a.userByID(ctx, claims.UserID)
+}
+
+//userByID loads a user through the UserByIDRepo, falling back to the UserAuthRepo with a session that only carries the user id
+func (a *Authenticator) userByID(ctx context.Context, userID int) (User, error) {
+	if a.byID != nil {
+		return a.byID.GetUserByID(ctx, userID)
+	}
+	s := NewStdSession()
+	s.Set(USER_ID_SESSION_KEY, userID)
+	return a.repo.GetUserFromSessionContext(ctx, s)
+}
+
+//MarshalJSON encodes a single audience as a string and several as an array
+func (aud Audience) MarshalJSON() ([]byte, error) {
+	if len(aud) == 1 {
+		return json.Marshal(aud[0])
+	}
+	return json.Marshal([]string(aud))
+}
+
+//UnmarshalJSON decodes an audience from either a string or an array of strings
+func (aud *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*aud = Audience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*aud = many
+	return nil
+}
+
+//accepts reports whether a token for aud is meant for the configured audience.
+//Without a configured audience only tokens without an audience are accepted.
+func (aud Audience) accepts(audience string) bool {
+	if audience == "" {
+		return len(aud) == 0
+	}
+	for _, a := range aud {
+		if a == audience {
+			return true
+		}
+	}
+	return false
+}
+
+//tokenKey finds the key for kid. Tokens without a kid are only accepted when there is a single key.
+func tokenKey(keys []TokenKey, kid string) (TokenKey, bool) {
+	if kid == "" {
+		return keys[0], len(keys) == 1
+	}
+	for _, key := range keys {
+		if key.ID == kid {
+			return key, true
+		}
+	}
+	return TokenKey{}, false
+}
+
+func (k TokenKey) validate() error {
+	var ok bool
+	switch k.Algorithm {
+	case HS256:
+		secret, isSecret := k.Key.([]byte)
+		ok = isSecret && len(secret) >= 32
+	case RS256:
+		switch k.Key.(type) {
+		case *rsa.PrivateKey, *rsa.PublicKey:
+			ok = true
+		}
+	case EdDSA:
+		switch k.Key.(type) {
+		case ed25519.PrivateKey, ed25519.PublicKey:
+			ok = true
+		}
+	}
+	if !ok {
+		return fmt.Errorf("Token key %s is not a valid %s key", k.ID, k.Algorithm)
+	}
+	return nil
+}
+
+func (k TokenKey) sign(input []byte) ([]byte, error) {
+	switch key := k.Key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write(input)
+		return mac.Sum(nil), nil
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256(input)
+		return rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	case ed25519.PrivateKey:
+		return ed25519.Sign(key, input), nil
+	}
+	return nil, fmt.Errorf("Token key %s cannot sign tokens", k.ID)
+}
+
+func (k TokenKey) verify(input, signature []byte) bool {
+	switch key := k.Key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write(input)
+		return hmac.Equal(mac.Sum(nil), signature)
+	case *rsa.PrivateKey:
+		return verifyRS256(&key.PublicKey, input, signature)
+	case *rsa.PublicKey:
+		return verifyRS256(key, input, signature)
+	case ed25519.PrivateKey:
+		return ed25519.Verify(key.Public().(ed25519.PublicKey), input, signature)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, input, signature)
+	}
+	return false
+}
+
+func verifyRS256(key *rsa.PublicKey, input, signature []byte) bool {
+	digest := sha256.Sum256(input)
+	return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+}
+
+func encodeSegment(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,202 @@
+package juno
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tokenAuthenticator(opts TokenOptions, keys ...TokenKey) (*Authenticator, *StdUser) {
+	u := &StdUser{UserID: 7, Email: "test@juno.com"}
+	u.RoleID = 2
+	u.AssignedRoles = []StdUserRole{{RoleID: 4}}
+	a := NewAuthenticator(&rehashingUserAuthRepo{user: u})
+	if err := a.EnableTokens(opts, keys...); err != nil {
+		panic(err)
+	}
+	return a, u
+}
+
+func TestTokenAlgorithms(t *testing.T) {
+	assert := assert.New(t)
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	keys := []TokenKey{
+		{ID: "hs", Algorithm: HS256, Key: []byte(strings.Repeat("k", 32))},
+		{ID: "rs", Algorithm: RS256, Key: rsaKey},
+		{ID: "ed", Algorithm: EdDSA, Key: edKey},
+	}
+	for _, key := range keys {
+		a, u := tokenAuthenticator(TokenOptions{Issuer: "juno"}, key)
+		token, err := a.IssueToken(u)
+		assert.NoError(err)
+
+		claims, err := a.VerifyToken(token)
+		assert.NoError(err, "A %s token should verify", key.Algorithm)
+		assert.Equal(7, claims.UserID)
+		assert.Equal("7", claims.Subject)
+		assert.Equal([]string{"2", "4"}, claims.RoleIDs, "A %s token should carry every role id of the user", key.Algorithm)
+
+		tampered := token[:len(token)-4] + "AAAA"
+		_, err = a.VerifyToken(tampered)
+		assert.Equal(ErrInvalidToken, err, "A %s token with an invalid signature should be rejected", key.Algorithm)
+	}
+
+	verifier, _ := tokenAuthenticator(TokenOptions{Issuer: "juno"}, TokenKey{ID: "rs", Algorithm: RS256, Key: &rsaKey.PublicKey})
+	signer, u := tokenAuthenticator(TokenOptions{Issuer: "juno"}, keys[1])
+	token, _ := signer.IssueToken(u)
+	_, err := verifier.VerifyToken(token)
+	assert.NoError(err, "Public keys should verify tokens")
+	_, err = verifier.IssueToken(u)
+	assert.Error(err, "Public keys should not be able to issue tokens")
+
+	a := NewAuthenticator(&rehashingUserAuthRepo{})
+	assert.Error(a.EnableTokens(TokenOptions{}, TokenKey{ID: "short", Algorithm: HS256, Key: []byte("short")}), "Short HS256 secrets should be rejected")
+}
+
+func TestTokenKeyRotation(t *testing.T) {
+	assert := assert.New(t)
+
+	old := TokenKey{ID: "2023", Algorithm: HS256, Key: []byte(strings.Repeat("o", 32))}
+	current := TokenKey{ID: "2024", Algorithm: HS256, Key: []byte(strings.Repeat("c", 32))}
+
+	before, u := tokenAuthenticator(TokenOptions{}, old)
+	token, _ := before.IssueToken(u)
+
+	rotated, _ := tokenAuthenticator(TokenOptions{}, current, old)
+	_, err := rotated.VerifyToken(token)
+	assert.NoError(err, "Tokens signed with a previous key should verify while the key is kept")
+	fresh, _ := rotated.IssueToken(u)
+	assert.True(strings.HasPrefix(fresh, encodeSegment([]byte(`{"alg":"HS256","typ":"JWT","kid":"2024"}`))), "New tokens should be signed with the first key")
+
+	retired, _ := tokenAuthenticator(TokenOptions{}, current)
+	_, err = retired.VerifyToken(token)
+	assert.Equal(ErrInvalidToken, err, "Tokens signed with a dropped key should be rejected")
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	confused, _ := tokenAuthenticator(TokenOptions{}, TokenKey{ID: "2024", Algorithm: RS256, Key: &rsaKey.PublicKey})
+	_, err = confused.VerifyToken(fresh)
+	assert.Equal(ErrInvalidToken, err, "A token should not be verified with an algorithm other than its key's")
+}
+
+func TestTokenLeeway(t *testing.T) {
+	assert := assert.New(t)
+
+	key := TokenKey{ID: "k", Algorithm: HS256, Key: []byte(strings.Repeat("k", 32))}
+	strict, u := tokenAuthenticator(TokenOptions{TTL: time.Second}, key)
+	lenient, _ := tokenAuthenticator(TokenOptions{TTL: time.Second, Leeway: time.Minute}, key)
+	token, _ := strict.IssueToken(u)
+
+	time.Sleep(2100 * time.Millisecond)
+	_, err := strict.VerifyToken(token)
+	assert.Equal(ErrTokenExpired, err)
+	_, err = lenient.VerifyToken(token)
+	assert.NoError(err, "Expired tokens within the leeway should still verify")
+
+	audience, _ := tokenAuthenticator(TokenOptions{Audience: "api", Leeway: time.Minute}, key)
+	_, err = audience.VerifyToken(token)
+	assert.Equal(ErrInvalidToken, err, "Tokens for another audience should be rejected")
+
+	none := encodeSegment([]byte(`{"alg":"none","typ":"JWT"}`)) + "." + strings.Split(token, ".")[1] + "."
+	_, err = lenient.VerifyToken(none)
+	assert.Equal(ErrInvalidToken, err, "Unsigned tokens should be rejected")
+}
+
+func TestAuthenticateBearer(t *testing.T) {
+	assert := assert.New(t)
+
+	a, u := tokenAuthenticator(TokenOptions{}, TokenKey{ID: "k", Algorithm: HS256, Key: []byte(strings.Repeat("k", 32))})
+	token, _ := a.IssueToken(u)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	_, err := a.AuthenticateBearer(req)
+	assert.Equal(ErrNoBearerToken, err)
+
+	req.Header.Set("Authorization", "Bearer "+token)
+	user, err := a.AuthenticateBearer(req)
+	assert.NoError(err)
+	assert.Equal(u, user, "The bearer token should yield the same user as a cookie session")
+
+	req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("a:b")))
+	assert.Equal("", BearerToken(req))
+}
+
+func TestTokenAudience(t *testing.T) {
+	assert := assert.New(t)
+
+	key := TokenKey{ID: "k", Algorithm: HS256, Key: []byte(strings.Repeat("k", 32))}
+	a, u := tokenAuthenticator(TokenOptions{Audience: "api"}, key)
+	token, _ := a.IssueToken(u)
+	payload, _ := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[1])
+	assert.Contains(string(payload), `"aud":"api"`, "A single audience should be issued as a string")
+
+	var claims TokenClaims
+	assert.NoError(json.Unmarshal([]byte(`{"aud":["web","api"]}`), &claims))
+	assert.Equal(Audience{"web", "api"}, claims.Audience, "An audience array should be decoded")
+	assert.True(claims.Audience.accepts("api"), "A token listing the configured audience should be accepted")
+	assert.False(claims.Audience.accepts("admin"), "A token not listing the configured audience should be rejected")
+	assert.False(claims.Audience.accepts(""), "Tokens with an audience should be rejected when none is configured")
+	assert.True(Audience(nil).accepts(""), "Tokens without an audience should be accepted when none is configured")
+
+	encoded, _ := json.Marshal(claims.Audience)
+	assert.Equal(`["web","api"]`, string(encoded), "Several audiences should be encoded as an array")
+}
+
+type byIDUserAuthRepo struct {
+	rehashingUserAuthRepo
+	ids []int
+}
+
+func (repo *byIDUserAuthRepo) GetUserByID(ctx context.Context, userID int) (User, error) {
+	repo.ids = append(repo.ids, userID)
+	return repo.user, nil
+}
+
+func (repo *byIDUserAuthRepo) GetUserFromSession(s Session) (User, error) {
+	return nil, errors.New("GetUserFromSession should not be called")
+}
+
+func TestUserFromClaimsByID(t *testing.T) {
+	assert := assert.New(t)
+
+	u := &StdUser{UserID: 7}
+	repo := &byIDUserAuthRepo{rehashingUserAuthRepo: rehashingUserAuthRepo{user: u}}
+	a := NewAuthenticator(repo)
+
+	user, err := a.UserFromClaims(context.Background(), &TokenClaims{UserID: 7})
+	assert.NoError(err)
+	assert.Equal(u, user)
+	assert.Equal([]int{7}, repo.ids, "The user should be loaded through GetUserByID when the repo implements it")
+}
+
+func TestEnableTokensWhileInUse(t *testing.T) {
+	assert := assert.New(t)
+
+	key := TokenKey{ID: "k", Algorithm: HS256, Key: []byte(strings.Repeat("k", 32))}
+	a, u := tokenAuthenticator(TokenOptions{}, key)
+	token, _ := a.IssueToken(u)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			a.EnableTokens(TokenOptions{Leeway: time.Duration(i) * time.Second}, key)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		_, err := a.VerifyToken(token)
+		assert.NoError(err, "Tokens should verify while the options are changed")
+	}
+	<-done
+}
@@ -0,0 +1,168 @@
+package juno
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+//NewTOTP is a factory constructor for a TOTP using 6 digit codes, a 30 second period and one step of allowed clock skew
+func NewTOTP(issuer string) *TOTP {
+	return &TOTP{
+		Issuer: issuer,
+		Digits: 6,
+		Period: 30 * time.Second,
+		Skew:   1,
+	}
+}
+
+//TOTP generates and verifies RFC 6238 time based one time passwords using HMAC-SHA1, as supported by authenticator apps.
+//Zero values of Digits, Period and Skew are treated as the defaults of NewTOTP.
+type TOTP struct {
+	//Issuer is shown next to the account in authenticator apps
+	Issuer string
+	Digits int
+	Period time.Duration
+	//Skew is the number of periods before and after the current one in which a code is accepted
+	Skew int
+}
+
+func (t *TOTP) digits() int {
+	if t.Digits < 1 {
+		return 6
+	}
+	return t.Digits
+}
+
+//period is at least a second, as steps are counted in whole seconds
+func (t *TOTP) period() int64 {
+	if t.Period < time.Second {
+		return 30
+	}
+	return int64(t.Period / time.Second)
+}
+
+func (t *TOTP) skew() int64 {
+	if t.Skew < 1 {
+		return 1
+	}
+	return int64(t.Skew)
+}
+
+//GenerateTOTPSecret returns a random 160 bit secret, base32 encoded without padding
+func GenerateTOTPSecret() (string, error) {
+	secret := make([]byte, 20)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+//ProvisioningURI returns the otpauth:// uri for secret, to be shown to the user as a QR code
+func (t *TOTP) ProvisioningURI(account, secret string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", t.Issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(t.digits()))
+	params.Set("period", fmt.Sprint(t.period()))
+	label := url.PathEscape(t.Issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+//Step returns the time step at the provided time
+func (t *TOTP) Step(at time.Time) int64 {
+	return at.Unix() / t.period()
+}
+
+//Code returns the code for secret at the provided time
+func (t *TOTP) Code(secret string, at time.Time) (string, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return t.code(key, t.Step(at)), nil
+}
+
+//Verify checks code against secret within the allowed skew around the provided time. Codes from steps at or before
+//lastStep are rejected with ErrCodeReused, so each code can only be used once. The matched step is returned, to be stored
+//as the new lastStep.
+func (t *TOTP) Verify(secret, code string, lastStep int64, at time.Time) (int64, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return 0, err
+	}
+	code = strings.Replace(code, " ", "", -1)
+	current := t.Step(at)
+	for step := current - t.skew(); step <= current+t.skew(); step++ {
+		if subtle.ConstantTimeCompare([]byte(t.code(key, step)), []byte(code)) == 1 {
+			if step <= lastStep {
+				return 0, ErrCodeReused
+			}
+			return step, nil
+		}
+	}
+	return 0, ErrInvalidCode
+}
+
+//code implements the RFC 4226 HOTP algorithm for the provided counter
+func (t *TOTP) code(key []byte, counter int64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0xf
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	digits := t.digits()
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
+
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.Replace(secret, " ", "", -1))
+	key, err := totpEncoding.DecodeString(strings.TrimRight(secret, "="))
+	if err != nil || len(key) == 0 {
+		return nil, ErrInvalidTOTPSecret
+	}
+	return key, nil
+}
+
+//GenerateRecoveryCodes returns n single use recovery codes to be shown to the user once, and their hashes to be stored
+func GenerateRecoveryCodes(n int) (codes []string, hashes []string, err error) {
+	for i := 0; i < n; i++ {
+		raw := make([]byte, 5)
+		_, err := rand.Read(raw)
+		if err != nil {
+			return nil, nil, err
+		}
+		code := hex.EncodeToString(raw)
+		code = code[:5] + "-" + code[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+//HashRecoveryCode returns the hash under which a recovery code is stored. Codes are compared ignoring case, spaces and dashes.
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,234 @@
+package juno
+
+import (
+	"context"
+	"encoding/base32"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//rfcSecret is the shared secret of the RFC 6238 SHA1 test vectors
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCode(t *testing.T) {
+	assert := assert.New(t)
+
+	totp := NewTOTP("Juno")
+	totp.Digits = 8
+	vectors := map[int64]string{
+		59:         "94287082",
+		1111111109: "07081804",
+		1234567890: "89005924",
+		2000000000: "69279037",
+	}
+	for unix, expected := range vectors {
+		code, err := totp.Code(rfcSecret, time.Unix(unix, 0))
+		assert.NoError(err)
+		assert.Equal(expected, code, "The code at %d should match the RFC 6238 test vector", unix)
+	}
+
+	_, err := totp.Code("not base32!", time.Now())
+	assert.Equal(ErrInvalidTOTPSecret, err)
+}
+
+func TestTOTPVerify(t *testing.T) {
+	assert := assert.New(t)
+
+	totp := NewTOTP("Juno")
+	now := time.Unix(1111111109, 0)
+	previous, _ := totp.Code(rfcSecret, now.Add(-totp.Period))
+	stale, _ := totp.Code(rfcSecret, now.Add(-3*totp.Period))
+
+	step, err := totp.Verify(rfcSecret, previous, 0, now)
+	assert.NoError(err, "Codes within the allowed skew should be accepted")
+	assert.Equal(totp.Step(now)-1, step)
+
+	_, err = totp.Verify(rfcSecret, previous, step, now)
+	assert.Equal(ErrCodeReused, err, "A code from an already accepted step should be rejected")
+
+	_, err = totp.Verify(rfcSecret, stale, 0, now)
+	assert.Equal(ErrInvalidCode, err, "Codes outside the allowed skew should be rejected")
+}
+
+func TestProvisioningURI(t *testing.T) {
+	assert := assert.New(t)
+
+	secret, err := GenerateTOTPSecret()
+	assert.NoError(err)
+	assert.Equal(32, len(secret), "A 160 bit secret should be 32 base32 characters")
+
+	uri := NewTOTP("Juno Inc").ProvisioningURI("test@juno.com", secret)
+	assert.True(strings.HasPrefix(uri, "otpauth://totp/Juno%20Inc:test@juno.com?"))
+	assert.Contains(uri, "secret="+secret)
+	assert.Contains(uri, "issuer=Juno+Inc")
+	assert.Contains(uri, "digits=6")
+	assert.Contains(uri, "period=30")
+}
+
+type mockSecondFactorRepo struct {
+	secret   string
+	lastStep int64
+	codes    map[string]bool
+}
+
+func (repo *mockSecondFactorRepo) GetTOTP(ctx context.Context, userID int) (string, int64, error) {
+	if repo.secret == "" {
+		return "", 0, ErrSecondFactorNotEnrolled
+	}
+	return repo.secret, repo.lastStep, nil
+}
+
+func (repo *mockSecondFactorRepo) SetTOTPStep(ctx context.Context, userID int, step int64) error {
+	if step <= repo.lastStep {
+		return ErrCodeReused
+	}
+	repo.lastStep = step
+	return nil
+}
+
+func (repo *mockSecondFactorRepo) ConsumeRecoveryCode(ctx context.Context, userID int, hash string) (bool, error) {
+	ok := repo.codes[hash]
+	delete(repo.codes, hash)
+	return ok, nil
+}
+
+func TestTOTPDefaults(t *testing.T) {
+	assert := assert.New(t)
+
+	at := time.Unix(59, 0)
+	zero := &TOTP{Issuer: "Juno"}
+	expected, _ := NewTOTP("Juno").Code(rfcSecret, at)
+	code, err := zero.Code(rfcSecret, at)
+	assert.NoError(err, "A TOTP without a period should not divide by zero")
+	assert.Equal(expected, code, "Zero values should be treated as the defaults")
+	_, err = zero.Verify(rfcSecret, code, 0, at.Add(30*time.Second))
+	assert.NoError(err, "The default skew should accept the previous code")
+	assert.Contains(zero.ProvisioningURI("test", rfcSecret), "period=30")
+
+	authenticator := NewAuthenticator(&rehashingUserAuthRepo{})
+	assert.Error(authenticator.EnableSecondFactor(&mockSecondFactorRepo{}, nil), "A nil TOTP should be rejected")
+}
+
+func TestTwoStepLogin(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	hash, _ := NewBcryptHasher(4).Hash("s3cret")
+	repo := &rehashingUserAuthRepo{user: &StdUser{UserID: 1, Email: "test@juno.com", Password: hash}}
+	secret, _ := GenerateTOTPSecret()
+	codes, hashes, err := GenerateRecoveryCodes(2)
+	assert.NoError(err)
+	mfa := &mockSecondFactorRepo{secret: secret, codes: map[string]bool{hashes[0]: true, hashes[1]: true}}
+
+	totp := NewTOTP("Juno")
+	authenticator := NewAuthenticator(repo, NewBcryptHasher(4))
+	authenticator.EnableSecondFactor(mfa, totp)
+	authenticator.EnableLockout(newMockAttemptStore(), LockoutOptions{})
+
+	session := NewStdSession()
+	_, err = authenticator.BeginLoginFrom(ctx, session, mockCredentials{"test@juno.com", "s3cret"}, "")
+	assert.Equal(ErrSecondFactorRequired, err)
+	assert.True(authenticator.SecondFactorPending(session))
+	_, ok := session.Get(USER_ID_SESSION_KEY)
+	assert.False(ok, "The session should not be authenticated until the second factor is checked")
+
+	_, err = authenticator.CompleteLogin(ctx, session, "000000")
+	assert.Equal(ErrInvalidCode, err)
+
+	code, _ := totp.Code(secret, time.Now())
+	user, err := authenticator.CompleteLogin(ctx, session, code)
+	assert.NoError(err)
+	assert.Equal(1, user.ID())
+	assert.False(authenticator.SecondFactorPending(session))
+	_, ok = session.Get(USER_ID_SESSION_KEY)
+	assert.True(ok, "The session should be authenticated once the second factor is checked")
+
+	session = NewStdSession()
+	authenticator.BeginLoginFrom(ctx, session, mockCredentials{"test@juno.com", "s3cret"}, "")
+	_, err = authenticator.CompleteLogin(ctx, session, code)
+	assert.Equal(ErrCodeReused, err, "A TOTP code should only be accepted once")
+
+	_, err = authenticator.CompleteLogin(ctx, session, strings.ToUpper(codes[0]))
+	assert.NoError(err, "A recovery code should complete the login")
+	assert.Equal(1, len(mfa.codes), "A recovery code should only be usable once")
+
+	session = NewStdSession()
+	_, err = authenticator.CompleteLogin(ctx, session, code)
+	assert.Equal(ErrNoPendingLogin, err)
+
+	authenticator.BeginLoginFrom(ctx, session, mockCredentials{"test@juno.com", "s3cret"}, "")
+	for i := 0; i < MaxSecondFactorAttempts; i++ {
+		authenticator.CompleteLogin(ctx, session, "000000")
+	}
+	assert.False(authenticator.SecondFactorPending(session), "The pending login should be abandoned after too many invalid codes")
+
+	code, _ = totp.Code(secret, time.Now().Add(30*time.Second))
+	authenticator.BeginLoginFrom(ctx, session, mockCredentials{"test@juno.com", "s3cret"}, "")
+	_, err = authenticator.CompleteLogin(ctx, session, code)
+	assert.Equal(ErrAccountLocked, err, "Starting a new login should not allow more guesses")
+
+	mfa.secret = ""
+	user, err = authenticator.BeginLoginFrom(ctx, session, mockCredentials{"test@juno.com", "s3cret"}, "")
+	assert.NoError(err, "Users without a second factor should be logged in directly")
+	assert.Equal(1, user.ID())
+}
+
+func TestSecondFactorAttempts(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	hash, _ := NewBcryptHasher(4).Hash("s3cret")
+	repo := &rehashingUserAuthRepo{user: &StdUser{UserID: 1, Email: "test@juno.com", Password: hash}}
+	secret, _ := GenerateTOTPSecret()
+	totp := NewTOTP("Juno")
+	authenticator := NewAuthenticator(repo, NewBcryptHasher(4))
+	authenticator.EnableSecondFactor(&mockSecondFactorRepo{secret: secret}, totp)
+
+	_, err := authenticator.BeginLoginFrom(ctx, NewStdSession(), mockCredentials{"test@juno.com", "s3cret"}, "")
+	assert.Error(err, "Enrolled users should not be logged in without an AttemptStore to limit their codes")
+
+	store := newMockAttemptStore()
+	authenticator.EnableLockout(store, LockoutOptions{Username: LockoutPolicy{MaxAttempts: 3, Delay: time.Hour}})
+	authenticator.Authenticate(mockCredentials{"test@juno.com", "wrong"})
+
+	session := NewStdSession()
+	_, err = authenticator.BeginLoginFrom(ctx, session, mockCredentials{"test@juno.com", "s3cret"}, "")
+	assert.Equal(ErrSecondFactorRequired, err)
+	assert.Equal(1, store.failures["username:test@juno.com"], "The password alone should not clear the username failures")
+
+	_, err = authenticator.CompleteLogin(ctx, session, "000000")
+	assert.Equal(ErrInvalidCode, err)
+	assert.Equal(1, store.failures["mfa:1"], "Invalid codes should be counted for the user")
+
+	code, _ := totp.Code(secret, time.Now())
+	_, err = authenticator.CompleteLogin(ctx, session, code)
+	assert.NoError(err)
+	assert.Equal(0, store.failures["mfa:1"])
+	assert.Equal(0, store.failures["username:test@juno.com"], "Completing the login should clear the username failures")
+}
+
+func TestBeginLoginIPLockout(t *testing.T) {
+	assert := assert.New(t)
+
+	hash, _ := NewBcryptHasher(4).Hash("s3cret")
+	repo := &rehashingUserAuthRepo{user: &StdUser{UserID: 1, Email: "test@juno.com", Password: hash}}
+	authenticator := NewAuthenticator(repo, NewBcryptHasher(4))
+	authenticator.EnableSecondFactor(&mockSecondFactorRepo{secret: rfcSecret}, NewTOTP("Juno"))
+	store := newMockAttemptStore()
+	authenticator.EnableLockout(store, LockoutOptions{IP: LockoutPolicy{MaxAttempts: 2, Delay: time.Hour}})
+
+	req := httptest.NewRequest("POST", "/login", nil)
+	req.RemoteAddr = "10.0.0.1:5000"
+	for _, username := range []string{"a@juno.com", "b@juno.com"} {
+		_, err := authenticator.BeginLogin(req, NewStdSession(), mockCredentials{username, "wrong"})
+		assert.Equal(ErrInvalidCredentials, err)
+	}
+	assert.Equal(2, store.failures["ip:10.0.0.1"], "Failed two step logins should be counted for the client ip")
+
+	_, err := authenticator.BeginLogin(req, NewStdSession(), mockCredentials{"test@juno.com", "s3cret"})
+	assert.Equal(ErrAccountLocked, err, "A locked ip should not be able to start a two step login")
+}
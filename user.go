@@ -10,8 +10,22 @@ type (
 		ID() int
 		Role() UserRole
 	}
+
+	//MultiRoleUser is a User that may be assigned more than one role
+	MultiRoleUser interface {
+		User
+		Roles() []UserRole
+	}
 )
 
+//RolesOf returns every role assigned to a user, falling back to its single Role when it is not a MultiRoleUser
+func RolesOf(u User) []UserRole {
+	if multi, ok := u.(MultiRoleUser); ok {
+		return multi.Roles()
+	}
+	return []UserRole{u.Role()}
+}
+
 //StdUser implements the user interface and is meant to be thought of as a base user struct, and embedded in more involved and/or specfic user structs
 type StdUser struct {
 	UserID      int    `db:"UserID" json:"userId"`
@@ -21,6 +35,8 @@ type StdUser struct {
 	Created     time.Time              `db:"Created" json:"created"`
 	Modified    time.Time              `db:"Modified" json:"modified"`
 	LastLogin   time.Time `db:"LastLogin" json:"lastLogin"`
+	//AssignedRoles are the roles assigned to the user in addition to its primary StdUserRole
+	AssignedRoles []StdUserRole `db:"-" json:"roles,omitempty"`
 }
 
 //GetUsername implements the Credentials interface and returns the users email
@@ -42,3 +58,14 @@ func (u *StdUser) ID() int {
 func (u *StdUser) Role() UserRole {
 	return &u.StdUserRole
 }
+
+//Roles implements the MultiRoleUser interface and exposes the user's primary role followed by any other assigned roles
+func (u *StdUser) Roles() []UserRole {
+	results := []UserRole{&u.StdUserRole}
+	for i := range u.AssignedRoles {
+		if u.AssignedRoles[i].RoleID != u.RoleID {
+			results = append(results, &u.AssignedRoles[i])
+		}
+	}
+	return results
+}
@@ -0,0 +1,24 @@
+package user
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/syllabix/juno"
+)
+
+type key int
+
+const userKey key = 0
+
+//NewContext returns a new context with an authenticated user, who is also the actor of audit events
+func NewContext(ctx context.Context, user juno.User) context.Context {
+	ctx = juno.WithActor(ctx, strconv.Itoa(user.ID()))
+	return context.WithValue(ctx, userKey, user)
+}
+
+//FromContext takes a context as an argument and extracts the authenticated user from it if set
+func FromContext(ctx context.Context) (juno.User, bool) {
+	user, ok := ctx.Value(userKey).(juno.User)
+	return user, ok
+}
@@ -8,7 +8,10 @@ import (
 
 type key string
 
-const userkey key = "user_role"
+const (
+	userkey  key = "user_role"
+	rolesKey key = "user_roles"
+)
 
 //NewContext returns a new context with a session id
 func NewContext(ctx context.Context, role juno.UserRole) context.Context {
@@ -20,3 +23,14 @@ func FromContext(ctx context.Context) (juno.UserRole, bool) {
 	session, ok := ctx.Value(userkey).(juno.UserRole)
 	return session, ok
 }
+
+//NewRolesContext returns a new context with every role of a user, as returned by juno.RolesOf
+func NewRolesContext(ctx context.Context, roles []juno.UserRole) context.Context {
+	return context.WithValue(ctx, rolesKey, roles)
+}
+
+//RolesFromContext extracts every role of the user from ctx if set. NewContext only carries the primary role.
+func RolesFromContext(ctx context.Context) ([]juno.UserRole, bool) {
+	roles, ok := ctx.Value(rolesKey).([]juno.UserRole)
+	return roles, ok
+}
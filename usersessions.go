@@ -0,0 +1,54 @@
+package juno
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+type (
+	//SessionInfo describes an active session of a user, so users can see where they are logged in
+	SessionInfo struct {
+		SessionID  string
+		UserID     int
+		Created    time.Time
+		LastSeen   time.Time
+		Expiration time.Time
+		IPAddress  string
+		UserAgent  string
+	}
+
+	//UserSessionStore is implemented by SessionProviders that index sessions by the user stored under USER_ID_SESSION_KEY
+	UserSessionStore interface {
+		//ListUserSessions returns the active sessions of a user, most recently seen first
+		ListUserSessions(ctx context.Context, userID int) ([]SessionInfo, error)
+		//EndUserSession ends one session of a user. Sessions of other users are not affected.
+		EndUserSession(ctx context.Context, userID int, sessionID string) error
+		//EndUserSessions ends every session of a user except the provided session ids, such as the current one
+		EndUserSessions(ctx context.Context, userID int, except ...string) error
+	}
+)
+
+//LastSeenInterval is how often a SessionProvider records that a session was seen, to avoid a write on every request
+const LastSeenInterval = time.Minute
+
+//Outdated reports whether a SessionProvider is to record that the session was seen by req: the last seen time is
+//older than LastSeenInterval, or the client ip or user agent changed
+func (info SessionInfo) Outdated(req *http.Request) bool {
+	return time.Since(info.LastSeen) > LastSeenInterval || info.IPAddress != ClientIP(req) || info.UserAgent != req.UserAgent()
+}
+
+//ClientIP returns the ip of req.RemoteAddr. Proxy headers such as X-Forwarded-For are not trusted.
+func ClientIP(req *http.Request) string {
+	ip, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return ip
+}
+
+//SessionUserID returns the id of the user a session is logged in as
+func SessionUserID(s Session) (int, bool) {
+	return GetInt(s, USER_ID_SESSION_KEY)
+}